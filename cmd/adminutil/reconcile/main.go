@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/sudo-init-do/crafthub/internal/db"
+	"github.com/sudo-init-do/crafthub/internal/reconcile"
+)
+
+// reconcile recomputes every wallet from topups, withdrawals and orders,
+// compares it with the ledger and reports drift. Exits 1 when issues are found.
+// Usage:
+//
+//	go run cmd/adminutil/reconcile/main.go [-json]
+func main() {
+	asJSON := flag.Bool("json", false, "Print the full report as JSON")
+	flag.Parse()
+
+	// Initialize DB from environment variables
+	db.Init()
+
+	report, err := reconcile.Run(context.Background())
+	if err != nil {
+		log.Fatalf("reconciliation failed: %v", err)
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			log.Fatalf("failed to encode report: %v", err)
+		}
+	} else {
+		fmt.Printf("Checked %d wallets at %s\n", report.WalletsChecked, report.GeneratedAt.Format("2006-01-02 15:04:05 UTC"))
+		for _, d := range report.WalletDrifts {
+			fmt.Printf("wallet %s: balance %d (expected %d), locked %d (expected %d), escrow %d (expected %d)\n",
+				d.UserID, d.Balance, d.ExpectedBalance, d.Locked, d.ExpectedLocked, d.Escrow, d.ExpectedEscrow)
+			for _, issue := range d.Issues {
+				fmt.Printf("  - %s\n", issue)
+			}
+		}
+		for _, o := range report.StuckOrders {
+			fmt.Printf("order %s (%s): amount %d, escrow %d - %s\n", o.OrderID, o.Status, o.Amount, o.Escrow, o.Issue)
+		}
+		for _, h := range report.OrphanHolds {
+			fmt.Printf("transaction %s: pending_hold of %d on %s order %s\n", h.TransactionID, h.Amount, h.OrderStatus, h.OrderID)
+		}
+		for _, id := range report.UnbalancedEntries {
+			fmt.Printf("ledger entry %s does not balance\n", id)
+		}
+		if report.Clean() {
+			fmt.Println("No drift found.")
+		}
+	}
+
+	if !report.Clean() {
+		os.Exit(1)
+	}
+}
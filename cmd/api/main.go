@@ -11,16 +11,29 @@ import (
     appmw "github.com/sudo-init-do/crafthub/internal/middleware"
     "github.com/sudo-init-do/crafthub/internal/db"
     "github.com/sudo-init-do/crafthub/internal/alerts"
+    "github.com/sudo-init-do/crafthub/internal/fees"
+    "github.com/sudo-init-do/crafthub/internal/ledger"
+    "github.com/sudo-init-do/crafthub/internal/payments"
+    "github.com/sudo-init-do/crafthub/internal/payouts"
     // handlers
     auth "github.com/sudo-init-do/crafthub/internal/auth"
     market "github.com/sudo-init-do/crafthub/internal/marketplace"
     w "github.com/sudo-init-do/crafthub/internal/wallet"
     admin "github.com/sudo-init-do/crafthub/internal/admin"
     user "github.com/sudo-init-do/crafthub/internal/user"
+    "github.com/sudo-init-do/crafthub/internal/storage"
     msg "github.com/sudo-init-do/crafthub/internal/messaging"
 )
 
 func main() {
+    // Refuse to start without a real payment setup rather than fall back to the mock
+    if err := payments.CheckConfig(); err != nil {
+        log.Fatalf("payments not configured: %v", err)
+    }
+    if err := payouts.CheckConfig(); err != nil {
+        log.Fatalf("payouts not configured: %v", err)
+    }
+
     // Init subsystems
     db.Init()
     alerts.Init()
@@ -38,6 +51,18 @@ func main() {
     e.POST("/login", auth.Login)
     e.GET("/user/:id/profile", user.GetPublicProfile)
 
+    // Public file links: avatars and signed local-disk downloads
+    e.GET("/files/avatars/:id", storage.AvatarRedirect)
+    e.GET("/files/blob", storage.ServeBlob)
+
+    // Payment provider callbacks (signed) and the dev mock checkout
+    e.POST("/payments/webhook/:provider", w.PaymentWebhook)
+    e.POST("/payouts/callback/:provider", w.PayoutCallback)
+    // The mock checkout lets anyone settle a payment, so it is opt-in for development
+    if payments.MockEnabled() {
+        e.POST("/payments/mock/:reference/:outcome", payments.MockCheckout)
+    }
+
     // Authenticated group
     g := e.Group("")
     g.Use(appmw.JWTMiddleware)
@@ -46,31 +71,71 @@ func main() {
     g.GET("/me", auth.Me)
     g.PATCH("/user/profile", user.UpdateProfile)
 
+    // File uploads and signed downloads
+    g.POST("/files", storage.UploadFile)
+    g.GET("/files/:id/url", storage.GetFileURL)
+
     // Wallet
     g.GET("/wallet/balance", w.Balance)
-    g.POST("/wallet/topups/init", w.TopupInit)
-    g.POST("/wallet/topups/:id/confirm", w.ConfirmTopup)
-    g.POST("/wallet/withdraw/init", w.InitWithdrawal)
-    g.POST("/wallet/withdraw/:id/confirm", w.ConfirmWithdrawal)
+    g.POST("/wallet/topups/init", w.TopupInit, appmw.Idempotency)
+    g.POST("/wallet/topups/:id/confirm", w.ConfirmTopup, appmw.Idempotency)
+    g.POST("/wallet/withdraw/init", w.InitWithdrawal, appmw.Idempotency)
+    g.GET("/wallet/withdrawals", w.ListWithdrawals)
+    g.GET("/wallet/payout-methods", w.ListPayoutMethods)
+    g.POST("/wallet/payout-methods", w.AddPayoutMethod)
+    g.POST("/wallet/payout-methods/:id/default", w.SetDefaultPayoutMethod)
+    g.DELETE("/wallet/payout-methods/:id", w.DeletePayoutMethod)
+    g.POST("/wallet/withdrawals/:id/cancel", w.CancelWithdrawal, appmw.Idempotency)
     g.GET("/wallet/transactions", w.GetUserTransactions)
+    g.GET("/wallet/statements", w.Statements)
+    g.POST("/wallet/tips", w.SendTip, appmw.Idempotency)
+    g.GET("/wallet/tips", w.ListTips)
 
     // Marketplace services
     g.POST("/marketplace/services", market.CreateService)
     e.GET("/marketplace/services", market.GetAllServices) // public discovery
+    e.GET("/marketplace/services/:id", market.GetService) // public detail with packages and extras
     g.GET("/marketplace/services/me", market.GetUserServices)
+    g.PATCH("/marketplace/services/:id", market.UpdateService)  // edit, pause or resume
+    g.DELETE("/marketplace/services/:id", market.DeleteService)
+    g.GET("/marketplace/services/:id/versions", market.ListServiceVersions)
 
     // Marketplace orders
-    g.POST("/marketplace/orders", market.CreateOrder)
-    g.POST("/marketplace/orders/:id/accept", market.AcceptOrder)
-    g.POST("/marketplace/orders/:id/reject", market.RejectOrder)
-    g.POST("/marketplace/orders/:id/confirm", market.ConfirmOrder)
-    g.POST("/marketplace/orders/:id/cancel", market.CancelOrder)
-    g.POST("/marketplace/orders/:id/decline", market.DeclineOrder)
-    g.POST("/marketplace/orders/:id/deliver", market.DeliverOrder)
-    g.POST("/marketplace/orders/:id/complete", market.CompleteOrder)
+    g.POST("/marketplace/orders", market.CreateOrder, appmw.Idempotency)
+    g.POST("/marketplace/orders/:id/accept", market.AcceptOrder, appmw.Idempotency)
+    g.POST("/marketplace/orders/:id/reject", market.RejectOrder, appmw.Idempotency)
+    g.POST("/marketplace/orders/:id/confirm", market.ConfirmOrder, appmw.Idempotency)
+    g.POST("/marketplace/orders/:id/cancel", market.CancelOrder, appmw.Idempotency)
+    g.POST("/marketplace/orders/:id/decline", market.DeclineOrder, appmw.Idempotency)
+    g.POST("/marketplace/orders/:id/deliver", market.DeliverOrder, appmw.Idempotency)
+    g.POST("/marketplace/orders/:id/revision", market.RequestRevision, appmw.Idempotency)
+    g.GET("/marketplace/orders/:id/deliveries", market.ListDeliveries)
+    g.GET("/marketplace/orders/:id/requirements", market.GetRequirements)
+    g.POST("/marketplace/orders/:id/requirements", market.SubmitRequirements)
+    g.GET("/marketplace/orders/:id/offers", market.ListOffers)
+    g.POST("/marketplace/orders/:id/offers", market.SendOffer)
+    g.POST("/marketplace/offers/:id/accept", market.AcceptOffer, appmw.Idempotency)
+    g.POST("/marketplace/offers/:id/decline", market.DeclineOffer)
+    g.POST("/marketplace/offers/:id/withdraw", market.WithdrawOffer)
+    g.GET("/marketplace/orders/:id/extensions", market.ListExtensions)
+    g.POST("/marketplace/orders/:id/extensions", market.RequestExtension)
+    g.POST("/marketplace/orders/:id/extensions/:extension_id/accept", market.AcceptExtension)
+    g.POST("/marketplace/orders/:id/extensions/:extension_id/reject", market.RejectExtension)
+    g.POST("/marketplace/orders/:id/complete", market.CompleteOrder, appmw.Idempotency)
     g.POST("/marketplace/orders/:id/dispute", market.OpenDispute)
+    g.GET("/marketplace/disputes/:id/proposals", market.ListProposals)
+    g.POST("/marketplace/disputes/:id/proposals", market.ProposeSettlement)
+    g.POST("/marketplace/disputes/:id/proposals/:proposal_id/accept", market.AcceptProposal, appmw.Idempotency)
+    g.POST("/marketplace/disputes/:id/proposals/:proposal_id/counter", market.CounterProposal)
+    g.POST("/marketplace/disputes/:id/proposals/:proposal_id/reject", market.RejectProposal)
+    g.POST("/marketplace/disputes/:id/escalate", market.EscalateDispute)
+    g.GET("/marketplace/disputes/:id/messages", market.ListDisputeMessages)
+    g.POST("/marketplace/disputes/:id/messages", market.PostDisputeMessage)
     g.GET("/marketplace/orders", market.GetUserOrders)
-    g.POST("/admin/orders/:id/release", market.ReleaseOrder, appmw.AdminGuard)
+    g.GET("/marketplace/orders/:id", market.GetOrder)
+    g.GET("/marketplace/orders/:id/timeline", market.GetOrderTimeline)
+    g.POST("/admin/orders/:id/release", market.ReleaseOrder, appmw.AdminGuard, appmw.Idempotency)
+    g.POST("/admin/orders/:id/extend", market.GrantExtension, appmw.AdminGuard)
 
     // Messaging per order
     g.GET("/marketplace/orders/:id/messages", msg.ListMessages)
@@ -96,8 +161,23 @@ func main() {
     adminGroup.GET("/bookings", admin.ListBookings)
     adminGroup.GET("/wallets", admin.ListWallets)
     adminGroup.GET("/transactions", w.AdminGetAllTransactions)
+    adminGroup.GET("/withdrawals", w.AdminListWithdrawals)
+    adminGroup.POST("/withdrawals/:id/approve", w.ApproveWithdrawal, appmw.Idempotency)
+    adminGroup.POST("/withdrawals/:id/reject", w.RejectWithdrawal, appmw.Idempotency)
+    adminGroup.GET("/ledger/entries", ledger.ListEntries)
+    adminGroup.GET("/ledger/accounts", ledger.ListAccounts)
+    adminGroup.GET("/reconcile", admin.Reconcile)
+    adminGroup.GET("/fees", fees.ListSchedules)
+    adminGroup.POST("/fees", fees.CreateSchedule)
+    adminGroup.GET("/fees/quote", fees.PreviewQuote)
+    adminGroup.PATCH("/fees/:id", fees.UpdateSchedule)
+    adminGroup.DELETE("/fees/:id", fees.DeactivateSchedule)
     adminGroup.GET("/disputes", admin.ListDisputes)
-    adminGroup.POST("/disputes/:id/resolve", admin.ResolveDispute)
+    adminGroup.GET("/disputes/:id", admin.GetDispute)
+    adminGroup.POST("/disputes/:id/claim", admin.ClaimDispute)
+    adminGroup.POST("/disputes/:id/assign", admin.AssignDispute)
+    adminGroup.POST("/disputes/:id/priority", admin.SetDisputePriority)
+    adminGroup.POST("/disputes/:id/resolve", admin.ResolveDispute, appmw.Idempotency)
     adminGroup.GET("/users", admin.ListUsers)
     adminGroup.POST("/users/:id/suspend", admin.SuspendUser)
     adminGroup.POST("/users/:id/activate", admin.ActivateUser)
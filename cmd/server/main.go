@@ -15,6 +15,8 @@ import (
 	"github.com/sudo-init-do/crafthub/internal/auth"
 	"github.com/sudo-init-do/crafthub/internal/db"
 	"github.com/sudo-init-do/crafthub/internal/marketplace"
+	"github.com/sudo-init-do/crafthub/internal/payments"
+	"github.com/sudo-init-do/crafthub/internal/payouts"
 	mware "github.com/sudo-init-do/crafthub/internal/middleware"
 	"github.com/sudo-init-do/crafthub/internal/user"
 	"github.com/sudo-init-do/crafthub/internal/wallet"
@@ -23,6 +25,13 @@ import (
 func main() {
 	// Load environment variables from .env if present
 	_ = godotenv.Load()
+	// Refuse to start without a real payment setup rather than fall back to the mock
+	if err := payments.CheckConfig(); err != nil {
+		log.Fatalf("payments not configured: %v", err)
+	}
+	if err := payouts.CheckConfig(); err != nil {
+		log.Fatalf("payouts not configured: %v", err)
+	}
 	// Initialize database connection
 	db.Init()
 
@@ -86,19 +95,20 @@ func main() {
 
 	api.GET("/wallet/balance", wallet.Balance)
 	api.GET("/wallet/transactions", wallet.GetUserTransactions)
-	api.POST("/wallet/topup", wallet.TopupInit)
-	api.POST("/wallet/topup/confirm", wallet.ConfirmTopup)
-	api.POST("/wallet/withdraw", wallet.InitWithdrawal)
-	api.POST("/wallet/withdraw/confirm", wallet.ConfirmWithdrawal)
+	api.POST("/wallet/topup", wallet.TopupInit, mware.Idempotency)
+	api.POST("/wallet/topup/confirm", wallet.ConfirmTopup, mware.Idempotency)
+	api.POST("/wallet/withdraw", wallet.InitWithdrawal, mware.Idempotency)
+	api.GET("/wallet/withdrawals", wallet.ListWithdrawals)
+	api.POST("/wallet/withdrawals/:id/cancel", wallet.CancelWithdrawal, mware.Idempotency)
 
 	// Allow both creators and fans to list and manage their services
 	api.POST("/marketplace/services", marketplace.CreateService, mware.RequireRoles("creator", "fan"))
 	api.GET("/marketplace/services/me", marketplace.GetUserServices, mware.RequireRoles("creator", "fan"))
 
-	api.POST("/marketplace/orders", marketplace.CreateOrder, mware.RequireRoles("fan"))
+	api.POST("/marketplace/orders", marketplace.CreateOrder, mware.Idempotency, mware.RequireRoles("fan"))
 	// Allow both creators and fans to act as sellers
-	api.POST("/marketplace/orders/:id/accept", marketplace.AcceptOrder, mware.RequireRoles("creator", "fan"))
-	api.POST("/marketplace/orders/:id/confirm", marketplace.ConfirmOrder, mware.RequireRoles("creator", "fan"))
+	api.POST("/marketplace/orders/:id/accept", marketplace.AcceptOrder, mware.Idempotency, mware.RequireRoles("creator", "fan"))
+	api.POST("/marketplace/orders/:id/confirm", marketplace.ConfirmOrder, mware.Idempotency, mware.RequireRoles("creator", "fan"))
 	// Release is an admin operation; wired under /admin below
 	api.GET("/marketplace/orders/me", marketplace.GetUserOrders)
 	api.POST("/marketplace/orders/:id/review", marketplace.CreateReview)
@@ -0,0 +1,227 @@
+package admin
+
+import (
+    "context"
+    "errors"
+    "net/http"
+    "time"
+
+    "github.com/jackc/pgx/v5"
+    "github.com/labstack/echo/v4"
+    "github.com/sudo-init-do/crafthub/internal/alerts"
+    "github.com/sudo-init-do/crafthub/internal/db"
+    market "github.com/sudo-init-do/crafthub/internal/marketplace"
+    "github.com/sudo-init-do/crafthub/internal/orders"
+)
+
+// Dispute priorities and their SLA targets, counted from escalation to the
+// admin queue: first admin response, then resolution.
+var disputeSLATargets = map[string]struct{ response, resolution time.Duration }{
+    "urgent": {2 * time.Hour, 24 * time.Hour},
+    "high":   {8 * time.Hour, 72 * time.Hour},
+    "normal": {24 * time.Hour, 120 * time.Hour},
+    "low":    {48 * time.Hour, 240 * time.Hour},
+}
+
+type disputeSLA struct {
+    AgeHours           float64 `json:"age_hours"`
+    ResponseDueAt      *string `json:"response_due_at,omitempty"`
+    ResolutionDueAt    *string `json:"resolution_due_at,omitempty"`
+    ResponseBreached   bool    `json:"response_breached"`
+    ResolutionBreached bool    `json:"resolution_breached"`
+}
+
+// computeSLA derives the timers for a dispute. Disputes still in mediation
+// have no admin SLA yet.
+func computeSLA(now time.Time, priority, stage string, created time.Time, escalated, responded, resolved *time.Time) disputeSLA {
+    end := now
+    if resolved != nil {
+        end = *resolved
+    }
+    sla := disputeSLA{AgeHours: float64(int(end.Sub(created).Hours()*10)) / 10}
+    target, ok := disputeSLATargets[priority]
+    if !ok || stage != market.DisputeStageEscalated {
+        return sla
+    }
+    start := created
+    if escalated != nil {
+        start = *escalated
+    }
+    responseDue := start.Add(target.response)
+    resolutionDue := start.Add(target.resolution)
+    sla.ResponseDueAt = formatTime(&responseDue)
+    sla.ResolutionDueAt = formatTime(&resolutionDue)
+    if responded != nil {
+        sla.ResponseBreached = responded.After(responseDue)
+    } else {
+        sla.ResponseBreached = end.After(responseDue)
+    }
+    sla.ResolutionBreached = end.After(resolutionDue)
+    return sla
+}
+
+// GET /admin/disputes/:id
+// Dispute detail with the full thread and settlement proposals
+func GetDispute(c echo.Context) error {
+    ctx := context.Background()
+    id := c.Param("id")
+    var d AdminDispute
+    var buyerID, sellerID string
+    var created time.Time
+    var escalated, resolved, responded *time.Time
+    err := db.Conn.QueryRow(ctx,
+        `SELECT d.id::text, d.order_id::text, d.filer_id::text, d.reason, d.status, d.stage, d.priority, d.assigned_to::text,
+                COALESCE(d.resolution,''), COALESCE(d.notes,''), d.buyer_refund, d.seller_payout,
+                d.created_at, d.escalated_at, d.resolved_at, d.first_admin_response_at,
+                o.buyer_id::text, o.seller_id::text
+         FROM disputes d JOIN orders o ON o.id = d.order_id
+         WHERE d.id = $1`, id,
+    ).Scan(&d.ID, &d.OrderID, &d.FilerID, &d.Reason, &d.Status, &d.Stage, &d.Priority, &d.AssignedTo,
+        &d.Resolution, &d.Notes, &d.BuyerRefund, &d.SellerPayout,
+        &created, &escalated, &resolved, &responded, &buyerID, &sellerID)
+    if errors.Is(err, pgx.ErrNoRows) {
+        return c.JSON(http.StatusNotFound, echo.Map{"error": "dispute not found"})
+    }
+    if err != nil {
+        return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to fetch dispute"})
+    }
+    d.CreatedAt = created.UTC().Format(time.RFC3339)
+    d.EscalatedAt = formatTime(escalated)
+    d.ResolvedAt = formatTime(resolved)
+    d.SLA = computeSLA(time.Now(), d.Priority, d.Stage, created, escalated, responded, resolved)
+
+    messages, err := market.DisputeMessages(ctx, id)
+    if err != nil {
+        return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not fetch messages"})
+    }
+    d.MessageCount = len(messages)
+
+    rows, err := db.Conn.Query(ctx,
+        `SELECT id::text, proposer_id::text, refund_amount, COALESCE(note, ''), status, created_at, responded_at
+         FROM dispute_proposals WHERE dispute_id = $1 ORDER BY created_at`, id,
+    )
+    if err != nil {
+        return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not fetch proposals"})
+    }
+    defer rows.Close()
+    proposals := []market.SettlementProposal{}
+    for rows.Next() {
+        p := market.SettlementProposal{DisputeID: id}
+        if err := rows.Scan(&p.ID, &p.ProposerID, &p.RefundAmount, &p.Note, &p.Status, &p.CreatedAt, &p.RespondedAt); err != nil {
+            return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to read proposal"})
+        }
+        p.ProposerRole = orders.ActorSeller
+        if p.ProposerID == buyerID {
+            p.ProposerRole = orders.ActorBuyer
+        }
+        proposals = append(proposals, p)
+    }
+
+    return c.JSON(http.StatusOK, echo.Map{
+        "dispute":   d,
+        "buyer_id":  buyerID,
+        "seller_id": sellerID,
+        "messages":  messages,
+        "proposals": proposals,
+    })
+}
+
+// assignDispute sets the assignee of an open dispute. If onlyIfFree is set the
+// dispute must be unassigned (or already assigned to adminID).
+func assignDispute(ctx context.Context, disputeID, adminID string, onlyIfFree bool) (int, string) {
+    tx, err := db.Conn.Begin(ctx)
+    if err != nil {
+        return http.StatusInternalServerError, "transaction start failed"
+    }
+    defer tx.Rollback(ctx)
+
+    var status, assignee string
+    err = tx.QueryRow(ctx, `SELECT status, COALESCE(assigned_to::text, '') FROM disputes WHERE id = $1 FOR UPDATE`, disputeID).Scan(&status, &assignee)
+    if errors.Is(err, pgx.ErrNoRows) {
+        return http.StatusNotFound, "dispute not found"
+    }
+    if err != nil {
+        return http.StatusInternalServerError, "failed to fetch dispute"
+    }
+    if status != "open" {
+        return http.StatusConflict, "dispute is already resolved"
+    }
+    if onlyIfFree && assignee != "" && assignee != adminID {
+        return http.StatusConflict, "dispute is already assigned to another admin"
+    }
+    if _, err = tx.Exec(ctx,
+        `UPDATE disputes SET assigned_to = NULLIF($2, '')::uuid, assigned_at = CASE WHEN $2 = '' THEN NULL ELSE NOW() END WHERE id = $1`,
+        disputeID, adminID,
+    ); err != nil {
+        return http.StatusInternalServerError, "failed to assign dispute"
+    }
+    if err = tx.Commit(ctx); err != nil {
+        return http.StatusInternalServerError, "commit failed"
+    }
+    return http.StatusOK, ""
+}
+
+// POST /admin/disputes/:id/claim
+func ClaimDispute(c echo.Context) error {
+    adminID, ok := c.Get("user_id").(string)
+    if !ok || adminID == "" {
+        return c.JSON(http.StatusUnauthorized, echo.Map{"error": "unauthorized"})
+    }
+    if status, msg := assignDispute(context.Background(), c.Param("id"), adminID, true); msg != "" {
+        return c.JSON(status, echo.Map{"error": msg})
+    }
+    return c.JSON(http.StatusOK, echo.Map{"message": "dispute claimed", "dispute_id": c.Param("id"), "assigned_to": adminID})
+}
+
+// POST /admin/disputes/:id/assign
+// Assigns the dispute to an admin; an empty admin_id unassigns it.
+func AssignDispute(c echo.Context) error {
+    actorID, ok := c.Get("user_id").(string)
+    if !ok || actorID == "" {
+        return c.JSON(http.StatusUnauthorized, echo.Map{"error": "unauthorized"})
+    }
+    var req struct {
+        AdminID string `json:"admin_id"`
+    }
+    if err := c.Bind(&req); err != nil {
+        return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid payload"})
+    }
+    ctx := context.Background()
+    if req.AdminID != "" {
+        var role string
+        if err := db.Conn.QueryRow(ctx, `SELECT role FROM users WHERE id = $1`, req.AdminID).Scan(&role); err != nil || role != "admin" {
+            return c.JSON(http.StatusBadRequest, echo.Map{"error": "admin_id must be an admin user"})
+        }
+    }
+    if status, msg := assignDispute(ctx, c.Param("id"), req.AdminID, false); msg != "" {
+        return c.JSON(status, echo.Map{"error": msg})
+    }
+    if req.AdminID != "" && req.AdminID != actorID {
+        ref := c.Param("id")
+        meta := "{}"
+        _ = alerts.CreateNotification(req.AdminID, "dispute:assigned", "Dispute assigned to you", "A dispute has been assigned to you.", &ref, &meta)
+    }
+    return c.JSON(http.StatusOK, echo.Map{"message": "dispute assigned", "dispute_id": c.Param("id"), "assigned_to": req.AdminID})
+}
+
+// POST /admin/disputes/:id/priority
+func SetDisputePriority(c echo.Context) error {
+    var req struct {
+        Priority string `json:"priority"` // low|normal|high|urgent
+    }
+    if err := c.Bind(&req); err != nil {
+        return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid payload"})
+    }
+    if _, ok := disputeSLATargets[req.Priority]; !ok {
+        return c.JSON(http.StatusBadRequest, echo.Map{"error": "priority must be low, normal, high or urgent"})
+    }
+    ct, err := db.Conn.Exec(context.Background(),
+        `UPDATE disputes SET priority = $2 WHERE id = $1 AND status = 'open'`, c.Param("id"), req.Priority)
+    if err != nil {
+        return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to update priority"})
+    }
+    if ct.RowsAffected() == 0 {
+        return c.JSON(http.StatusNotFound, echo.Map{"error": "open dispute not found"})
+    }
+    return c.JSON(http.StatusOK, echo.Map{"message": "priority updated", "dispute_id": c.Param("id"), "priority": req.Priority})
+}
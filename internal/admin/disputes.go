@@ -2,12 +2,21 @@ package admin
 
 import (
     "context"
+    "encoding/json"
+    "errors"
+    "fmt"
     "net/http"
+    "strconv"
+    "strings"
     "time"
 
+    "github.com/jackc/pgx/v5"
     "github.com/labstack/echo/v4"
     "github.com/sudo-init-do/crafthub/internal/alerts"
     "github.com/sudo-init-do/crafthub/internal/db"
+    "github.com/sudo-init-do/crafthub/internal/ledger"
+    market "github.com/sudo-init-do/crafthub/internal/marketplace"
+    "github.com/sudo-init-do/crafthub/internal/orders"
 )
 
 type AdminDispute struct {
@@ -16,42 +25,108 @@ type AdminDispute struct {
     FilerID    string  `json:"filer_id"`
     Reason     string  `json:"reason"`
     Status     string  `json:"status"`
+    Stage      string  `json:"stage"`
+    Priority   string  `json:"priority"`
+    AssignedTo *string `json:"assigned_to"`
     Resolution string  `json:"resolution"`
     Notes      string  `json:"notes"`
+    BuyerRefund  *int64 `json:"buyer_refund,omitempty"`
+    SellerPayout *int64 `json:"seller_payout,omitempty"`
+    MessageCount int    `json:"message_count"`
     CreatedAt  string  `json:"created_at"`
+    EscalatedAt *string `json:"escalated_at,omitempty"`
     ResolvedAt *string `json:"resolved_at"`
+    SLA        disputeSLA `json:"sla"`
 }
 
-// GET /admin/disputes
+// GET /admin/disputes?status=&stage=&assignee=<id>|me|none&priority=&min_age_hours=&max_age_hours=
+// Open disputes still in mediation are between buyer and seller; the admin
+// queue is stage=escalated. Age is measured from when the dispute was opened.
 func ListDisputes(c echo.Context) error {
+    where := []string{"TRUE"}
+    var args []any
+    add := func(cond string, v any) {
+        args = append(args, v)
+        where = append(where, fmt.Sprintf(cond, len(args)))
+    }
+    if v := c.QueryParam("status"); v != "" {
+        add("d.status = $%d", v)
+    }
+    if v := c.QueryParam("stage"); v != "" {
+        add("d.stage = $%d", v)
+    }
+    if v := c.QueryParam("priority"); v != "" {
+        add("d.priority = $%d", v)
+    }
+    switch v := c.QueryParam("assignee"); v {
+    case "":
+    case "none":
+        where = append(where, "d.assigned_to IS NULL")
+    case "me":
+        adminID, _ := c.Get("user_id").(string)
+        add("d.assigned_to::text = $%d", adminID)
+    default:
+        add("d.assigned_to::text = $%d", v)
+    }
+    for param, cond := range map[string]string{
+        "min_age_hours": "d.created_at <= NOW() - make_interval(hours => $%d)",
+        "max_age_hours": "d.created_at >= NOW() - make_interval(hours => $%d)",
+    } {
+        if v := c.QueryParam(param); v != "" {
+            h, err := strconv.Atoi(v)
+            if err != nil || h < 0 {
+                return c.JSON(http.StatusBadRequest, echo.Map{"error": param + " must be a non-negative integer"})
+            }
+            add(cond, h)
+        }
+    }
+
     rows, err := db.Conn.Query(context.Background(),
-        `SELECT id::text, order_id::text, filer_id::text, reason, status, COALESCE(resolution,'') AS resolution, COALESCE(notes,'') AS notes, created_at, resolved_at
-         FROM disputes ORDER BY created_at DESC`,
+        `SELECT d.id::text, d.order_id::text, d.filer_id::text, d.reason, d.status, d.stage, d.priority, d.assigned_to::text,
+                COALESCE(d.resolution,'') AS resolution, COALESCE(d.notes,'') AS notes, d.buyer_refund, d.seller_payout,
+                (SELECT COUNT(*) FROM dispute_messages m WHERE m.dispute_id = d.id),
+                d.created_at, d.escalated_at, d.resolved_at, d.first_admin_response_at
+         FROM disputes d
+         WHERE `+strings.Join(where, " AND ")+`
+         ORDER BY d.created_at DESC`, args...,
     )
     if err != nil {
         return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not fetch disputes"})
     }
     defer rows.Close()
 
-    var items []AdminDispute
+    items := []AdminDispute{}
+    now := time.Now()
     for rows.Next() {
         var d AdminDispute
         var created time.Time
-        var resolved *time.Time
-        if err := rows.Scan(&d.ID, &d.OrderID, &d.FilerID, &d.Reason, &d.Status, &d.Resolution, &d.Notes, &created, &resolved); err != nil {
+        var escalated, resolved, responded *time.Time
+        if err := rows.Scan(&d.ID, &d.OrderID, &d.FilerID, &d.Reason, &d.Status, &d.Stage, &d.Priority, &d.AssignedTo,
+            &d.Resolution, &d.Notes, &d.BuyerRefund, &d.SellerPayout, &d.MessageCount,
+            &created, &escalated, &resolved, &responded); err != nil {
             return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to read dispute record"})
         }
         d.CreatedAt = created.UTC().Format(time.RFC3339)
-        if resolved != nil {
-            s := resolved.UTC().Format(time.RFC3339)
-            d.ResolvedAt = &s
-        }
+        d.EscalatedAt = formatTime(escalated)
+        d.ResolvedAt = formatTime(resolved)
+        d.SLA = computeSLA(now, d.Priority, d.Stage, created, escalated, responded, resolved)
         items = append(items, d)
     }
     return c.JSON(http.StatusOK, echo.Map{"disputes": items})
 }
 
+func formatTime(t *time.Time) *string {
+    if t == nil {
+        return nil
+    }
+    s := t.UTC().Format(time.RFC3339)
+    return &s
+}
+
 // POST /admin/disputes/:id/resolve
+// Resolves an open dispute and settles the order's escrow in the same
+// transaction: refund, release, or a split by refund_amount or refund_percent.
+// "none" closes the dispute without moving money.
 func ResolveDispute(c echo.Context) error {
     adminID, ok := c.Get("user_id").(string)
     if !ok || adminID == "" {
@@ -62,31 +137,118 @@ func ResolveDispute(c echo.Context) error {
         return c.JSON(http.StatusBadRequest, echo.Map{"error": "dispute id required"})
     }
     var req struct {
-        Resolution string `json:"resolution"` // refund|release|none
-        Notes      string `json:"notes"`
+        Resolution    string  `json:"resolution"` // refund|release|split|none
+        RefundAmount  int64   `json:"refund_amount"`
+        RefundPercent float64 `json:"refund_percent"`
+        Notes         string  `json:"notes"`
     }
     if err := c.Bind(&req); err != nil || req.Resolution == "" {
         return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid payload: resolution required"})
     }
-    if req.Resolution != "refund" && req.Resolution != "release" && req.Resolution != "none" {
+    switch req.Resolution {
+    case market.SettleRefund, market.SettleRelease, "none":
+    case market.SettleSplit:
+        if req.RefundAmount == 0 && req.RefundPercent == 0 {
+            return c.JSON(http.StatusBadRequest, echo.Map{"error": "split requires refund_amount or refund_percent"})
+        }
+    default:
         return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid resolution"})
     }
 
-    // Update dispute
-    var orderID, filerID string
-    err := db.Conn.QueryRow(context.Background(), `UPDATE disputes SET status = 'resolved', resolution = $1, notes = $2, resolved_by = $3, resolved_at = NOW() WHERE id = $4 RETURNING order_id::text, filer_id::text`, req.Resolution, req.Notes, adminID, id).Scan(&orderID, &filerID)
+    ctx := context.Background()
+    tx, err := db.Conn.Begin(ctx)
+    if err != nil {
+        return c.JSON(http.StatusInternalServerError, echo.Map{"error": "transaction start failed"})
+    }
+    defer tx.Rollback(ctx)
+
+    var orderID, status string
+    err = tx.QueryRow(ctx, `SELECT order_id::text, status FROM disputes WHERE id = $1 FOR UPDATE`, id).Scan(&orderID, &status)
+    if errors.Is(err, pgx.ErrNoRows) {
+        return c.JSON(http.StatusNotFound, echo.Map{"error": "dispute not found"})
+    }
+    if err != nil {
+        return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to fetch dispute"})
+    }
+    if status != "open" {
+        return c.JSON(http.StatusConflict, echo.Map{"error": "dispute is already resolved"})
+    }
+
+    var result *market.SettlementResult
+    if req.Resolution != "none" {
+        result, err = market.SettleOrder(ctx, tx, orderID, orders.ActorAdmin, adminID, market.Settlement{
+            Mode:          req.Resolution,
+            RefundAmount:  req.RefundAmount,
+            RefundPercent: req.RefundPercent,
+        })
+        switch {
+        case errors.Is(err, market.ErrNotSettleable):
+            return c.JSON(http.StatusConflict, echo.Map{"error": "order cannot be settled in its current status"})
+        case errors.Is(err, market.ErrInvalidSettlement):
+            return c.JSON(http.StatusBadRequest, echo.Map{"error": "split must refund between 0 and the order amount, exclusive"})
+        case errors.Is(err, ledger.ErrInsufficientFunds):
+            return c.JSON(http.StatusConflict, echo.Map{"error": "order escrow does not cover the order amount"})
+        case err != nil:
+            return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to settle order"})
+        }
+    }
+
+    var buyerRefund, sellerPayout *int64
+    if result != nil {
+        buyerRefund, sellerPayout = &result.BuyerRefund, &result.SellerNet
+    }
+    _, err = tx.Exec(ctx,
+        `UPDATE disputes SET status = 'resolved', resolution = $1, notes = $2, resolved_by = $3, resolved_at = NOW(),
+                buyer_refund = $4, seller_payout = $5
+         WHERE id = $6`,
+        req.Resolution, req.Notes, adminID, buyerRefund, sellerPayout, id,
+    )
     if err != nil {
         return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to resolve dispute"})
     }
+    // Any proposal still open in mediation is superseded by the admin decision
+    if _, err = tx.Exec(ctx, `UPDATE dispute_proposals SET status = 'expired', responded_at = NOW() WHERE dispute_id = $1 AND status = 'pending'`, id); err != nil {
+        return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to close proposals"})
+    }
+    if err = orders.LogEvent(ctx, tx, orderID, orders.ActorAdmin, adminID, "dispute_resolved", map[string]any{
+        "dispute_id": id,
+        "resolution": req.Resolution,
+    }); err != nil {
+        return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to resolve dispute"})
+    }
+    if err = tx.Commit(ctx); err != nil {
+        return c.JSON(http.StatusInternalServerError, echo.Map{"error": "commit failed"})
+    }
 
-    // Notify participants
+    // Notify participants with the breakdown
     var buyerID, sellerID string
-    _ = db.Conn.QueryRow(context.Background(), `SELECT buyer_id::text, seller_id::text FROM orders WHERE id = $1`, orderID).Scan(&buyerID, &sellerID)
+    _ = db.Conn.QueryRow(ctx, `SELECT buyer_id::text, seller_id::text FROM orders WHERE id = $1`, orderID).Scan(&buyerID, &sellerID)
     title := "Dispute resolved"
     meta := "{}"
+    buyerBody, sellerBody := req.Resolution+" - "+req.Notes, req.Resolution+" - "+req.Notes
+    if result != nil {
+        if b, err := json.Marshal(result); err == nil {
+            meta = string(b)
+        }
+        buyerBody = fmt.Sprintf("Resolution: %s. You were refunded %d of %d.", req.Resolution, result.BuyerRefund, result.OrderAmount)
+        sellerBody = fmt.Sprintf("Resolution: %s. You received %d (%d of %d, less %d platform fee).",
+            req.Resolution, result.SellerNet, result.SellerGross, result.OrderAmount, result.PlatformFee)
+        if req.Notes != "" {
+            buyerBody += " " + req.Notes
+            sellerBody += " " + req.Notes
+        }
+    }
+    if history, err := market.DisputeHistory(ctx, id); err == nil && history != "" {
+        buyerBody += "\n\nDispute history:\n" + history
+        sellerBody += "\n\nDispute history:\n" + history
+    }
     ref := id
-    _ = alerts.CreateNotification(buyerID, "dispute:resolved", title, req.Resolution+" - "+req.Notes, &ref, &meta)
-    _ = alerts.CreateNotification(sellerID, "dispute:resolved", title, req.Resolution+" - "+req.Notes, &ref, &meta)
+    _ = alerts.CreateNotification(buyerID, "dispute:resolved", title, buyerBody, &ref, &meta)
+    _ = alerts.CreateNotification(sellerID, "dispute:resolved", title, sellerBody, &ref, &meta)
 
-    return c.JSON(http.StatusOK, echo.Map{"message": "resolved", "dispute_id": id, "resolution": req.Resolution})
+    resp := echo.Map{"message": "resolved", "dispute_id": id, "resolution": req.Resolution}
+    if result != nil {
+        resp["settlement"] = result
+    }
+    return c.JSON(http.StatusOK, resp)
 }
@@ -0,0 +1,18 @@
+package admin
+
+import (
+    "context"
+    "net/http"
+
+    "github.com/labstack/echo/v4"
+    "github.com/sudo-init-do/crafthub/internal/reconcile"
+)
+
+// GET /admin/reconcile
+func Reconcile(c echo.Context) error {
+    report, err := reconcile.Run(context.Background())
+    if err != nil {
+        return c.JSON(http.StatusInternalServerError, echo.Map{"error": "reconciliation failed"})
+    }
+    return c.JSON(http.StatusOK, echo.Map{"clean": report.Clean(), "report": report})
+}
@@ -2,11 +2,13 @@ package admin
 
 import (
     "context"
+    "errors"
     "net/http"
     "time"
 
     "github.com/labstack/echo/v4"
     "github.com/sudo-init-do/crafthub/internal/db"
+    market "github.com/sudo-init-do/crafthub/internal/marketplace"
 )
 
 type AdminService struct {
@@ -23,7 +25,7 @@ type AdminService struct {
 // GET /admin/services
 func ListServices(c echo.Context) error {
     rows, err := db.Conn.Query(context.Background(),
-        `SELECT id, user_id, title, price, category, delivery_time_days, status, created_at
+        `SELECT id, user_id, title, price, COALESCE(category, ''), COALESCE(delivery_time_days, 0), COALESCE(status, 'active'), created_at
          FROM services ORDER BY created_at DESC`,
     )
     if err != nil {
@@ -50,7 +52,20 @@ func SuspendService(c echo.Context) error {
     if id == "" {
         return c.JSON(http.StatusBadRequest, echo.Map{"error": "service id required"})
     }
-    _, err := db.Conn.Exec(context.Background(), `UPDATE services SET status = 'suspended' WHERE id = $1`, id)
+    adminID, _ := c.Get("user_id").(string)
+    ctx := context.Background()
+    tx, err := db.Conn.Begin(ctx)
+    if err != nil {
+        return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to suspend service"})
+    }
+    defer tx.Rollback(ctx)
+    err = market.SetServiceStatus(ctx, tx, id, market.ServiceSuspended, adminID, "suspended by admin")
+    if errors.Is(err, market.ErrServiceNotFound) {
+        return c.JSON(http.StatusNotFound, echo.Map{"error": "service not found"})
+    }
+    if err == nil {
+        err = tx.Commit(ctx)
+    }
     if err != nil {
         return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to suspend service"})
     }
@@ -63,7 +78,20 @@ func ApproveService(c echo.Context) error {
     if id == "" {
         return c.JSON(http.StatusBadRequest, echo.Map{"error": "service id required"})
     }
-    _, err := db.Conn.Exec(context.Background(), `UPDATE services SET status = 'active' WHERE id = $1`, id)
+    adminID, _ := c.Get("user_id").(string)
+    ctx := context.Background()
+    tx, err := db.Conn.Begin(ctx)
+    if err != nil {
+        return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to approve service"})
+    }
+    defer tx.Rollback(ctx)
+    err = market.SetServiceStatus(ctx, tx, id, market.ServiceActive, adminID, "approved by admin")
+    if errors.Is(err, market.ErrServiceNotFound) {
+        return c.JSON(http.StatusNotFound, echo.Map{"error": "service not found"})
+    }
+    if err == nil {
+        err = tx.Commit(ctx)
+    }
     if err != nil {
         return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to approve service"})
     }
@@ -18,6 +18,16 @@ func ensureClient() *asynq.Client {
 	return client
 }
 
+// EnqueueTask schedules a task with a JSON payload (used by other packages' workers)
+func EnqueueTask(taskType string, payload any, opts ...asynq.Option) error {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	_, err = ensureClient().Enqueue(asynq.NewTask(taskType, b), opts...)
+	return err
+}
+
 // EnqueueWelcomeEmail schedules a welcome email to the user
 func EnqueueWelcomeEmail(userID, email, name string) error {
 	base := os.Getenv("APP_URL")
@@ -151,3 +161,69 @@ func EnqueueMessageNew(orderID, senderID, recipientEmail, recipientID, body stri
 	_, err := ensureClient().Enqueue(task, asynq.Queue("emails"))
 	return err
 }
+
+// EnqueueWithdrawalStatus notifies the user that their withdrawal changed state
+func EnqueueWithdrawalStatus(withdrawalID, userID, email, subject, body, status string, amount float64) error {
+	env := EmailEnvelope{To: email, Subject: subject, Body: body}
+	payload := WithdrawalStatusPayload{WithdrawalID: withdrawalID, UserID: userID, Email: email, Status: status, Amount: amount, Envelope: env, SentAt: time.Now()}
+	b, _ := json.Marshal(payload)
+	task := asynq.NewTask(TaskWithdrawalStatus, b)
+	_, err := ensureClient().Enqueue(task, asynq.Queue("emails"))
+	return err
+}
+
+// EnqueueOrderReleaseReminder reminds the buyer that a delivered order will complete automatically
+func EnqueueOrderReleaseReminder(orderID, buyerID, sellerID, buyerEmail string, releaseAt time.Time) error {
+	env := EmailEnvelope{
+		To:      buyerEmail,
+		Subject: "Your order will complete automatically soon",
+		Body:    fmt.Sprintf("Order %s was delivered. Unless you complete it or open a dispute, it will complete automatically on %s and the seller will be paid.", orderID, releaseAt.UTC().Format("Jan 2, 2006 15:04 UTC")),
+	}
+	payload := OrderReleaseReminderPayload{OrderID: orderID, BuyerID: buyerID, SellerID: sellerID, Email: buyerEmail, ReleaseAt: releaseAt, Envelope: env, SentAt: time.Now()}
+	b, _ := json.Marshal(payload)
+	task := asynq.NewTask(TaskOrderReleaseReminder, b)
+	_, err := ensureClient().Enqueue(task, asynq.Queue("emails"))
+	return err
+}
+
+// EnqueueOrderExpired tells a party that the order was cancelled because the
+// seller did not accept it in time. Uses the order cancelled payload.
+func EnqueueOrderExpired(orderID, buyerID, sellerID, email string, amount float64, toBuyer bool) error {
+	env := EmailEnvelope{
+		To:      email,
+		Subject: "Order expired before acceptance",
+		Body:    fmt.Sprintf("Order %s was not accepted in time and has been cancelled automatically. No action is needed.", orderID),
+	}
+	if toBuyer {
+		env.Body = fmt.Sprintf("The seller did not accept order %s in time, so it was cancelled automatically. Amount %.2f has been returned to your wallet.", orderID, amount)
+	}
+	payload := OrderCancelledPayload{OrderID: orderID, BuyerID: buyerID, SellerID: sellerID, Email: email, Amount: amount, Envelope: env, SentAt: time.Now()}
+	b, _ := json.Marshal(payload)
+	task := asynq.NewTask(TaskOrderExpired, b)
+	_, err := ensureClient().Enqueue(task, asynq.Queue("emails"))
+	return err
+}
+
+// EnqueueOrderDeadline warns the seller that an order is nearly due, or tells
+// a party that it is overdue. Overdue buyers may cancel for a full refund.
+func EnqueueOrderDeadline(orderID, buyerID, sellerID, email string, dueAt time.Time, overdue, toBuyer bool) error {
+	due := dueAt.UTC().Format("Jan 2, 2006 15:04 UTC")
+	env := EmailEnvelope{
+		To:      email,
+		Subject: "Order delivery due soon",
+		Body:    fmt.Sprintf("Order %s is due for delivery by %s.", orderID, due),
+	}
+	switch {
+	case overdue && toBuyer:
+		env.Subject = "Your order is overdue"
+		env.Body = fmt.Sprintf("Order %s was due by %s and has not been delivered. You can keep waiting, agree an extension with the seller, or cancel for a full refund.", orderID, due)
+	case overdue:
+		env.Subject = "Order overdue"
+		env.Body = fmt.Sprintf("Order %s was due by %s. The buyer can now cancel it for a full refund. Deliver as soon as possible or request an extension.", orderID, due)
+	}
+	payload := OrderDeadlinePayload{OrderID: orderID, BuyerID: buyerID, SellerID: sellerID, Email: email, DueAt: dueAt, Overdue: overdue, Envelope: env, SentAt: time.Now()}
+	b, _ := json.Marshal(payload)
+	task := asynq.NewTask(TaskOrderDeadline, b)
+	_, err := ensureClient().Enqueue(task, asynq.Queue("emails"))
+	return err
+}
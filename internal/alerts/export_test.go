@@ -0,0 +1,30 @@
+package alerts
+
+import "github.com/hibiken/asynq"
+
+// queueOf is the queue a task with opts is enqueued on; the last Queue
+// option wins, as in asynq
+func queueOf(opts []asynq.Option) string {
+	queue := "default"
+	for _, opt := range opts {
+		if opt.Type() == asynq.QueueOpt {
+			queue = opt.Value().(string)
+		}
+	}
+	return queue
+}
+
+// ScheduledQueues maps each scheduled task type to the queue it runs on
+func ScheduledQueues() map[string]string {
+	m := map[string]string{}
+	for _, p := range periodic {
+		m[p.taskType] = queueOf(p.opts)
+	}
+	return m
+}
+
+// Consumed reports whether the server processes queue
+func Consumed(queue string) bool {
+	_, ok := queues[queue]
+	return ok
+}
@@ -5,15 +5,59 @@ import (
 	"encoding/json"
 	"log"
 	"os"
+	"sync"
+	"time"
 
 	"github.com/hibiken/asynq"
 )
 
 var (
-	client *asynq.Client
-	server *asynq.Server
+	client    *asynq.Client
+	server    *asynq.Server
+	scheduler *asynq.Scheduler
+	// mux is shared so other packages can register their task handlers
+	mux          = asynq.NewServeMux()
+	registerOnce sync.Once
 )
 
+// HandleFunc registers a task handler for a task type outside this package
+func HandleFunc(taskType string, handler func(context.Context, *asynq.Task) error) {
+	mux.HandleFunc(taskType, handler)
+}
+
+type periodicTask struct {
+	spec     string
+	taskType string
+	opts     []asynq.Option
+}
+
+var periodic []periodicTask
+
+// queues are the queues the server consumes, with their priorities. A task
+// enqueued anywhere else is never processed.
+var queues = map[string]int{
+	"emails":  10,
+	"payouts": 8,
+	"alerts":  5,
+}
+
+// Schedule enqueues a task (with an empty payload) every interval. Runs are
+// unique for the interval so several API instances do not enqueue the same
+// run twice. Tasks go to the alerts queue unless opts name another. Call
+// before Init.
+func Schedule(every time.Duration, taskType string, opts ...asynq.Option) {
+	opts = append([]asynq.Option{asynq.Queue("alerts"), asynq.Unique(every)}, opts...)
+	periodic = append(periodic, periodicTask{spec: "@every " + every.String(), taskType: taskType, opts: opts})
+}
+
+// ScheduleCron enqueues a task (with an empty payload) on a cron spec, e.g.
+// "0 2 1 * *". Pass asynq.Unique to dedupe across instances. Tasks go to the
+// alerts queue unless opts name another. Call before Init.
+func ScheduleCron(spec, taskType string, opts ...asynq.Option) {
+	opts = append([]asynq.Option{asynq.Queue("alerts")}, opts...)
+	periodic = append(periodic, periodicTask{spec: spec, taskType: taskType, opts: opts})
+}
+
 // Init starts the Asynq server and initializes a shared client.
 func Init() {
 	redisAddr := os.Getenv("REDIS_ADDR")
@@ -37,23 +81,25 @@ func Init() {
 	opts := asynq.RedisClientOpt{Addr: redisAddr}
 	client = asynq.NewClient(opts)
 
-	mux := asynq.NewServeMux()
-	mux.HandleFunc(TaskWelcomeEmail, handleWelcomeEmail)
-	mux.HandleFunc(TaskBookingConfirmation, handleBookingConfirmation)
-	mux.HandleFunc(TaskAdminAlert, handleAdminAlert)
-	mux.HandleFunc(TaskPasswordReset, handlePasswordReset)
-	mux.HandleFunc(TaskOrderCancelled, handleOrderCancelled)
-	mux.HandleFunc(TaskOrderDeclined, handleOrderDeclined)
-	mux.HandleFunc(TaskOrderDelivered, handleOrderDelivered)
-    mux.HandleFunc(TaskOrderCompleted, handleOrderCompleted)
-    mux.HandleFunc(TaskMessageNew, handleMessageNew)
+	registerOnce.Do(func() {
+		mux.HandleFunc(TaskWelcomeEmail, handleWelcomeEmail)
+		mux.HandleFunc(TaskBookingConfirmation, handleBookingConfirmation)
+		mux.HandleFunc(TaskAdminAlert, handleAdminAlert)
+		mux.HandleFunc(TaskPasswordReset, handlePasswordReset)
+		mux.HandleFunc(TaskOrderCancelled, handleOrderCancelled)
+		mux.HandleFunc(TaskOrderDeclined, handleOrderDeclined)
+		mux.HandleFunc(TaskOrderDelivered, handleOrderDelivered)
+		mux.HandleFunc(TaskOrderCompleted, handleOrderCompleted)
+		mux.HandleFunc(TaskMessageNew, handleMessageNew)
+		mux.HandleFunc(TaskWithdrawalStatus, handleWithdrawalStatus)
+		mux.HandleFunc(TaskOrderReleaseReminder, handleOrderReleaseReminder)
+		mux.HandleFunc(TaskOrderExpired, handleOrderCancelled)
+		mux.HandleFunc(TaskOrderDeadline, handleOrderDeadline)
+	})
 
 	server = asynq.NewServer(opts, asynq.Config{
 		Concurrency: 5,
-		Queues: map[string]int{
-			"emails": 10,
-			"alerts": 5,
-		},
+		Queues:      queues,
 	})
 	go func() {
 		if err := server.Run(mux); err != nil {
@@ -61,6 +107,20 @@ func Init() {
 		}
 	}()
 
+	if len(periodic) > 0 && scheduler == nil {
+		scheduler = asynq.NewScheduler(opts, nil)
+		for _, p := range periodic {
+			if _, err := scheduler.Register(p.spec, asynq.NewTask(p.taskType, nil), p.opts...); err != nil {
+				log.Printf("failed to schedule %s (%s): %v", p.taskType, p.spec, err)
+			}
+		}
+		go func() {
+			if err := scheduler.Run(); err != nil {
+				log.Printf("Asynq scheduler stopped: %v", err)
+			}
+		}()
+	}
+
 	log.Printf("Asynq initialized (addr=%s)", redisAddr)
 }
 
@@ -69,6 +129,9 @@ func Close() {
 	if client != nil {
 		_ = client.Close()
 	}
+	if scheduler != nil {
+		scheduler.Shutdown()
+	}
 	if server != nil {
 		server.Shutdown()
 	}
@@ -187,3 +250,39 @@ func handleMessageNew(_ context.Context, t *asynq.Task) error {
     log.Printf("[notify] MessageNew sent -> order=%s to=%s", p.OrderID, p.Email)
     return nil
 }
+
+func handleWithdrawalStatus(_ context.Context, t *asynq.Task) error {
+    var p WithdrawalStatusPayload
+    if err := json.Unmarshal(t.Payload(), &p); err != nil {
+        return err
+    }
+    if err := SendEmail(p.Email, p.Envelope.Subject, p.Envelope.Body); err != nil {
+        return err
+    }
+    log.Printf("[notify] WithdrawalStatus sent -> withdrawal=%s status=%s to=%s", p.WithdrawalID, p.Status, p.Email)
+    return nil
+}
+
+func handleOrderDeadline(_ context.Context, t *asynq.Task) error {
+    var p OrderDeadlinePayload
+    if err := json.Unmarshal(t.Payload(), &p); err != nil {
+        return err
+    }
+    if err := SendEmail(p.Email, p.Envelope.Subject, p.Envelope.Body); err != nil {
+        return err
+    }
+    log.Printf("[notify] OrderDeadline sent -> order=%s overdue=%t to=%s", p.OrderID, p.Overdue, p.Email)
+    return nil
+}
+
+func handleOrderReleaseReminder(_ context.Context, t *asynq.Task) error {
+    var p OrderReleaseReminderPayload
+    if err := json.Unmarshal(t.Payload(), &p); err != nil {
+        return err
+    }
+    if err := SendEmail(p.Email, p.Envelope.Subject, p.Envelope.Body); err != nil {
+        return err
+    }
+    log.Printf("[notify] OrderReleaseReminder sent -> order=%s to=%s", p.OrderID, p.Email)
+    return nil
+}
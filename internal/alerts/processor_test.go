@@ -0,0 +1,29 @@
+package alerts
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hibiken/asynq"
+)
+
+func TestScheduleQueue(t *testing.T) {
+	saved := periodic
+	periodic = nil
+	defer func() { periodic = saved }()
+
+	Schedule(time.Minute, "test:every")
+	ScheduleCron("0 * * * *", "test:cron", asynq.Unique(time.Hour))
+	Schedule(time.Minute, "test:payouts", asynq.Queue("payouts"))
+
+	want := map[string]string{"test:every": "alerts", "test:cron": "alerts", "test:payouts": "payouts"}
+	got := ScheduledQueues()
+	for task, queue := range want {
+		if got[task] != queue {
+			t.Errorf("%s runs on %q, want %q", task, got[task], queue)
+		}
+		if !Consumed(got[task]) {
+			t.Errorf("%s runs on %q, which the server does not consume", task, got[task])
+		}
+	}
+}
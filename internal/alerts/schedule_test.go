@@ -0,0 +1,34 @@
+package alerts_test
+
+import (
+	"testing"
+
+	"github.com/sudo-init-do/crafthub/internal/alerts"
+	"github.com/sudo-init-do/crafthub/internal/marketplace"
+	"github.com/sudo-init-do/crafthub/internal/wallet"
+)
+
+// Every periodic job registered by the packages the servers import must run
+// on a queue the server consumes
+func TestScheduledJobsAreConsumed(t *testing.T) {
+	want := map[string]string{
+		marketplace.TaskAutoReleaseOrders: "alerts",
+		marketplace.TaskExpireOrders:      "alerts",
+		marketplace.TaskEscalateDisputes:  "alerts",
+		marketplace.TaskOrderDeadlines:    "alerts",
+		wallet.TaskExpireTopups:           "alerts",
+		wallet.TaskPayoutSweep:            "payouts",
+		wallet.TaskMonthlyStatements:      "emails",
+	}
+	got := alerts.ScheduledQueues()
+	for task, queue := range want {
+		if got[task] != queue {
+			t.Errorf("%s runs on %q, want %q", task, got[task], queue)
+		}
+	}
+	for task, queue := range got {
+		if !alerts.Consumed(queue) {
+			t.Errorf("%s runs on %q, which the server does not consume", task, queue)
+		}
+	}
+}
@@ -13,6 +13,10 @@ const (
     TaskOrderDelivered      = "email:order_delivered"
     TaskOrderCompleted      = "email:order_completed"
     TaskMessageNew          = "email:message_new"
+    TaskWithdrawalStatus    = "email:withdrawal_status"
+    TaskOrderReleaseReminder = "email:order_release_reminder"
+    TaskOrderExpired         = "email:order_expired"
+    TaskOrderDeadline        = "email:order_deadline"
 )
 
 // Common envelope for email-like notifications
@@ -114,3 +118,37 @@ type MessageNewPayload struct {
     Envelope  EmailEnvelope `json:"envelope"`
     SentAt    time.Time     `json:"sent_at"`
 }
+
+// Withdrawal status payload (sent to the user on every state change)
+type WithdrawalStatusPayload struct {
+    WithdrawalID string        `json:"withdrawal_id"`
+    UserID       string        `json:"user_id"`
+    Email        string        `json:"email"`
+    Status       string        `json:"status"`
+    Amount       float64       `json:"amount"`
+    Envelope     EmailEnvelope `json:"envelope"`
+    SentAt       time.Time     `json:"sent_at"`
+}
+
+// Order deadline approaching or passed (sent to buyer or seller)
+type OrderDeadlinePayload struct {
+    OrderID  string        `json:"order_id"`
+    BuyerID  string        `json:"buyer_id"`
+    SellerID string        `json:"seller_id"`
+    Email    string        `json:"email"`
+    DueAt    time.Time     `json:"due_at"`
+    Overdue  bool          `json:"overdue"`
+    Envelope EmailEnvelope `json:"envelope"`
+    SentAt   time.Time     `json:"sent_at"`
+}
+
+// Order release reminder payload (sent to buyer before auto-completion)
+type OrderReleaseReminderPayload struct {
+    OrderID   string        `json:"order_id"`
+    BuyerID   string        `json:"buyer_id"`
+    SellerID  string        `json:"seller_id"`
+    Email     string        `json:"email"`
+    ReleaseAt time.Time     `json:"release_at"`
+    Envelope  EmailEnvelope `json:"envelope"`
+    SentAt    time.Time     `json:"sent_at"`
+}
@@ -51,6 +51,66 @@ func Init() {
 
     // Ensure disputes table exists for dispute management
     ensureDisputesTable()
+
+    // Ensure double-entry ledger tables exist for wallet movements
+    ensureLedgerTables()
+
+    // Ensure idempotency key storage exists for money-moving endpoints
+    ensureIdempotencyTable()
+
+    // Ensure topups columns and statuses used by payment providers exist
+    ensureTopupsSchema()
+
+    // Ensure withdrawals review columns and statuses exist
+    ensureWithdrawalsSchema()
+
+    // Ensure payout methods and withdrawal payout tracking exist
+    ensurePayoutSchema()
+
+    // Ensure fee schedules and the order fee breakdown columns exist
+    ensureFeeSchema()
+
+    // Ensure delivery timestamps and the order event log exist
+    ensureOrderEventsSchema()
+
+    // Ensure tips table exists
+    ensureTipsSchema()
+
+    // Ensure settlement columns for dispute resolutions
+    ensureSettlementSchema()
+
+    // Ensure dispute mediation columns and proposals table exist
+    ensureMediationSchema()
+
+    // Ensure dispute threads and admin assignment exist
+    ensureDisputeThreadSchema()
+
+    // Ensure orders carry a version for concurrent transitions
+    ensureOrderVersionColumn()
+
+    // Ensure revision terms and versioned deliveries exist
+    ensureRevisionSchema()
+
+    // Ensure delivery deadlines and extensions exist
+    ensureDeadlineSchema()
+
+    // Ensure service packages and extras exist
+    ensurePackageSchema()
+
+    // Ensure custom offers exist
+    ensureCustomOfferSchema()
+
+    // Ensure service requirements and order answers exist
+    ensureRequirementsSchema()
+
+    // Ensure uploaded file records exist
+    ensureFilesTable()
+
+    // Ensure service versions and order service snapshots exist
+    ensureServiceVersionSchema()
+
+    // Ensure full-text search and rating aggregates for discovery exist
+    ensureServiceSearchSchema()
 }
 
 // ensureIsActiveColumn adds users.is_active if missing
@@ -246,3 +306,588 @@ func ensureDisputesTable() {
         log.Printf("failed to create disputes table: %v", err)
     }
 }
+
+// ensureLedgerTables creates the ledger accounts, entries and postings tables if not present
+func ensureLedgerTables() {
+    ctx := context.Background()
+    var exists bool
+    _ = Conn.QueryRow(ctx, `
+        SELECT EXISTS (
+            SELECT 1 FROM information_schema.tables
+            WHERE table_schema = 'public' AND table_name = 'ledger_postings'
+        )`).Scan(&exists)
+    if exists { return }
+    _, err := Conn.Exec(ctx, `
+        CREATE TABLE IF NOT EXISTS ledger_accounts (
+            id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+            code TEXT NOT NULL UNIQUE,
+            kind TEXT NOT NULL CHECK (kind IN ('user_available','user_held','order_escrow','platform_revenue','external_clearing')),
+            owner_id UUID NULL,
+            created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+        );
+        CREATE INDEX IF NOT EXISTS idx_ledger_accounts_owner ON ledger_accounts(owner_id);
+        CREATE TABLE IF NOT EXISTS ledger_entries (
+            id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+            kind TEXT NOT NULL,
+            reference UUID NULL,
+            memo TEXT NULL,
+            created_by UUID NULL REFERENCES users(id) ON DELETE SET NULL,
+            created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+        );
+        CREATE INDEX IF NOT EXISTS idx_ledger_entries_reference ON ledger_entries(reference);
+        CREATE INDEX IF NOT EXISTS idx_ledger_entries_created_at ON ledger_entries(created_at);
+        CREATE TABLE IF NOT EXISTS ledger_postings (
+            id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+            entry_id UUID NOT NULL REFERENCES ledger_entries(id) ON DELETE RESTRICT,
+            account_id UUID NOT NULL REFERENCES ledger_accounts(id) ON DELETE RESTRICT,
+            amount BIGINT NOT NULL CHECK (amount <> 0)
+        );
+        CREATE INDEX IF NOT EXISTS idx_ledger_postings_account ON ledger_postings(account_id);
+        CREATE INDEX IF NOT EXISTS idx_ledger_postings_entry ON ledger_postings(entry_id);
+    `)
+    if err != nil {
+        log.Printf("failed to create ledger tables: %v", err)
+    }
+}
+
+// ensureIdempotencyTable creates idempotency_keys if not present
+func ensureIdempotencyTable() {
+    ctx := context.Background()
+    _, err := Conn.Exec(ctx, `
+        CREATE TABLE IF NOT EXISTS idempotency_keys (
+            user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+            key TEXT NOT NULL,
+            fingerprint TEXT NOT NULL,
+            method TEXT NOT NULL,
+            path TEXT NOT NULL,
+            status_code INTEGER NULL,
+            content_type TEXT NULL,
+            response_body BYTEA NULL,
+            created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+            completed_at TIMESTAMP WITH TIME ZONE NULL,
+            PRIMARY KEY (user_id, key)
+        );
+        CREATE INDEX IF NOT EXISTS idx_idempotency_keys_created_at ON idempotency_keys(created_at);
+    `)
+    if err != nil {
+        log.Printf("failed to create idempotency_keys table: %v", err)
+    }
+}
+
+// ensureTopupsSchema adds provider columns and the pending/completed/failed/expired status set
+func ensureTopupsSchema() {
+    ctx := context.Background()
+    _, err := Conn.Exec(ctx, `
+        ALTER TABLE topups ADD COLUMN IF NOT EXISTS provider TEXT;
+        ALTER TABLE topups ADD COLUMN IF NOT EXISTS provider_ref TEXT;
+        ALTER TABLE topups ADD COLUMN IF NOT EXISTS failure_reason TEXT;
+        ALTER TABLE topups ADD COLUMN IF NOT EXISTS expires_at TIMESTAMP WITH TIME ZONE;
+        ALTER TABLE topups ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP;
+        ALTER TABLE topups DROP CONSTRAINT IF EXISTS topups_status_check;
+        ALTER TABLE topups ADD CONSTRAINT topups_status_check CHECK (status IN ('pending','completed','failed','expired'));
+        CREATE UNIQUE INDEX IF NOT EXISTS idx_topups_provider_ref ON topups(provider, provider_ref) WHERE provider_ref IS NOT NULL;
+        CREATE INDEX IF NOT EXISTS idx_topups_pending_expiry ON topups(expires_at) WHERE status = 'pending';
+    `)
+    if err != nil {
+        log.Printf("failed to ensure topups schema: %v", err)
+    }
+}
+
+// ensureWithdrawalsSchema adds review columns and the admin approval status set
+func ensureWithdrawalsSchema() {
+    ctx := context.Background()
+    _, err := Conn.Exec(ctx, `
+        ALTER TABLE withdrawals ADD COLUMN IF NOT EXISTS approved_by UUID NULL;
+        ALTER TABLE withdrawals ADD COLUMN IF NOT EXISTS approved_at TIMESTAMP NULL;
+        ALTER TABLE withdrawals ADD COLUMN IF NOT EXISTS rejected_by UUID NULL;
+        ALTER TABLE withdrawals ADD COLUMN IF NOT EXISTS rejected_at TIMESTAMP NULL;
+        ALTER TABLE withdrawals ADD COLUMN IF NOT EXISTS reason TEXT NULL;
+        ALTER TABLE withdrawals ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP;
+        ALTER TABLE withdrawals DROP CONSTRAINT IF EXISTS withdrawals_status_check;
+        ALTER TABLE withdrawals ADD CONSTRAINT withdrawals_status_check
+            CHECK (status IN ('pending','approved','rejected','completed','failed','canceled'));
+        CREATE INDEX IF NOT EXISTS idx_withdrawals_status ON withdrawals(status, created_at);
+    `)
+    if err != nil {
+        log.Printf("failed to ensure withdrawals schema: %v", err)
+    }
+}
+
+// ensurePayoutSchema creates payout_methods and the withdrawal payout columns
+func ensurePayoutSchema() {
+    ctx := context.Background()
+    _, err := Conn.Exec(ctx, `
+        CREATE TABLE IF NOT EXISTS payout_methods (
+            id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+            user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+            type TEXT NOT NULL CHECK (type IN ('bank_account','mobile_money')),
+            display TEXT NOT NULL,
+            details JSONB NOT NULL,
+            is_default BOOLEAN NOT NULL DEFAULT FALSE,
+            created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+            deleted_at TIMESTAMP WITH TIME ZONE NULL
+        );
+        CREATE INDEX IF NOT EXISTS idx_payout_methods_user ON payout_methods(user_id) WHERE deleted_at IS NULL;
+        CREATE UNIQUE INDEX IF NOT EXISTS idx_payout_methods_default ON payout_methods(user_id) WHERE is_default AND deleted_at IS NULL;
+        ALTER TABLE withdrawals ADD COLUMN IF NOT EXISTS payout_method_id UUID NULL REFERENCES payout_methods(id);
+        ALTER TABLE withdrawals ADD COLUMN IF NOT EXISTS payout_provider TEXT NULL;
+        ALTER TABLE withdrawals ADD COLUMN IF NOT EXISTS payout_reference TEXT NULL;
+        ALTER TABLE withdrawals ADD COLUMN IF NOT EXISTS payout_status TEXT NULL
+            CHECK (payout_status IN ('queued','retrying','processing','paid','failed'));
+        ALTER TABLE withdrawals ADD COLUMN IF NOT EXISTS payout_attempts INTEGER NOT NULL DEFAULT 0;
+        ALTER TABLE withdrawals ADD COLUMN IF NOT EXISTS payout_error TEXT NULL;
+        ALTER TABLE withdrawals ADD COLUMN IF NOT EXISTS paid_at TIMESTAMP WITH TIME ZONE NULL;
+        CREATE UNIQUE INDEX IF NOT EXISTS idx_withdrawals_payout_reference ON withdrawals(payout_provider, payout_reference) WHERE payout_reference IS NOT NULL;
+    `)
+    if err != nil {
+        log.Printf("failed to ensure payout schema: %v", err)
+    }
+}
+
+// ensureFeeSchema creates fee_schedules and the orders fee columns
+func ensureFeeSchema() {
+    ctx := context.Background()
+    _, err := Conn.Exec(ctx, `
+        CREATE TABLE IF NOT EXISTS fee_schedules (
+            id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+            name TEXT NOT NULL,
+            category TEXT NULL,
+            seller_role TEXT NULL CHECK (seller_role IN ('fan','creator')),
+            percent_bps INTEGER NOT NULL DEFAULT 0 CHECK (percent_bps BETWEEN 0 AND 10000),
+            fixed_amount BIGINT NOT NULL DEFAULT 0 CHECK (fixed_amount >= 0),
+            starts_at TIMESTAMP WITH TIME ZONE NULL,
+            ends_at TIMESTAMP WITH TIME ZONE NULL,
+            is_active BOOLEAN NOT NULL DEFAULT TRUE,
+            created_by UUID NULL REFERENCES users(id) ON DELETE SET NULL,
+            created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+            updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+        );
+        CREATE INDEX IF NOT EXISTS idx_fee_schedules_active ON fee_schedules(is_active, category, seller_role);
+        ALTER TABLE orders ADD COLUMN IF NOT EXISTS platform_fee BIGINT NOT NULL DEFAULT 0;
+        ALTER TABLE orders ADD COLUMN IF NOT EXISTS fee_schedule_id UUID NULL REFERENCES fee_schedules(id) ON DELETE SET NULL;
+        ALTER TABLE orders ADD COLUMN IF NOT EXISTS fee_percent_bps INTEGER NOT NULL DEFAULT 0;
+        ALTER TABLE orders ADD COLUMN IF NOT EXISTS fee_fixed BIGINT NOT NULL DEFAULT 0;
+    `)
+    if err != nil {
+        log.Printf("failed to ensure fee schema: %v", err)
+    }
+}
+
+// ensureOrderEventsSchema adds delivery timestamps and creates order_events
+func ensureOrderEventsSchema() {
+    ctx := context.Background()
+    _, err := Conn.Exec(ctx, `
+        ALTER TABLE orders ADD COLUMN IF NOT EXISTS delivered_at TIMESTAMP WITH TIME ZONE NULL;
+        ALTER TABLE orders ADD COLUMN IF NOT EXISTS release_reminder_sent_at TIMESTAMP WITH TIME ZONE NULL;
+        CREATE INDEX IF NOT EXISTS idx_orders_delivered ON orders(delivered_at) WHERE status = 'delivered';
+        CREATE TABLE IF NOT EXISTS order_events (
+            id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+            order_id UUID NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+            actor_type TEXT NOT NULL CHECK (actor_type IN ('buyer','seller','admin','system')),
+            actor_id UUID NULL REFERENCES users(id) ON DELETE SET NULL,
+            action TEXT NOT NULL,
+            details JSONB NOT NULL DEFAULT '{}'::jsonb,
+            created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+        );
+        CREATE INDEX IF NOT EXISTS idx_order_events_order ON order_events(order_id, created_at);
+    `)
+    if err != nil {
+        log.Printf("failed to ensure order events schema: %v", err)
+    }
+}
+
+// ensureTipsSchema creates the tips table
+func ensureTipsSchema() {
+    ctx := context.Background()
+    _, err := Conn.Exec(ctx, `
+        CREATE TABLE IF NOT EXISTS tips (
+            id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+            sender_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+            recipient_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+            order_id UUID NULL REFERENCES orders(id) ON DELETE SET NULL,
+            amount BIGINT NOT NULL CHECK (amount > 0),
+            message TEXT NULL CHECK (char_length(message) <= 280),
+            anonymous BOOLEAN NOT NULL DEFAULT FALSE,
+            created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+            CHECK (sender_id <> recipient_id)
+        );
+
+        CREATE INDEX IF NOT EXISTS idx_tips_recipient ON tips(recipient_id, created_at DESC);
+        CREATE INDEX IF NOT EXISTS idx_tips_sender ON tips(sender_id, created_at DESC);
+    `)
+    if err != nil {
+        log.Printf("failed to ensure tips schema: %v", err)
+    }
+}
+
+// ensureSettlementSchema adds partial refund tracking and the split resolution
+func ensureSettlementSchema() {
+    ctx := context.Background()
+    _, err := Conn.Exec(ctx, `
+        ALTER TABLE orders ADD COLUMN IF NOT EXISTS refunded_amount BIGINT NOT NULL DEFAULT 0;
+
+        ALTER TABLE disputes ADD COLUMN IF NOT EXISTS buyer_refund BIGINT NULL;
+        ALTER TABLE disputes ADD COLUMN IF NOT EXISTS seller_payout BIGINT NULL;
+
+        ALTER TABLE disputes DROP CONSTRAINT IF EXISTS disputes_resolution_check;
+        ALTER TABLE disputes DROP CONSTRAINT IF EXISTS disputes_resolution_allowed;
+        ALTER TABLE disputes
+            ADD CONSTRAINT disputes_resolution_allowed
+                CHECK (resolution IN ('refund','release','split','none'));
+    `)
+    if err != nil {
+        log.Printf("failed to ensure settlement schema: %v", err)
+    }
+}
+
+// ensureMediationSchema adds dispute stages and settlement proposals
+func ensureMediationSchema() {
+    ctx := context.Background()
+    _, err := Conn.Exec(ctx, `
+        ALTER TABLE disputes ADD COLUMN IF NOT EXISTS stage TEXT NOT NULL DEFAULT 'escalated';
+        ALTER TABLE disputes ALTER COLUMN stage SET DEFAULT 'mediation';
+        ALTER TABLE disputes DROP CONSTRAINT IF EXISTS disputes_stage_allowed;
+        ALTER TABLE disputes
+            ADD CONSTRAINT disputes_stage_allowed CHECK (stage IN ('mediation','escalated'));
+        ALTER TABLE disputes ADD COLUMN IF NOT EXISTS mediation_deadline TIMESTAMP WITH TIME ZONE NULL;
+        ALTER TABLE disputes ADD COLUMN IF NOT EXISTS escalated_at TIMESTAMP WITH TIME ZONE NULL;
+        ALTER TABLE disputes ADD COLUMN IF NOT EXISTS escalation_reason TEXT NULL;
+
+        CREATE TABLE IF NOT EXISTS dispute_proposals (
+            id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+            dispute_id UUID NOT NULL REFERENCES disputes(id) ON DELETE CASCADE,
+            proposer_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+            refund_amount BIGINT NOT NULL CHECK (refund_amount >= 0),
+            note TEXT NULL,
+            status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending','accepted','rejected','countered','expired')),
+            created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+            responded_at TIMESTAMP WITH TIME ZONE NULL
+        );
+
+        CREATE INDEX IF NOT EXISTS idx_dispute_proposals_dispute ON dispute_proposals(dispute_id, created_at);
+        CREATE UNIQUE INDEX IF NOT EXISTS idx_dispute_proposals_one_pending ON dispute_proposals(dispute_id) WHERE status = 'pending';
+        CREATE INDEX IF NOT EXISTS idx_disputes_mediation ON disputes(mediation_deadline) WHERE status = 'open' AND stage = 'mediation';
+    `)
+    if err != nil {
+        log.Printf("failed to ensure mediation schema: %v", err)
+    }
+}
+
+// ensureDisputeThreadSchema adds dispute messages, assignment and priority
+func ensureDisputeThreadSchema() {
+    ctx := context.Background()
+    _, err := Conn.Exec(ctx, `
+        ALTER TABLE disputes ADD COLUMN IF NOT EXISTS priority TEXT NOT NULL DEFAULT 'normal';
+        ALTER TABLE disputes DROP CONSTRAINT IF EXISTS disputes_priority_allowed;
+        ALTER TABLE disputes
+            ADD CONSTRAINT disputes_priority_allowed CHECK (priority IN ('low','normal','high','urgent'));
+        ALTER TABLE disputes ADD COLUMN IF NOT EXISTS assigned_to UUID NULL REFERENCES users(id) ON DELETE SET NULL;
+        ALTER TABLE disputes ADD COLUMN IF NOT EXISTS assigned_at TIMESTAMP WITH TIME ZONE NULL;
+        ALTER TABLE disputes ADD COLUMN IF NOT EXISTS first_admin_response_at TIMESTAMP WITH TIME ZONE NULL;
+
+        CREATE INDEX IF NOT EXISTS idx_disputes_assigned_to ON disputes(assigned_to) WHERE status = 'open';
+
+        CREATE TABLE IF NOT EXISTS dispute_messages (
+            id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+            dispute_id UUID NOT NULL REFERENCES disputes(id) ON DELETE CASCADE,
+            author_id UUID NULL REFERENCES users(id) ON DELETE SET NULL,
+            author_role TEXT NOT NULL CHECK (author_role IN ('buyer','seller','admin','system')),
+            body TEXT NOT NULL DEFAULT '',
+            attachments JSONB NOT NULL DEFAULT '[]'::jsonb,
+            created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+        );
+
+        CREATE INDEX IF NOT EXISTS idx_dispute_messages_dispute ON dispute_messages(dispute_id, created_at);
+    `)
+    if err != nil {
+        log.Printf("failed to ensure dispute thread schema: %v", err)
+    }
+}
+
+// ensureOrderVersionColumn adds orders.version, bumped on every status change
+func ensureOrderVersionColumn() {
+    ctx := context.Background()
+    _, err := Conn.Exec(ctx, `
+        ALTER TABLE orders ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 0;
+    `)
+    if err != nil {
+        log.Printf("failed to ensure order version column: %v", err)
+    }
+}
+
+// ensureRevisionSchema adds revision terms to services and orders, and the
+// delivery and revision history tables
+func ensureRevisionSchema() {
+    ctx := context.Background()
+    _, err := Conn.Exec(ctx, `
+        ALTER TABLE services ADD COLUMN IF NOT EXISTS revisions_included INT NOT NULL DEFAULT 0;
+        ALTER TABLE services ADD COLUMN IF NOT EXISTS extra_revision_price BIGINT NULL;
+
+        -- Snapshot of the service terms at order time
+        ALTER TABLE orders ADD COLUMN IF NOT EXISTS revisions_included INT NOT NULL DEFAULT 0;
+        ALTER TABLE orders ADD COLUMN IF NOT EXISTS revisions_used INT NOT NULL DEFAULT 0;
+        ALTER TABLE orders ADD COLUMN IF NOT EXISTS extra_revision_price BIGINT NULL;
+
+        CREATE TABLE IF NOT EXISTS order_deliveries (
+            id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+            order_id UUID NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+            round INT NOT NULL,
+            message TEXT NOT NULL DEFAULT '',
+            attachments JSONB NOT NULL DEFAULT '[]'::jsonb,
+            created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+            UNIQUE (order_id, round)
+        );
+
+        CREATE TABLE IF NOT EXISTS order_revisions (
+            id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+            order_id UUID NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+            delivery_id UUID NULL REFERENCES order_deliveries(id) ON DELETE SET NULL,
+            note TEXT NOT NULL,
+            charged BIGINT NOT NULL DEFAULT 0,
+            requested_by UUID NULL REFERENCES users(id) ON DELETE SET NULL,
+            created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+        );
+
+        CREATE INDEX IF NOT EXISTS idx_order_revisions_order ON order_revisions(order_id, created_at);
+    `)
+    if err != nil {
+        log.Printf("failed to ensure revision schema: %v", err)
+    }
+}
+
+// ensureDeadlineSchema adds order due dates and deadline extension requests
+func ensureDeadlineSchema() {
+    ctx := context.Background()
+    _, err := Conn.Exec(ctx, `
+        ALTER TABLE orders ADD COLUMN IF NOT EXISTS delivery_days INT NOT NULL DEFAULT 0;
+        ALTER TABLE orders ADD COLUMN IF NOT EXISTS due_at TIMESTAMP WITH TIME ZONE NULL;
+        ALTER TABLE orders ADD COLUMN IF NOT EXISTS due_reminder_sent_at TIMESTAMP WITH TIME ZONE NULL;
+        ALTER TABLE orders ADD COLUMN IF NOT EXISTS overdue_notified_at TIMESTAMP WITH TIME ZONE NULL;
+        ALTER TABLE orders ADD COLUMN IF NOT EXISTS first_delivered_at TIMESTAMP WITH TIME ZONE NULL;
+        ALTER TABLE orders ADD COLUMN IF NOT EXISTS delivered_on_time BOOLEAN NULL;
+
+        CREATE INDEX IF NOT EXISTS idx_orders_due_at ON orders(due_at) WHERE status = 'in_progress';
+        CREATE INDEX IF NOT EXISTS idx_orders_seller_on_time ON orders(seller_id) WHERE delivered_on_time IS NOT NULL;
+
+        CREATE TABLE IF NOT EXISTS order_deadline_extensions (
+            id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+            order_id UUID NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+            requested_by UUID NULL REFERENCES users(id) ON DELETE SET NULL,
+            requested_role TEXT NOT NULL CHECK (requested_role IN ('buyer','seller','admin')),
+            days INT NOT NULL CHECK (days > 0),
+            reason TEXT NOT NULL DEFAULT '',
+            status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending','accepted','rejected','granted','withdrawn')),
+            new_due_at TIMESTAMP WITH TIME ZONE NULL,
+            responded_by UUID NULL REFERENCES users(id) ON DELETE SET NULL,
+            created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+            responded_at TIMESTAMP WITH TIME ZONE NULL
+        );
+
+        CREATE UNIQUE INDEX IF NOT EXISTS idx_order_extensions_one_pending
+            ON order_deadline_extensions(order_id) WHERE status = 'pending';
+    `)
+    if err != nil {
+        log.Printf("failed to ensure deadline schema: %v", err)
+    }
+}
+
+// ensurePackageSchema adds service packages, extras and the order selection snapshot
+func ensurePackageSchema() {
+    ctx := context.Background()
+    _, err := Conn.Exec(ctx, `
+        CREATE TABLE IF NOT EXISTS service_packages (
+            id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+            service_id UUID NOT NULL REFERENCES services(id) ON DELETE CASCADE,
+            tier TEXT NOT NULL CHECK (tier IN ('basic','standard','premium')),
+            name TEXT NOT NULL,
+            description TEXT NOT NULL DEFAULT '',
+            price BIGINT NOT NULL CHECK (price > 0),
+            delivery_days INT NOT NULL DEFAULT 0 CHECK (delivery_days >= 0),
+            revisions_included INT NOT NULL DEFAULT 0 CHECK (revisions_included >= 0),
+            active BOOLEAN NOT NULL DEFAULT TRUE,
+            created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+            UNIQUE (service_id, tier)
+        );
+
+        CREATE TABLE IF NOT EXISTS service_extras (
+            id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+            service_id UUID NOT NULL REFERENCES services(id) ON DELETE CASCADE,
+            name TEXT NOT NULL,
+            description TEXT NOT NULL DEFAULT '',
+            price BIGINT NOT NULL CHECK (price >= 0),
+            delivery_days_delta INT NOT NULL DEFAULT 0,
+            active BOOLEAN NOT NULL DEFAULT TRUE,
+            created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+        );
+
+        CREATE INDEX IF NOT EXISTS idx_service_extras_service ON service_extras(service_id);
+
+        ALTER TABLE orders ADD COLUMN IF NOT EXISTS package_id UUID NULL REFERENCES service_packages(id) ON DELETE SET NULL;
+        ALTER TABLE orders ADD COLUMN IF NOT EXISTS package_tier TEXT NULL;
+        ALTER TABLE orders ADD COLUMN IF NOT EXISTS selection JSONB NULL;
+    `)
+    if err != nil {
+        log.Printf("failed to ensure package schema: %v", err)
+    }
+}
+
+// ensureCustomOfferSchema adds custom offers and links them to messages and orders
+func ensureCustomOfferSchema() {
+    ctx := context.Background()
+    _, err := Conn.Exec(ctx, `
+        CREATE TABLE IF NOT EXISTS custom_offers (
+            id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+            thread_order_id UUID NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+            service_id UUID NOT NULL REFERENCES services(id) ON DELETE CASCADE,
+            seller_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+            buyer_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+            scope TEXT NOT NULL,
+            price BIGINT NOT NULL CHECK (price > 0),
+            delivery_days INT NOT NULL DEFAULT 0 CHECK (delivery_days >= 0),
+            revisions_included INT NOT NULL DEFAULT 0 CHECK (revisions_included >= 0),
+            status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending','accepted','declined','withdrawn')),
+            expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+            order_id UUID NULL REFERENCES orders(id) ON DELETE SET NULL,
+            created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+            responded_at TIMESTAMP WITH TIME ZONE NULL
+        );
+
+        CREATE INDEX IF NOT EXISTS idx_custom_offers_thread ON custom_offers(thread_order_id, created_at);
+
+        ALTER TABLE messages ADD COLUMN IF NOT EXISTS offer_id UUID NULL REFERENCES custom_offers(id) ON DELETE SET NULL;
+        ALTER TABLE orders ADD COLUMN IF NOT EXISTS custom_offer_id UUID NULL REFERENCES custom_offers(id) ON DELETE SET NULL;
+    `)
+    if err != nil {
+        log.Printf("failed to ensure custom offer schema: %v", err)
+    }
+}
+
+// ensureRequirementsSchema adds service requirement questions and order answers
+func ensureRequirementsSchema() {
+    ctx := context.Background()
+    _, err := Conn.Exec(ctx, `
+        ALTER TABLE services ADD COLUMN IF NOT EXISTS requirements JSONB NOT NULL DEFAULT '[]'::jsonb;
+
+        ALTER TABLE orders ADD COLUMN IF NOT EXISTS requirements JSONB NULL;
+        ALTER TABLE orders ADD COLUMN IF NOT EXISTS answers JSONB NULL;
+        -- Existing orders count as complete; new orders set it explicitly
+        ALTER TABLE orders ADD COLUMN IF NOT EXISTS requirements_completed_at TIMESTAMP WITH TIME ZONE NULL DEFAULT CURRENT_TIMESTAMP;
+    `)
+    if err != nil {
+        log.Printf("failed to ensure requirements schema: %v", err)
+    }
+}
+
+// ensureFilesTable creates the uploaded files table if missing
+func ensureFilesTable() {
+    ctx := context.Background()
+    _, err := Conn.Exec(ctx, `
+        CREATE TABLE IF NOT EXISTS files (
+            id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+            owner_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+            purpose TEXT NOT NULL CHECK (purpose IN ('avatar','attachment','delivery')),
+            storage_driver TEXT NOT NULL,
+            storage_key TEXT NOT NULL UNIQUE,
+            filename TEXT NOT NULL,
+            content_type TEXT NOT NULL,
+            size_bytes BIGINT NOT NULL CHECK (size_bytes > 0),
+            sha256 TEXT NOT NULL,
+            order_id UUID NULL REFERENCES orders(id) ON DELETE CASCADE,
+            delivery_id UUID NULL REFERENCES order_deliveries(id) ON DELETE SET NULL,
+            created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+        );
+
+        CREATE INDEX IF NOT EXISTS idx_files_owner ON files(owner_id, created_at);
+        CREATE INDEX IF NOT EXISTS idx_files_order ON files(order_id) WHERE order_id IS NOT NULL;
+        CREATE INDEX IF NOT EXISTS idx_files_delivery ON files(delivery_id) WHERE delivery_id IS NOT NULL;
+    `)
+    if err != nil {
+        log.Printf("failed to ensure files table: %v", err)
+    }
+}
+
+// ensureServiceVersionSchema adds service statuses, version history and order snapshots
+func ensureServiceVersionSchema() {
+    ctx := context.Background()
+    _, err := Conn.Exec(ctx, `
+        ALTER TABLE services DROP CONSTRAINT IF EXISTS services_status_check;
+        ALTER TABLE services ADD CONSTRAINT services_status_check
+            CHECK (status IN ('active','suspended','pending','paused','deleted'));
+        ALTER TABLE services ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 1;
+        ALTER TABLE services ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP WITH TIME ZONE NULL;
+        ALTER TABLE services ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE NULL;
+
+        CREATE TABLE IF NOT EXISTS service_versions (
+            id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+            service_id UUID NOT NULL REFERENCES services(id) ON DELETE CASCADE,
+            version INT NOT NULL,
+            title TEXT NOT NULL,
+            description TEXT NULL,
+            price BIGINT NOT NULL,
+            category TEXT NULL,
+            delivery_time_days INT NULL,
+            revisions_included INT NOT NULL DEFAULT 0,
+            extra_revision_price BIGINT NULL,
+            requirements JSONB NOT NULL DEFAULT '[]'::jsonb,
+            packages JSONB NOT NULL DEFAULT '[]'::jsonb,
+            extras JSONB NOT NULL DEFAULT '[]'::jsonb,
+            status TEXT NOT NULL,
+            change TEXT NOT NULL DEFAULT '',
+            edited_by UUID NULL REFERENCES users(id) ON DELETE SET NULL,
+            created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+            UNIQUE (service_id, version)
+        );
+
+        -- Services listed before versioning start their history at their current state
+        INSERT INTO service_versions (service_id, version, title, description, price, category, delivery_time_days,
+                                      revisions_included, extra_revision_price, requirements, packages, extras, status, change, edited_by)
+        SELECT s.id, s.version, s.title, s.description, s.price, s.category, s.delivery_time_days,
+               s.revisions_included, s.extra_revision_price, s.requirements,
+               COALESCE((SELECT jsonb_agg(to_jsonb(p) - 'service_id') FROM service_packages p WHERE p.service_id = s.id AND p.active), '[]'::jsonb),
+               COALESCE((SELECT jsonb_agg(to_jsonb(x) - 'service_id') FROM service_extras x WHERE x.service_id = s.id AND x.active), '[]'::jsonb),
+               COALESCE(s.status, 'active'), 'created', s.user_id
+        FROM services s
+        WHERE NOT EXISTS (SELECT 1 FROM service_versions v WHERE v.service_id = s.id);
+
+        ALTER TABLE orders ADD COLUMN IF NOT EXISTS service_title TEXT NULL;
+        ALTER TABLE orders ADD COLUMN IF NOT EXISTS service_price BIGINT NULL;
+        ALTER TABLE orders ADD COLUMN IF NOT EXISTS service_version INT NULL;
+
+        UPDATE orders o SET service_title = s.title
+        FROM services s
+        WHERE s.id = o.service_id AND o.service_title IS NULL;
+    `)
+    if err != nil {
+        log.Printf("failed to ensure service version schema: %v", err)
+    }
+}
+
+func ensureServiceSearchSchema() {
+    ctx := context.Background()
+    _, err := Conn.Exec(ctx, `
+        CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+        ALTER TABLE services ADD COLUMN IF NOT EXISTS search_vector tsvector
+            GENERATED ALWAYS AS (
+                setweight(to_tsvector('english', COALESCE(title, '')), 'A') ||
+                setweight(to_tsvector('english', COALESCE(description, '')), 'B') ||
+                setweight(to_tsvector('english', COALESCE(category, '')), 'C')
+            ) STORED;
+        CREATE INDEX IF NOT EXISTS idx_services_search ON services USING GIN (search_vector);
+        CREATE INDEX IF NOT EXISTS idx_services_title_trgm ON services USING GIN (title gin_trgm_ops);
+
+        ALTER TABLE services ADD COLUMN IF NOT EXISTS rating_avg DOUBLE PRECISION NOT NULL DEFAULT 0;
+        ALTER TABLE services ADD COLUMN IF NOT EXISTS rating_count INT NOT NULL DEFAULT 0;
+
+        UPDATE services s SET rating_avg = agg.avg, rating_count = agg.n
+        FROM (
+            SELECT o.service_id, AVG(r.rating)::float AS avg, COUNT(*) AS n
+            FROM reviews r JOIN orders o ON o.id = r.order_id
+            GROUP BY o.service_id
+        ) agg
+        WHERE agg.service_id = s.id;
+    `)
+    if err != nil {
+        log.Printf("failed to ensure service search schema: %v", err)
+    }
+}
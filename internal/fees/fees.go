@@ -0,0 +1,97 @@
+package fees
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Schedule is an admin-configured fee rule. Category and SellerRole narrow
+// the orders it applies to (empty matches any); StartsAt/EndsAt make it a
+// promotional override that only applies inside that window.
+type Schedule struct {
+	ID          string     `json:"id"`
+	Name        string     `json:"name"`
+	Category    string     `json:"category,omitempty"`
+	SellerRole  string     `json:"seller_role,omitempty"`
+	PercentBps  int        `json:"percent_bps"` // 250 = 2.5%
+	FixedAmount int64      `json:"fixed_amount"`
+	StartsAt    *time.Time `json:"starts_at,omitempty"`
+	EndsAt      *time.Time `json:"ends_at,omitempty"`
+	IsActive    bool       `json:"is_active"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// Promotional reports whether the schedule is limited to a time window
+func (s Schedule) Promotional() bool {
+	return s.StartsAt != nil || s.EndsAt != nil
+}
+
+// Quote is the fee breakdown for an order amount
+type Quote struct {
+	ScheduleID  string `json:"fee_schedule_id,omitempty"`
+	Name        string `json:"fee_schedule,omitempty"`
+	Promotional bool   `json:"promotional"`
+	PercentBps  int    `json:"percent_bps"`
+	FixedAmount int64  `json:"fixed_amount"`
+	Amount      int64  `json:"amount"`
+	Fee         int64  `json:"platform_fee"`
+	SellerNet   int64  `json:"seller_net"`
+}
+
+// Querier is satisfied by both the pool and a transaction
+type Querier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// Compute applies a percentage (basis points, rounded down) plus a fixed
+// amount. The fee never exceeds the order amount.
+func Compute(amount int64, percentBps int, fixed int64) int64 {
+	fee := amount*int64(percentBps)/10000 + fixed
+	if fee > amount {
+		fee = amount
+	}
+	if fee < 0 {
+		fee = 0
+	}
+	return fee
+}
+
+// QuoteFor picks the schedule that applies to an order and computes the fee.
+// Promotional schedules in their window win over standing ones; among those,
+// the most specific (category and role) wins, then the newest. With no
+// matching schedule the fee is zero.
+func QuoteFor(ctx context.Context, q Querier, category, sellerRole string, amount int64, at time.Time) (Quote, error) {
+	quote := Quote{Amount: amount, SellerNet: amount}
+	var s Schedule
+	err := q.QueryRow(ctx, `
+        SELECT id::text, name, percent_bps, fixed_amount, starts_at, ends_at
+        FROM fee_schedules
+        WHERE is_active
+          AND (category IS NULL OR category = $1)
+          AND (seller_role IS NULL OR seller_role = $2)
+          AND (starts_at IS NULL OR starts_at <= $3)
+          AND (ends_at IS NULL OR ends_at > $3)
+        ORDER BY (starts_at IS NOT NULL OR ends_at IS NOT NULL) DESC,
+                 (category IS NOT NULL)::int + (seller_role IS NOT NULL)::int DESC,
+                 created_at DESC
+        LIMIT 1`, category, sellerRole, at,
+	).Scan(&s.ID, &s.Name, &s.PercentBps, &s.FixedAmount, &s.StartsAt, &s.EndsAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return quote, nil
+	}
+	if err != nil {
+		return quote, err
+	}
+
+	quote.ScheduleID = s.ID
+	quote.Name = s.Name
+	quote.Promotional = s.Promotional()
+	quote.PercentBps = s.PercentBps
+	quote.FixedAmount = s.FixedAmount
+	quote.Fee = Compute(amount, s.PercentBps, s.FixedAmount)
+	quote.SellerNet = amount - quote.Fee
+	return quote, nil
+}
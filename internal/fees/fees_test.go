@@ -0,0 +1,30 @@
+package fees
+
+import "testing"
+
+func TestCompute(t *testing.T) {
+	tests := []struct {
+		name       string
+		amount     int64
+		percentBps int
+		fixed      int64
+		want       int64
+	}{
+		{"no fee", 10000, 0, 0, 0},
+		{"percent only", 10000, 1000, 0, 1000},
+		{"fixed only", 10000, 0, 250, 250},
+		{"percent and fixed", 10000, 500, 100, 600},
+		{"rounds down", 999, 1000, 0, 99},
+		{"fractional bps", 12345, 275, 0, 339},
+		{"capped at amount", 1000, 5000, 800, 1000},
+		{"full percent", 1000, 10000, 0, 1000},
+		{"zero amount", 0, 1000, 100, 0},
+		{"negative fixed floors at zero", 1000, 0, -50, 0},
+		{"negative fixed reduces percent", 10000, 1000, -200, 800},
+	}
+	for _, tt := range tests {
+		if got := Compute(tt.amount, tt.percentBps, tt.fixed); got != tt.want {
+			t.Errorf("%s: Compute(%d, %d, %d) = %d, want %d", tt.name, tt.amount, tt.percentBps, tt.fixed, got, tt.want)
+		}
+	}
+}
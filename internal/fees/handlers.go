@@ -0,0 +1,213 @@
+package fees
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/sudo-init-do/crafthub/internal/db"
+)
+
+// nullable is a request field that tells an omitted value (Set false) from an
+// explicit null (Set, Value nil), so PATCH can clear optional columns
+type nullable[T any] struct {
+	Set   bool
+	Value *T
+}
+
+func (n *nullable[T]) UnmarshalJSON(b []byte) error {
+	n.Set, n.Value = true, nil
+	if string(b) == "null" {
+		return nil
+	}
+	var v T
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	n.Value = &v
+	return nil
+}
+
+// ScheduleRequest creates or patches a schedule. Omitted or empty fields are
+// left unchanged; null clears category, seller_role, starts_at or ends_at.
+type ScheduleRequest struct {
+	Name        string              `json:"name"`
+	Category    nullable[string]    `json:"category"`
+	SellerRole  nullable[string]    `json:"seller_role"`
+	PercentBps  *int                `json:"percent_bps"`
+	FixedAmount *int64              `json:"fixed_amount"`
+	StartsAt    nullable[time.Time] `json:"starts_at"`
+	EndsAt      nullable[time.Time] `json:"ends_at"`
+	IsActive    *bool               `json:"is_active"`
+}
+
+func (r *ScheduleRequest) validate(s *Schedule) string {
+	if r.Name != "" {
+		s.Name = strings.TrimSpace(r.Name)
+	}
+	if r.Category.Set {
+		if r.Category.Value == nil {
+			s.Category = ""
+		} else if v := strings.TrimSpace(*r.Category.Value); v != "" {
+			s.Category = v
+		}
+	}
+	if r.SellerRole.Set {
+		if r.SellerRole.Value == nil {
+			s.SellerRole = ""
+		} else if *r.SellerRole.Value != "" {
+			s.SellerRole = *r.SellerRole.Value
+		}
+	}
+	if r.PercentBps != nil {
+		s.PercentBps = *r.PercentBps
+	}
+	if r.FixedAmount != nil {
+		s.FixedAmount = *r.FixedAmount
+	}
+	if r.StartsAt.Set {
+		s.StartsAt = r.StartsAt.Value
+	}
+	if r.EndsAt.Set {
+		s.EndsAt = r.EndsAt.Value
+	}
+	if r.IsActive != nil {
+		s.IsActive = *r.IsActive
+	}
+
+	switch {
+	case s.Name == "":
+		return "name is required"
+	case s.SellerRole != "" && s.SellerRole != "fan" && s.SellerRole != "creator":
+		return "seller_role must be fan or creator"
+	case s.PercentBps < 0 || s.PercentBps > 10000:
+		return "percent_bps must be between 0 and 10000"
+	case s.FixedAmount < 0:
+		return "fixed_amount cannot be negative"
+	case s.StartsAt != nil && s.EndsAt != nil && !s.EndsAt.After(*s.StartsAt):
+		return "ends_at must be after starts_at"
+	}
+	return ""
+}
+
+const scheduleColumns = `id::text, name, COALESCE(category, ''), COALESCE(seller_role, ''), percent_bps, fixed_amount,
+	starts_at, ends_at, is_active, created_at`
+
+// ListSchedules returns all fee schedules
+// GET /admin/fees
+func ListSchedules(c echo.Context) error {
+	rows, err := db.Conn.Query(context.Background(),
+		`SELECT `+scheduleColumns+` FROM fee_schedules ORDER BY is_active DESC, created_at DESC`)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not fetch fee schedules"})
+	}
+	defer rows.Close()
+
+	var items []Schedule
+	for rows.Next() {
+		var s Schedule
+		if err := rows.Scan(&s.ID, &s.Name, &s.Category, &s.SellerRole, &s.PercentBps, &s.FixedAmount,
+			&s.StartsAt, &s.EndsAt, &s.IsActive, &s.CreatedAt); err != nil {
+			return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to read fee schedule"})
+		}
+		items = append(items, s)
+	}
+	return c.JSON(http.StatusOK, echo.Map{"fee_schedules": items})
+}
+
+// CreateSchedule adds a fee schedule
+// POST /admin/fees
+func CreateSchedule(c echo.Context) error {
+	adminID, _ := c.Get("user_id").(string)
+	var req ScheduleRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid request"})
+	}
+	s := Schedule{ID: uuid.New().String(), IsActive: true, CreatedAt: time.Now()}
+	if msg := req.validate(&s); msg != "" {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": msg})
+	}
+
+	_, err := db.Conn.Exec(context.Background(),
+		`INSERT INTO fee_schedules (id, name, category, seller_role, percent_bps, fixed_amount, starts_at, ends_at, is_active, created_by, created_at, updated_at)
+		 VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, ''), $5, $6, $7, $8, $9, $10, $11, $11)`,
+		s.ID, s.Name, s.Category, s.SellerRole, s.PercentBps, s.FixedAmount, s.StartsAt, s.EndsAt, s.IsActive, adminID, s.CreatedAt,
+	)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not create fee schedule"})
+	}
+	return c.JSON(http.StatusCreated, s)
+}
+
+// UpdateSchedule changes a fee schedule; omitted fields are left unchanged
+// and null clears the scope or window. Orders keep the fee they were quoted.
+// PATCH /admin/fees/:id
+func UpdateSchedule(c echo.Context) error {
+	id := c.Param("id")
+	var req ScheduleRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid request"})
+	}
+
+	ctx := context.Background()
+	var s Schedule
+	err := db.Conn.QueryRow(ctx, `SELECT `+scheduleColumns+` FROM fee_schedules WHERE id = $1`, id).Scan(
+		&s.ID, &s.Name, &s.Category, &s.SellerRole, &s.PercentBps, &s.FixedAmount, &s.StartsAt, &s.EndsAt, &s.IsActive, &s.CreatedAt)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, echo.Map{"error": "fee schedule not found"})
+	}
+	if msg := req.validate(&s); msg != "" {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": msg})
+	}
+
+	_, err = db.Conn.Exec(ctx,
+		`UPDATE fee_schedules
+		 SET name = $2, category = NULLIF($3, ''), seller_role = NULLIF($4, ''), percent_bps = $5, fixed_amount = $6,
+		     starts_at = $7, ends_at = $8, is_active = $9, updated_at = NOW()
+		 WHERE id = $1`,
+		s.ID, s.Name, s.Category, s.SellerRole, s.PercentBps, s.FixedAmount, s.StartsAt, s.EndsAt, s.IsActive,
+	)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not update fee schedule"})
+	}
+	return c.JSON(http.StatusOK, s)
+}
+
+// DeactivateSchedule switches a fee schedule off
+// DELETE /admin/fees/:id
+func DeactivateSchedule(c echo.Context) error {
+	ct, err := db.Conn.Exec(context.Background(),
+		`UPDATE fee_schedules SET is_active = FALSE, updated_at = NOW() WHERE id = $1`, c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not deactivate fee schedule"})
+	}
+	if ct.RowsAffected() == 0 {
+		return c.JSON(http.StatusNotFound, echo.Map{"error": "fee schedule not found"})
+	}
+	return c.JSON(http.StatusOK, echo.Map{"message": "fee schedule deactivated"})
+}
+
+// PreviewQuote shows which schedule applies and the resulting fee
+// GET /admin/fees/quote?amount=&category=&seller_role=&at=
+func PreviewQuote(c echo.Context) error {
+	amount, err := strconv.ParseInt(c.QueryParam("amount"), 10, 64)
+	if err != nil || amount <= 0 {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "amount must be a positive integer"})
+	}
+	at := time.Now()
+	if v := c.QueryParam("at"); v != "" {
+		if at, err = time.Parse(time.RFC3339, v); err != nil {
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": "at must be RFC3339"})
+		}
+	}
+	q, err := QuoteFor(context.Background(), db.Conn, c.QueryParam("category"), c.QueryParam("seller_role"), amount, at)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not compute fee"})
+	}
+	return c.JSON(http.StatusOK, q)
+}
@@ -0,0 +1,53 @@
+package fees
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestScheduleRequestPatch(t *testing.T) {
+	start := time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 0, 7)
+	scoped := func() Schedule {
+		s, e := start, end
+		return Schedule{Name: "promo", Category: "design", SellerRole: "creator", PercentBps: 500, StartsAt: &s, EndsAt: &e}
+	}
+	tests := []struct {
+		name                 string
+		body                 string
+		category, sellerRole string
+		promotional          bool
+	}{
+		{"omitted fields unchanged", `{"percent_bps": 250}`, "design", "creator", true},
+		{"empty strings unchanged", `{"category": "", "seller_role": ""}`, "design", "creator", true},
+		{"null clears scope", `{"category": null, "seller_role": null}`, "", "", true},
+		{"null clears window", `{"starts_at": null, "ends_at": null}`, "design", "creator", false},
+		{"null clears everything", `{"category": null, "seller_role": null, "starts_at": null, "ends_at": null}`, "", "", false},
+		{"values replace", `{"category": " writing ", "seller_role": "fan"}`, "writing", "fan", true},
+	}
+	for _, tt := range tests {
+		var req ScheduleRequest
+		if err := json.Unmarshal([]byte(tt.body), &req); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		s := scoped()
+		if msg := req.validate(&s); msg != "" {
+			t.Errorf("%s: validate = %q", tt.name, msg)
+			continue
+		}
+		if s.Category != tt.category || s.SellerRole != tt.sellerRole || s.Promotional() != tt.promotional {
+			t.Errorf("%s: got category %q, seller_role %q, promotional %v; want %q, %q, %v", tt.name,
+				s.Category, s.SellerRole, s.Promotional(), tt.category, tt.sellerRole, tt.promotional)
+		}
+	}
+
+	var req ScheduleRequest
+	if err := json.Unmarshal([]byte(`{"ends_at": "2026-10-01T00:00:00Z"}`), &req); err != nil {
+		t.Fatal(err)
+	}
+	s := scoped()
+	if msg := req.validate(&s); msg != "ends_at must be after starts_at" {
+		t.Errorf("ends_at before starts_at: validate = %q", msg)
+	}
+}
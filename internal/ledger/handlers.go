@@ -0,0 +1,120 @@
+package ledger
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sudo-init-do/crafthub/internal/db"
+)
+
+type PostingView struct {
+	AccountCode string `json:"account"`
+	Amount      int64  `json:"amount"`
+}
+
+type EntryView struct {
+	ID        string        `json:"id"`
+	Kind      string        `json:"kind"`
+	Reference string        `json:"reference,omitempty"`
+	Memo      string        `json:"memo,omitempty"`
+	CreatedBy string        `json:"created_by,omitempty"`
+	CreatedAt string        `json:"created_at"`
+	Postings  []PostingView `json:"postings"`
+}
+
+// GET /admin/ledger/entries?reference=&limit=
+// Lists journal entries (newest first), optionally for a single order/topup/withdrawal.
+func ListEntries(c echo.Context) error {
+	ctx := context.Background()
+	reference := c.QueryParam("reference")
+	limit := 50
+	if l := c.QueryParam("limit"); l != "" {
+		if v, err := strconv.Atoi(l); err == nil && v > 0 && v <= 500 {
+			limit = v
+		}
+	}
+
+	rows, err := db.Conn.Query(ctx,
+		`SELECT id::text, kind, COALESCE(reference::text, ''), COALESCE(memo, ''), COALESCE(created_by::text, ''), created_at
+		 FROM ledger_entries
+		 WHERE ($1 = '' OR reference::text = $1)
+		 ORDER BY created_at DESC
+		 LIMIT $2`, reference, limit,
+	)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not fetch ledger entries"})
+	}
+	defer rows.Close()
+
+	var entries []EntryView
+	index := map[string]int{}
+	var ids []string
+	for rows.Next() {
+		var e EntryView
+		var created time.Time
+		if err := rows.Scan(&e.ID, &e.Kind, &e.Reference, &e.Memo, &e.CreatedBy, &created); err != nil {
+			return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to read ledger entry"})
+		}
+		e.CreatedAt = created.UTC().Format(time.RFC3339)
+		index[e.ID] = len(entries)
+		ids = append(ids, e.ID)
+		entries = append(entries, e)
+	}
+	rows.Close()
+
+	if len(ids) > 0 {
+		prow, err := db.Conn.Query(ctx,
+			`SELECT p.entry_id::text, a.code, p.amount
+			 FROM ledger_postings p JOIN ledger_accounts a ON a.id = p.account_id
+			 WHERE p.entry_id::text = ANY($1)
+			 ORDER BY p.amount ASC`, ids,
+		)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not fetch ledger postings"})
+		}
+		defer prow.Close()
+		for prow.Next() {
+			var entryID string
+			var p PostingView
+			if err := prow.Scan(&entryID, &p.AccountCode, &p.Amount); err != nil {
+				return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to read ledger posting"})
+			}
+			i := index[entryID]
+			entries[i].Postings = append(entries[i].Postings, p)
+		}
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{"entries": entries})
+}
+
+// GET /admin/ledger/accounts?owner_id=
+// Lists accounts with their derived balances
+func ListAccounts(c echo.Context) error {
+	ownerID := c.QueryParam("owner_id")
+	rows, err := db.Conn.Query(context.Background(),
+		`SELECT a.code, a.kind, COALESCE(a.owner_id::text, ''), COALESCE(SUM(p.amount), 0)
+		 FROM ledger_accounts a
+		 LEFT JOIN ledger_postings p ON p.account_id = a.id
+		 WHERE ($1 = '' OR a.owner_id::text = $1)
+		 GROUP BY a.id
+		 ORDER BY a.kind, a.code`, ownerID,
+	)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not fetch ledger accounts"})
+	}
+	defer rows.Close()
+
+	var items []echo.Map
+	for rows.Next() {
+		var code, kind, owner string
+		var balance int64
+		if err := rows.Scan(&code, &kind, &owner, &balance); err != nil {
+			return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to read ledger account"})
+		}
+		items = append(items, echo.Map{"account": code, "kind": kind, "owner_id": owner, "balance": balance})
+	}
+	return c.JSON(http.StatusOK, echo.Map{"accounts": items})
+}
@@ -0,0 +1,358 @@
+package ledger
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// Account kinds. Every wallet movement is a balanced journal entry between
+// accounts of these kinds; the balance of an account is the sum of its postings.
+const (
+	KindUserAvailable    = "user_available"    // spendable funds of a user
+	KindUserHeld         = "user_held"         // funds reserved for a pending order or withdrawal
+	KindOrderEscrow      = "order_escrow"      // buyer funds held against an accepted order
+	KindPlatformRevenue  = "platform_revenue"  // fees earned by the platform
+	KindExternalClearing = "external_clearing" // money entering or leaving the platform
+)
+
+// Entry kinds used across the codebase
+const (
+	EntryOpeningBalance    = "opening_balance"
+	EntryTopup             = "topup"
+	EntryWithdrawal        = "withdrawal"
+	EntryWithdrawalHold    = "withdrawal_hold"
+	EntryWithdrawalRelease = "withdrawal_release"
+	EntryOrderHold         = "order_hold"
+	EntryOrderHoldRelease  = "order_hold_release"
+	EntryOrderEscrow       = "order_escrow"
+	EntryOrderRefund       = "order_refund"
+	EntryOrderRelease      = "order_release"
+	EntryOrderSettlement   = "order_settlement"
+	EntryOrderRevision     = "order_revision"
+	EntryTip               = "tip"
+)
+
+var (
+	ErrEmptyEntry        = errors.New("ledger: entry has no lines")
+	ErrInvalidAmount     = errors.New("ledger: line amount must be non-zero")
+	ErrUnbalanced        = errors.New("ledger: entry does not balance")
+	ErrInsufficientFunds = errors.New("ledger: insufficient funds")
+	ErrWalletNotFound    = errors.New("ledger: wallet not found")
+)
+
+// Account identifies a ledger account. OwnerID is the user or order the
+// account belongs to and is empty for platform-level accounts.
+type Account struct {
+	Kind    string
+	OwnerID string
+}
+
+func UserAvailable(userID string) Account { return Account{Kind: KindUserAvailable, OwnerID: userID} }
+func UserHeld(userID string) Account      { return Account{Kind: KindUserHeld, OwnerID: userID} }
+func OrderEscrow(orderID string) Account  { return Account{Kind: KindOrderEscrow, OwnerID: orderID} }
+func PlatformRevenue() Account            { return Account{Kind: KindPlatformRevenue} }
+func ExternalClearing() Account           { return Account{Kind: KindExternalClearing} }
+
+// Code is the unique, human readable account code (e.g. "user_available:<uuid>")
+func (a Account) Code() string {
+	if a.OwnerID == "" {
+		return a.Kind
+	}
+	return a.Kind + ":" + a.OwnerID
+}
+
+// Line is a single posting; a positive amount increases the account balance.
+type Line struct {
+	Account Account
+	Amount  int64
+}
+
+// Entry is a journal entry. Its lines must sum to zero.
+type Entry struct {
+	Kind      string
+	Reference string // related order, topup or withdrawal id
+	Memo      string
+	CreatedBy string // acting user id, empty for system actions
+	Lines     []Line
+}
+
+// Querier is satisfied by both the pool and a transaction
+type Querier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// Transfer posts a two-line entry moving amount from one account to another.
+func Transfer(ctx context.Context, tx pgx.Tx, kind, reference string, from, to Account, amount int64) (string, error) {
+	if amount <= 0 {
+		return "", ErrInvalidAmount
+	}
+	return Post(ctx, tx, Entry{
+		Kind:      kind,
+		Reference: reference,
+		Lines: []Line{
+			{Account: from, Amount: -amount},
+			{Account: to, Amount: amount},
+		},
+	})
+}
+
+// Post validates and records a balanced entry inside tx, then applies the
+// resulting deltas to the cached wallet columns (balance, locked_amount, escrow).
+// It returns ErrInsufficientFunds when a user or escrow account would go negative.
+// Work happens under a savepoint, so a failed post leaves tx usable.
+func Post(ctx context.Context, tx pgx.Tx, e Entry) (string, error) {
+	sp, err := tx.Begin(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer sp.Rollback(ctx)
+
+	entryID, err := post(ctx, sp, e)
+	if err != nil {
+		return "", err
+	}
+	if err := sp.Commit(ctx); err != nil {
+		return "", err
+	}
+	return entryID, nil
+}
+
+// validate checks that e has lines, none of them zero, summing to zero, and
+// returns the accounts it touches and the net change of each, by code
+func validate(e Entry) (map[string]Account, map[string]int64, error) {
+	if len(e.Lines) == 0 {
+		return nil, nil, ErrEmptyEntry
+	}
+	deltas := map[string]int64{}
+	accounts := map[string]Account{}
+	var sum int64
+	for _, l := range e.Lines {
+		if l.Amount == 0 {
+			return nil, nil, ErrInvalidAmount
+		}
+		sum += l.Amount
+		deltas[l.Account.Code()] += l.Amount
+		accounts[l.Account.Code()] = l.Account
+	}
+	if sum != 0 {
+		return nil, nil, ErrUnbalanced
+	}
+	return accounts, deltas, nil
+}
+
+func post(ctx context.Context, tx pgx.Tx, e Entry) (string, error) {
+	accounts, deltas, err := validate(e)
+	if err != nil {
+		return "", err
+	}
+
+	// Resolve accounts in a stable order to keep lock ordering deterministic
+	codes := make([]string, 0, len(accounts))
+	for code := range accounts {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	ids := make(map[string]string, len(codes))
+	for _, code := range codes {
+		id, err := ensureAccount(ctx, tx, accounts[code])
+		if err != nil {
+			return "", err
+		}
+		ids[code] = id
+	}
+
+	entryID, err := insertEntry(ctx, tx, e)
+	if err != nil {
+		return "", err
+	}
+	for _, l := range e.Lines {
+		if _, err := tx.Exec(ctx,
+			`INSERT INTO ledger_postings (id, entry_id, account_id, amount) VALUES ($1, $2, $3, $4)`,
+			uuid.New().String(), entryID, ids[l.Account.Code()], l.Amount,
+		); err != nil {
+			return "", err
+		}
+	}
+
+	if err := project(ctx, tx, codes, accounts, deltas); err != nil {
+		return "", err
+	}
+	return entryID, nil
+}
+
+// Balance returns the current balance of an account (zero if never used)
+func Balance(ctx context.Context, q Querier, a Account) (int64, error) {
+	var bal int64
+	err := q.QueryRow(ctx,
+		`SELECT COALESCE(SUM(p.amount), 0)
+		 FROM ledger_postings p JOIN ledger_accounts a ON a.id = p.account_id
+		 WHERE a.code = $1`, a.Code(),
+	).Scan(&bal)
+	return bal, err
+}
+
+func insertEntry(ctx context.Context, tx pgx.Tx, e Entry) (string, error) {
+	entryID := uuid.New().String()
+	_, err := tx.Exec(ctx,
+		`INSERT INTO ledger_entries (id, kind, reference, memo, created_by, created_at)
+		 VALUES ($1, $2, NULLIF($3, '')::uuid, NULLIF($4, ''), NULLIF($5, '')::uuid, $6)`,
+		entryID, e.Kind, e.Reference, e.Memo, e.CreatedBy, time.Now(),
+	)
+	return entryID, err
+}
+
+// ensureAccount returns the id of the account, creating it on first use.
+// Newly created user and escrow accounts are opened with the balance already
+// present in the wallet columns, so pre-ledger funds stay accounted for.
+func ensureAccount(ctx context.Context, tx pgx.Tx, a Account) (string, error) {
+	var id string
+	err := tx.QueryRow(ctx, `SELECT id FROM ledger_accounts WHERE code = $1`, a.Code()).Scan(&id)
+	if err == nil {
+		return id, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return "", err
+	}
+
+	err = tx.QueryRow(ctx,
+		`INSERT INTO ledger_accounts (id, code, kind, owner_id)
+		 VALUES ($1, $2, $3, NULLIF($4, '')::uuid)
+		 ON CONFLICT (code) DO NOTHING
+		 RETURNING id`,
+		uuid.New().String(), a.Code(), a.Kind, a.OwnerID,
+	).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// Created concurrently by another transaction
+		err = tx.QueryRow(ctx, `SELECT id FROM ledger_accounts WHERE code = $1`, a.Code()).Scan(&id)
+		return id, err
+	}
+	if err != nil {
+		return "", err
+	}
+
+	opening, err := openingBalance(ctx, tx, a)
+	if err != nil {
+		return "", err
+	}
+	if opening != 0 {
+		clearingID, err := ensureAccount(ctx, tx, ExternalClearing())
+		if err != nil {
+			return "", err
+		}
+		entryID, err := insertEntry(ctx, tx, Entry{Kind: EntryOpeningBalance, Reference: a.OwnerID, Memo: "balance carried over from wallet"})
+		if err != nil {
+			return "", err
+		}
+		if _, err := tx.Exec(ctx,
+			`INSERT INTO ledger_postings (id, entry_id, account_id, amount) VALUES ($1, $2, $3, $4), ($5, $2, $6, $7)`,
+			uuid.New().String(), entryID, id, opening, uuid.New().String(), clearingID, -opening,
+		); err != nil {
+			return "", err
+		}
+	}
+	return id, nil
+}
+
+func openingBalance(ctx context.Context, tx pgx.Tx, a Account) (int64, error) {
+	var amount int64
+	var err error
+	switch a.Kind {
+	case KindUserAvailable:
+		err = tx.QueryRow(ctx,
+			`SELECT COALESCE(balance, 0) - COALESCE(locked_amount, 0) FROM wallets WHERE user_id = $1 FOR UPDATE`, a.OwnerID,
+		).Scan(&amount)
+	case KindUserHeld:
+		err = tx.QueryRow(ctx,
+			`SELECT COALESCE(locked_amount, 0) FROM wallets WHERE user_id = $1 FOR UPDATE`, a.OwnerID,
+		).Scan(&amount)
+	case KindOrderEscrow:
+		// Orders funded before the ledger existed have no entries of their own
+		err = tx.QueryRow(ctx,
+			`SELECT CASE WHEN o.status IN ('in_progress','delivered')
+			             AND NOT EXISTS (SELECT 1 FROM ledger_entries e WHERE e.reference = o.id)
+			        THEN o.amount ELSE 0 END
+			 FROM orders o WHERE o.id = $1`, a.OwnerID,
+		).Scan(&amount)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, nil
+		}
+	default:
+		return 0, nil
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, ErrWalletNotFound
+	}
+	return amount, err
+}
+
+// project keeps the wallet columns in step with the ledger:
+// balance = available + held, locked_amount = held, escrow = sum of the
+// escrow accounts of orders the user is buying.
+func project(ctx context.Context, tx pgx.Tx, codes []string, accounts map[string]Account, deltas map[string]int64) error {
+	type walletDelta struct{ available, held int64 }
+	users := map[string]*walletDelta{}
+	var userOrder []string
+	for _, code := range codes {
+		a := accounts[code]
+		switch a.Kind {
+		case KindUserAvailable, KindUserHeld:
+			wd, ok := users[a.OwnerID]
+			if !ok {
+				wd = &walletDelta{}
+				users[a.OwnerID] = wd
+				userOrder = append(userOrder, a.OwnerID)
+			}
+			if a.Kind == KindUserAvailable {
+				wd.available += deltas[code]
+			} else {
+				wd.held += deltas[code]
+			}
+		case KindOrderEscrow:
+			bal, err := Balance(ctx, tx, a)
+			if err != nil {
+				return err
+			}
+			if bal < 0 {
+				return ErrInsufficientFunds
+			}
+			ct, err := tx.Exec(ctx,
+				`UPDATE wallets SET escrow = escrow + $1
+				 WHERE user_id = (SELECT buyer_id FROM orders WHERE id = $2) AND escrow + $1 >= 0`,
+				deltas[code], a.OwnerID,
+			)
+			if err != nil {
+				return err
+			}
+			if ct.RowsAffected() == 0 {
+				return ErrInsufficientFunds
+			}
+		}
+	}
+
+	for _, userID := range userOrder {
+		wd := users[userID]
+		if wd.available == 0 && wd.held == 0 {
+			continue
+		}
+		ct, err := tx.Exec(ctx,
+			`UPDATE wallets
+			 SET balance = balance + $1 + $2, locked_amount = COALESCE(locked_amount, 0) + $2
+			 WHERE user_id = $3
+			   AND balance + $1 >= COALESCE(locked_amount, 0)
+			   AND COALESCE(locked_amount, 0) + $2 >= 0`,
+			wd.available, wd.held, userID,
+		)
+		if err != nil {
+			return err
+		}
+		if ct.RowsAffected() == 0 {
+			return ErrInsufficientFunds
+		}
+	}
+	return nil
+}
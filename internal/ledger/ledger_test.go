@@ -0,0 +1,62 @@
+package ledger
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	buyer, seller := UserAvailable("buyer"), UserAvailable("seller")
+	tests := []struct {
+		name   string
+		lines  []Line
+		err    error
+		deltas map[string]int64
+	}{
+		{name: "empty", err: ErrEmptyEntry},
+		{name: "zero line", lines: []Line{{buyer, 0}, {seller, 0}}, err: ErrInvalidAmount},
+		{name: "unbalanced", lines: []Line{{buyer, -100}, {seller, 99}}, err: ErrUnbalanced},
+		{name: "one sided", lines: []Line{{buyer, 100}}, err: ErrUnbalanced},
+		{
+			name:   "transfer",
+			lines:  []Line{{buyer, -100}, {seller, 100}},
+			deltas: map[string]int64{"user_available:buyer": -100, "user_available:seller": 100},
+		},
+		{
+			name: "split with fee",
+			lines: []Line{
+				{OrderEscrow("o1"), -1000}, {buyer, 400}, {seller, 540}, {PlatformRevenue(), 60},
+			},
+			deltas: map[string]int64{
+				"order_escrow:o1": -1000, "user_available:buyer": 400,
+				"user_available:seller": 540, "platform_revenue": 60,
+			},
+		},
+		{
+			name:   "same account twice nets out",
+			lines:  []Line{{buyer, -100}, {buyer, 30}, {seller, 70}},
+			deltas: map[string]int64{"user_available:buyer": -70, "user_available:seller": 70},
+		},
+	}
+	for _, tt := range tests {
+		accounts, deltas, err := validate(Entry{Kind: EntryTip, Lines: tt.lines})
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.err)
+			continue
+		}
+		if tt.err != nil {
+			continue
+		}
+		if len(deltas) != len(tt.deltas) || len(accounts) != len(tt.deltas) {
+			t.Errorf("%s: got %d deltas and %d accounts, want %d", tt.name, len(deltas), len(accounts), len(tt.deltas))
+		}
+		for code, want := range tt.deltas {
+			if deltas[code] != want {
+				t.Errorf("%s: delta %s = %d, want %d", tt.name, code, deltas[code], want)
+			}
+			if accounts[code].Code() != code {
+				t.Errorf("%s: account %s missing", tt.name, code)
+			}
+		}
+	}
+}
@@ -0,0 +1,431 @@
+package marketplace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hibiken/asynq"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/labstack/echo/v4"
+	"github.com/sudo-init-do/crafthub/internal/alerts"
+	"github.com/sudo-init-do/crafthub/internal/db"
+	"github.com/sudo-init-do/crafthub/internal/orders"
+)
+
+// Deadline extension statuses
+const (
+	ExtensionPending  = "pending"
+	ExtensionAccepted = "accepted"
+	ExtensionRejected = "rejected"
+	ExtensionGranted  = "granted" // by an admin, without the other party
+)
+
+// deadlineReminderLead is how long before the due date the seller is warned
+// (ORDER_DEADLINE_REMINDER_HOURS, default 24)
+func deadlineReminderLead() time.Duration {
+	return envDuration("ORDER_DEADLINE_REMINDER_HOURS", 24, time.Hour)
+}
+
+// maxExtensionDays caps a single extension (ORDER_MAX_EXTENSION_DAYS, default 30)
+func maxExtensionDays() int {
+	if v, err := strconv.Atoi(os.Getenv("ORDER_MAX_EXTENSION_DAYS")); err == nil && v > 0 {
+		return v
+	}
+	return 30
+}
+
+// DeadlineExtension is a request to move an order's due date
+type DeadlineExtension struct {
+	ID            string     `json:"id"`
+	OrderID       string     `json:"order_id"`
+	RequestedBy   string     `json:"requested_by,omitempty"`
+	RequestedRole string     `json:"requested_role"`
+	Days          int        `json:"days"`
+	Reason        string     `json:"reason"`
+	Status        string     `json:"status"`
+	NewDueAt      *time.Time `json:"new_due_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	RespondedAt   *time.Time `json:"responded_at,omitempty"`
+}
+
+type extensionRequest struct {
+	Days   int    `json:"days"`
+	Reason string `json:"reason"`
+}
+
+func (r *extensionRequest) validate() string {
+	r.Reason = strings.TrimSpace(r.Reason)
+	if r.Days <= 0 || r.Days > maxExtensionDays() {
+		return fmt.Sprintf("days must be between 1 and %d", maxExtensionDays())
+	}
+	if len(r.Reason) > 1000 {
+		return "reason must be at most 1000 characters"
+	}
+	return ""
+}
+
+// extendDeadline moves the locked order's due date and records the extension
+// as decided. ext.Status must already be accepted or granted.
+func extendDeadline(ctx context.Context, tx pgx.Tx, o *orders.Order, ext *DeadlineExtension, actorType, actorID string) error {
+	dueAt, err := orders.ExtendDeadline(ctx, tx, o, ext.Days)
+	if err != nil {
+		return err
+	}
+	ext.NewDueAt = &dueAt
+	now := time.Now()
+	ext.RespondedAt = &now
+	return orders.LogEvent(ctx, tx, o.ID, actorType, actorID, "deadline_extended", map[string]any{
+		"extension_id": ext.ID,
+		"days":         ext.Days,
+		"status":       ext.Status,
+		"new_due_at":   dueAt.UTC().Format(time.RFC3339),
+	})
+}
+
+func extensionError(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, orders.ErrNotFound):
+		return c.JSON(http.StatusNotFound, echo.Map{"error": "order not found"})
+	case errors.Is(err, orders.ErrInvalidTransition), errors.Is(err, orders.ErrNoDeadline):
+		return c.JSON(http.StatusConflict, echo.Map{"error": "only in-progress orders with a deadline can be extended"})
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return c.JSON(http.StatusConflict, echo.Map{"error": "an extension request is already pending"})
+	}
+	return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to update deadline"})
+}
+
+// POST /marketplace/orders/:id/extensions
+// Buyer or seller asks for more time; the other party accepts or rejects.
+func RequestExtension(c echo.Context) error {
+	uid, ok := c.Get("user_id").(string)
+	if !ok || uid == "" {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "unauthorized"})
+	}
+	var req extensionRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid payload"})
+	}
+	if msg := req.validate(); msg != "" {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": msg})
+	}
+
+	ctx := context.Background()
+	tx, err := db.Conn.Begin(ctx)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "transaction start failed"})
+	}
+	defer tx.Rollback(ctx)
+
+	o, err := orders.Lock(ctx, tx, c.Param("id"))
+	if err != nil {
+		return extensionError(c, err)
+	}
+	role, other := orders.ActorBuyer, o.SellerID
+	switch uid {
+	case o.BuyerID:
+	case o.SellerID:
+		role, other = orders.ActorSeller, o.BuyerID
+	default:
+		return c.JSON(http.StatusNotFound, echo.Map{"error": "order not found"})
+	}
+	var hasDeadline bool
+	if err = tx.QueryRow(ctx, `SELECT due_at IS NOT NULL FROM orders WHERE id = $1`, o.ID).Scan(&hasDeadline); err != nil {
+		return extensionError(c, err)
+	}
+	if o.Status != orders.StatusInProgress || !hasDeadline {
+		return extensionError(c, orders.ErrNoDeadline)
+	}
+
+	ext := DeadlineExtension{OrderID: o.ID, RequestedBy: uid, RequestedRole: role, Days: req.Days, Reason: req.Reason, Status: ExtensionPending}
+	err = tx.QueryRow(ctx,
+		`INSERT INTO order_deadline_extensions (order_id, requested_by, requested_role, days, reason)
+		 VALUES ($1, $2, $3, $4, $5) RETURNING id::text, created_at`,
+		o.ID, uid, role, req.Days, req.Reason,
+	).Scan(&ext.ID, &ext.CreatedAt)
+	if err != nil {
+		return extensionError(c, err)
+	}
+	if err = orders.LogEvent(ctx, tx, o.ID, role, uid, "extension_requested", map[string]any{
+		"extension_id": ext.ID, "days": req.Days, "reason": req.Reason,
+	}); err != nil {
+		return extensionError(c, err)
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "commit failed"})
+	}
+
+	ref := o.ID
+	meta := fmt.Sprintf(`{"extension_id":%q,"days":%d}`, ext.ID, ext.Days)
+	_ = alerts.CreateNotification(other, "order:extension_requested", "Deadline extension requested",
+		fmt.Sprintf("The %s asked to extend the delivery deadline by %d day(s). %s", role, ext.Days, ext.Reason), &ref, &meta)
+	return c.JSON(http.StatusCreated, echo.Map{"extension": ext})
+}
+
+// POST /marketplace/orders/:id/extensions/:extension_id/accept
+func AcceptExtension(c echo.Context) error {
+	return respondToExtension(c, ExtensionAccepted)
+}
+
+// POST /marketplace/orders/:id/extensions/:extension_id/reject
+func RejectExtension(c echo.Context) error {
+	return respondToExtension(c, ExtensionRejected)
+}
+
+// respondToExtension lets the party who did not ask decide a pending request
+func respondToExtension(c echo.Context, decision string) error {
+	uid, ok := c.Get("user_id").(string)
+	if !ok || uid == "" {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "unauthorized"})
+	}
+
+	ctx := context.Background()
+	tx, err := db.Conn.Begin(ctx)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "transaction start failed"})
+	}
+	defer tx.Rollback(ctx)
+
+	o, err := orders.Lock(ctx, tx, c.Param("id"))
+	if err != nil {
+		return extensionError(c, err)
+	}
+	if uid != o.BuyerID && uid != o.SellerID {
+		return c.JSON(http.StatusNotFound, echo.Map{"error": "order not found"})
+	}
+
+	ext := DeadlineExtension{OrderID: o.ID}
+	err = tx.QueryRow(ctx,
+		`SELECT id::text, COALESCE(requested_by::text, ''), requested_role, days, reason, status, created_at
+		 FROM order_deadline_extensions WHERE id = $1 AND order_id = $2 FOR UPDATE`,
+		c.Param("extension_id"), o.ID,
+	).Scan(&ext.ID, &ext.RequestedBy, &ext.RequestedRole, &ext.Days, &ext.Reason, &ext.Status, &ext.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return c.JSON(http.StatusNotFound, echo.Map{"error": "extension not found"})
+	}
+	if err != nil {
+		return extensionError(c, err)
+	}
+	if ext.Status != ExtensionPending {
+		return c.JSON(http.StatusConflict, echo.Map{"error": "extension already " + ext.Status})
+	}
+	if ext.RequestedBy == uid {
+		return c.JSON(http.StatusForbidden, echo.Map{"error": "the other party must respond to this request"})
+	}
+	role := orders.ActorBuyer
+	if uid == o.SellerID {
+		role = orders.ActorSeller
+	}
+
+	ext.Status = decision
+	if decision == ExtensionAccepted {
+		if err = extendDeadline(ctx, tx, o, &ext, role, uid); err != nil {
+			return extensionError(c, err)
+		}
+	} else {
+		now := time.Now()
+		ext.RespondedAt = &now
+		if err = orders.LogEvent(ctx, tx, o.ID, role, uid, "extension_rejected", map[string]any{"extension_id": ext.ID}); err != nil {
+			return extensionError(c, err)
+		}
+	}
+	if _, err = tx.Exec(ctx,
+		`UPDATE order_deadline_extensions SET status = $2, new_due_at = $3, responded_by = $4, responded_at = NOW() WHERE id = $1`,
+		ext.ID, ext.Status, ext.NewDueAt, uid,
+	); err != nil {
+		return extensionError(c, err)
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "commit failed"})
+	}
+
+	if ext.RequestedBy != "" {
+		ref := o.ID
+		meta := fmt.Sprintf(`{"extension_id":%q}`, ext.ID)
+		body := "Your deadline extension request was rejected."
+		if ext.NewDueAt != nil {
+			body = "Your deadline extension was accepted. The order is now due " + ext.NewDueAt.UTC().Format("Jan 2, 2006 15:04 UTC") + "."
+		}
+		_ = alerts.CreateNotification(ext.RequestedBy, "order:extension_"+decision, "Deadline extension "+decision, body, &ref, &meta)
+	}
+	return c.JSON(http.StatusOK, echo.Map{"extension": ext})
+}
+
+// GET /marketplace/orders/:id/extensions
+func ListExtensions(c echo.Context) error {
+	o, err := orderForViewer(c)
+	if o == nil {
+		return err
+	}
+	rows, err := db.Conn.Query(context.Background(),
+		`SELECT id::text, COALESCE(requested_by::text, ''), requested_role, days, reason, status, new_due_at, created_at, responded_at
+		 FROM order_deadline_extensions WHERE order_id = $1 ORDER BY created_at DESC`, o.ID,
+	)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not fetch extensions"})
+	}
+	defer rows.Close()
+	items := []DeadlineExtension{}
+	for rows.Next() {
+		ext := DeadlineExtension{OrderID: o.ID}
+		if err := rows.Scan(&ext.ID, &ext.RequestedBy, &ext.RequestedRole, &ext.Days, &ext.Reason, &ext.Status,
+			&ext.NewDueAt, &ext.CreatedAt, &ext.RespondedAt); err != nil {
+			return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to parse extension"})
+		}
+		items = append(items, ext)
+	}
+	return c.JSON(http.StatusOK, echo.Map{"due_at": o.DueAt, "extensions": items})
+}
+
+// POST /admin/orders/:id/extend
+// Admin grants an extension without waiting for the other party.
+func GrantExtension(c echo.Context) error {
+	adminID, ok := c.Get("user_id").(string)
+	if !ok || adminID == "" {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "unauthorized"})
+	}
+	var req extensionRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid payload"})
+	}
+	if msg := req.validate(); msg != "" {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": msg})
+	}
+
+	ctx := context.Background()
+	tx, err := db.Conn.Begin(ctx)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "transaction start failed"})
+	}
+	defer tx.Rollback(ctx)
+
+	o, err := orders.Lock(ctx, tx, c.Param("id"))
+	if err != nil {
+		return extensionError(c, err)
+	}
+	ext := DeadlineExtension{
+		ID: uuid.New().String(), OrderID: o.ID, RequestedBy: adminID, RequestedRole: orders.ActorAdmin,
+		Days: req.Days, Reason: req.Reason, Status: ExtensionGranted, CreatedAt: time.Now(),
+	}
+	if err = extendDeadline(ctx, tx, o, &ext, orders.ActorAdmin, adminID); err != nil {
+		return extensionError(c, err)
+	}
+	if _, err = tx.Exec(ctx,
+		`INSERT INTO order_deadline_extensions (id, order_id, requested_by, requested_role, days, reason, status, new_due_at, responded_by, created_at, responded_at)
+		 VALUES ($1, $2, $3, 'admin', $4, $5, $6, $7, $3, $8, $8)`,
+		ext.ID, o.ID, adminID, ext.Days, ext.Reason, ext.Status, ext.NewDueAt, ext.CreatedAt,
+	); err != nil {
+		return extensionError(c, err)
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "commit failed"})
+	}
+
+	ref := o.ID
+	meta := fmt.Sprintf(`{"extension_id":%q,"days":%d}`, ext.ID, ext.Days)
+	body := fmt.Sprintf("Support extended the delivery deadline by %d day(s). The order is now due %s.", ext.Days, ext.NewDueAt.UTC().Format("Jan 2, 2006 15:04 UTC"))
+	_ = alerts.CreateNotification(o.BuyerID, "order:extension_granted", "Deadline extended", body, &ref, &meta)
+	_ = alerts.CreateNotification(o.SellerID, "order:extension_granted", "Deadline extended", body, &ref, &meta)
+	return c.JSON(http.StatusOK, echo.Map{"extension": ext})
+}
+
+func handleOrderDeadlines(ctx context.Context, _ *asynq.Task) error {
+	if err := sendDeadlineReminders(ctx, deadlineReminderLead()); err != nil {
+		log.Printf("[orders] deadline reminders failed: %v", err)
+	}
+	return notifyOverdueOrders(ctx)
+}
+
+type dueOrder struct {
+	orderID, buyerID, sellerID string
+	dueAt                      time.Time
+}
+
+// claimDueOrders marks matching in-progress orders as notified via column and
+// returns them, so concurrent runs notify each order once.
+func claimDueOrders(ctx context.Context, column, cond string, args ...any) ([]dueOrder, error) {
+	rows, err := db.Conn.Query(ctx,
+		`UPDATE orders SET `+column+` = NOW()
+		 WHERE id IN (SELECT id FROM orders WHERE status = 'in_progress' AND `+column+` IS NULL AND `+cond+` LIMIT 200)
+		   AND `+column+` IS NULL
+		 RETURNING id::text, buyer_id::text, seller_id::text, due_at`, args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []dueOrder
+	for rows.Next() {
+		var d dueOrder
+		if err := rows.Scan(&d.orderID, &d.buyerID, &d.sellerID, &d.dueAt); err != nil {
+			return nil, err
+		}
+		items = append(items, d)
+	}
+	return items, rows.Err()
+}
+
+// sendDeadlineReminders warns sellers once, lead before an order is due
+func sendDeadlineReminders(ctx context.Context, lead time.Duration) error {
+	items, err := claimDueOrders(ctx, "due_reminder_sent_at",
+		`due_at > NOW() AND due_at <= NOW() + make_interval(secs => $1)`, lead.Seconds())
+	if err != nil {
+		return err
+	}
+	for _, d := range items {
+		due := d.dueAt.UTC().Format(time.RFC3339)
+		_ = orders.LogEvent(ctx, db.Conn, d.orderID, orders.ActorSystem, "", "deadline_approaching", map[string]any{"due_at": due})
+
+		ref := d.orderID
+		meta := fmt.Sprintf(`{"due_at":%q}`, due)
+		_ = alerts.CreateNotification(d.sellerID, "order:deadline_approaching", "Order due soon",
+			"An order is due by "+d.dueAt.UTC().Format("Jan 2, 2006 15:04 UTC")+". Deliver or request an extension.", &ref, &meta)
+		if email := userEmail(ctx, d.sellerID); email != "" {
+			_ = alerts.EnqueueOrderDeadline(d.orderID, d.buyerID, d.sellerID, email, d.dueAt, false, false)
+		}
+	}
+	return nil
+}
+
+// notifyOverdueOrders tells both parties once that an order missed its
+// deadline and the buyer may now cancel for a full refund
+func notifyOverdueOrders(ctx context.Context) error {
+	items, err := claimDueOrders(ctx, "overdue_notified_at", `due_at <= NOW()`)
+	if err != nil {
+		return err
+	}
+	for _, d := range items {
+		due := d.dueAt.UTC().Format(time.RFC3339)
+		_ = orders.LogEvent(ctx, db.Conn, d.orderID, orders.ActorSystem, "", "overdue", map[string]any{"due_at": due})
+
+		ref := d.orderID
+		meta := fmt.Sprintf(`{"due_at":%q}`, due)
+		_ = alerts.CreateNotification(d.buyerID, "order:overdue", "Order overdue",
+			"Your order missed its delivery deadline. You can cancel it for a full refund, or agree an extension with the seller.", &ref, &meta)
+		_ = alerts.CreateNotification(d.sellerID, "order:overdue", "Order overdue",
+			"An order missed its delivery deadline. The buyer can now cancel it for a full refund.", &ref, &meta)
+		if email := userEmail(ctx, d.buyerID); email != "" {
+			_ = alerts.EnqueueOrderDeadline(d.orderID, d.buyerID, d.sellerID, email, d.dueAt, true, true)
+		}
+		if email := userEmail(ctx, d.sellerID); email != "" {
+			_ = alerts.EnqueueOrderDeadline(d.orderID, d.buyerID, d.sellerID, email, d.dueAt, true, false)
+		}
+	}
+	return nil
+}
+
+func userEmail(ctx context.Context, userID string) string {
+	var email string
+	_ = db.Conn.QueryRow(ctx, `SELECT email FROM users WHERE id = $1`, userID).Scan(&email)
+	return email
+}
@@ -0,0 +1,227 @@
+package marketplace
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/labstack/echo/v4"
+	"github.com/sudo-init-do/crafthub/internal/db"
+	"github.com/sudo-init-do/crafthub/internal/orders"
+	"github.com/sudo-init-do/crafthub/internal/storage"
+)
+
+const (
+	deliveryMessageMaxLen = 5000
+	revisionNoteMaxLen    = 2000
+	maxDeliveryFiles      = 20
+)
+
+// Delivery is one versioned round of delivered work
+type Delivery struct {
+	ID          string         `json:"id"`
+	Round       int            `json:"round"`
+	Message     string         `json:"message"`
+	Attachments []Attachment   `json:"attachments"`
+	Files       []storage.File `json:"files"` // deliverables uploaded through /files
+	CreatedAt   time.Time      `json:"created_at"`
+	Revision    *Revision      `json:"revision,omitempty"` // the changes requested after this round
+}
+
+// Revision is a buyer's request for changes to a delivery
+type Revision struct {
+	ID        string    `json:"id"`
+	Note      string    `json:"note"`
+	Charged   int64     `json:"charged"` // paid for an extra revision, 0 if included
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// =========================
+// DeliverOrder - Seller marks work delivered
+// =========================
+// Each delivery is stored as a new round with an optional message, attachment
+// links and uploaded deliverable files.
+func DeliverOrder(c echo.Context) error {
+	var req struct {
+		Message     string       `json:"message"`
+		Attachments []Attachment `json:"attachments"`
+		FileIDs     []string     `json:"file_ids"` // files uploaded with purpose delivery for this order
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid payload"})
+	}
+	req.Message = strings.TrimSpace(req.Message)
+	if len(req.Message) > deliveryMessageMaxLen {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": fmt.Sprintf("message must be at most %d characters", deliveryMessageMaxLen)})
+	}
+	if msg := validateAttachments(req.Attachments); msg != "" {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": msg})
+	}
+	if req.Attachments == nil {
+		req.Attachments = []Attachment{}
+	}
+	if len(req.FileIDs) > maxDeliveryFiles {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": fmt.Sprintf("at most %d files per delivery", maxDeliveryFiles)})
+	}
+
+	d := &Delivery{ID: uuid.New().String(), Message: req.Message, Attachments: req.Attachments, Files: []storage.File{}, CreatedAt: time.Now()}
+	details := map[string]any{}
+	opts := orders.Options{
+		Details: details,
+		// Number the round under the order lock
+		Guard: func(ctx context.Context, tx pgx.Tx, o *orders.Order) error {
+			if err := tx.QueryRow(ctx,
+				`SELECT COALESCE(MAX(round), 0) + 1 FROM order_deliveries WHERE order_id = $1`, o.ID,
+			).Scan(&d.Round); err != nil {
+				return err
+			}
+			details["round"] = d.Round
+			details["attachments"] = len(d.Attachments)
+			details["files"] = len(req.FileIDs)
+			// Deliverables must be this seller's unused uploads for this order
+			seen := map[string]bool{}
+			for _, id := range req.FileIDs {
+				f, err := storage.GetFile(ctx, id)
+				if errors.Is(err, storage.ErrNotFound) || (err == nil && (seen[id] || f.Purpose != storage.PurposeDelivery ||
+					f.OwnerID != o.SellerID || f.OrderID == nil || *f.OrderID != o.ID || f.DeliveryID != nil)) {
+					return fmt.Errorf("%w: file %s is not an unused deliverable for this order", orders.ErrPrecondition, id)
+				}
+				if err != nil {
+					return err
+				}
+				seen[id] = true
+				d.Files = append(d.Files, *f)
+			}
+			return nil
+		},
+	}
+	return transitionOrderTx(c, orders.ActionDeliver, orders.ActorSeller, "Order delivered", opts,
+		func(ctx context.Context, tx pgx.Tx, resp *transitionResponse) error {
+			b, err := json.Marshal(d.Attachments)
+			if err != nil {
+				return err
+			}
+			if _, err = tx.Exec(ctx,
+				`INSERT INTO order_deliveries (id, order_id, round, message, attachments, created_at)
+				 VALUES ($1, $2, $3, $4, $5, $6)`,
+				d.ID, resp.OrderID, d.Round, d.Message, b, d.CreatedAt,
+			); err != nil {
+				return err
+			}
+			for i := range d.Files {
+				if _, err = tx.Exec(ctx, `UPDATE files SET delivery_id = $2 WHERE id = $1`, d.Files[i].ID, d.ID); err != nil {
+					return err
+				}
+				d.Files[i].DeliveryID = &d.ID
+			}
+			resp.Delivery = d
+			return nil
+		})
+}
+
+// POST /marketplace/orders/:id/revision
+// Buyer sends a delivered order back to the seller with a note. Included
+// revisions are free; extra ones are charged when the service offers them.
+func RequestRevision(c echo.Context) error {
+	var req struct {
+		Note string `json:"note"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid payload"})
+	}
+	req.Note = strings.TrimSpace(req.Note)
+	if req.Note == "" {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "note is required"})
+	}
+	if len(req.Note) > revisionNoteMaxLen {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": fmt.Sprintf("note must be at most %d characters", revisionNoteMaxLen)})
+	}
+	uid, _ := c.Get("user_id").(string)
+
+	opts := orders.Options{Details: map[string]any{"note": req.Note}}
+	return transitionOrderTx(c, orders.ActionRequestRevision, orders.ActorBuyer, "Revision requested; order back in progress", opts,
+		func(ctx context.Context, tx pgx.Tx, resp *transitionResponse) error {
+			rev := &Revision{ID: uuid.New().String(), Note: req.Note, Charged: resp.Charged, CreatedAt: time.Now()}
+			_, err := tx.Exec(ctx,
+				`INSERT INTO order_revisions (id, order_id, delivery_id, note, charged, requested_by, created_at)
+				 VALUES ($1, $2, (SELECT id FROM order_deliveries WHERE order_id = $2 ORDER BY round DESC LIMIT 1), $3, $4, $5, $6)`,
+				rev.ID, resp.OrderID, rev.Note, rev.Charged, uid, rev.CreatedAt,
+			)
+			resp.Revision = rev
+			return err
+		})
+}
+
+// GET /marketplace/orders/:id/deliveries
+// Every delivery round with the revision requested after it, oldest first.
+func ListDeliveries(c echo.Context) error {
+	o, err := orderForViewer(c)
+	if o == nil {
+		return err
+	}
+
+	rows, err := db.Conn.Query(context.Background(),
+		`SELECT d.id::text, d.round, d.message, d.attachments, d.created_at,
+		        COALESCE(r.id::text, ''), COALESCE(r.note, ''), COALESCE(r.charged, 0), r.created_at
+		 FROM order_deliveries d
+		 LEFT JOIN order_revisions r ON r.delivery_id = d.id
+		 WHERE d.order_id = $1
+		 ORDER BY d.round`, o.ID,
+	)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not fetch deliveries"})
+	}
+	defer rows.Close()
+
+	deliveries := []Delivery{}
+	for rows.Next() {
+		var d Delivery
+		var attachments []byte
+		var rev Revision
+		var revAt *time.Time
+		if err := rows.Scan(&d.ID, &d.Round, &d.Message, &attachments, &d.CreatedAt, &rev.ID, &rev.Note, &rev.Charged, &revAt); err != nil {
+			return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to parse delivery"})
+		}
+		if err := json.Unmarshal(attachments, &d.Attachments); err != nil || d.Attachments == nil {
+			d.Attachments = []Attachment{}
+		}
+		if rev.ID != "" && revAt != nil {
+			rev.CreatedAt = *revAt
+			d.Revision = &rev
+		}
+		deliveries = append(deliveries, d)
+	}
+	ids := make([]string, len(deliveries))
+	for i := range deliveries {
+		ids[i] = deliveries[i].ID
+	}
+	files, err := storage.DeliveryFiles(context.Background(), ids)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not fetch delivery files"})
+	}
+	for i := range deliveries {
+		deliveries[i].Files = files[deliveries[i].ID]
+		if deliveries[i].Files == nil {
+			deliveries[i].Files = []storage.File{}
+		}
+	}
+
+	remaining := o.RevisionsIncluded - o.RevisionsUsed
+	if remaining < 0 {
+		remaining = 0
+	}
+	return c.JSON(http.StatusOK, echo.Map{
+		"order_id":             o.ID,
+		"revisions_included":   o.RevisionsIncluded,
+		"revisions_used":       o.RevisionsUsed,
+		"revisions_remaining":  remaining,
+		"extra_revision_price": o.ExtraRevisionPrice,
+		"deliveries":           deliveries,
+	})
+}
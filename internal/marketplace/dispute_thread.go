@@ -0,0 +1,283 @@
+package marketplace
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/sudo-init-do/crafthub/internal/alerts"
+	"github.com/sudo-init-do/crafthub/internal/db"
+	"github.com/sudo-init-do/crafthub/internal/orders"
+)
+
+const (
+	disputeMessageMaxLen = 5000
+	maxAttachments       = 10
+	attachmentNameMax    = 255
+)
+
+// Attachment is a file linked from a dispute message or a delivery
+type Attachment struct {
+	URL         string `json:"url"`
+	Name        string `json:"name,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+}
+
+type DisputeMessage struct {
+	ID          string       `json:"id"`
+	DisputeID   string       `json:"dispute_id"`
+	AuthorID    string       `json:"author_id,omitempty"`
+	AuthorRole  string       `json:"author_role"`
+	Body        string       `json:"body"`
+	Attachments []Attachment `json:"attachments"`
+	CreatedAt   time.Time    `json:"created_at"`
+}
+
+// DisputeMessageRequest is the payload for posting to a dispute thread
+type DisputeMessageRequest struct {
+	Body        string       `json:"body"`
+	Attachments []Attachment `json:"attachments"`
+}
+
+// Validate trims the request and returns a user-facing error, or ""
+func (r *DisputeMessageRequest) Validate() string {
+	r.Body = strings.TrimSpace(r.Body)
+	if r.Body == "" && len(r.Attachments) == 0 {
+		return "body or attachments required"
+	}
+	if utf8.RuneCountInString(r.Body) > disputeMessageMaxLen {
+		return fmt.Sprintf("body must be at most %d characters", disputeMessageMaxLen)
+	}
+	return validateAttachments(r.Attachments)
+}
+
+// validateAttachments checks and normalizes attachment urls in place
+func validateAttachments(atts []Attachment) string {
+	if len(atts) > maxAttachments {
+		return fmt.Sprintf("at most %d attachments per message", maxAttachments)
+	}
+	for i := range atts {
+		a := &atts[i]
+		u, err := url.Parse(strings.TrimSpace(a.URL))
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return "attachment url must be an http(s) url"
+		}
+		a.URL = u.String()
+		if len(a.Name) > attachmentNameMax {
+			return "attachment name is too long"
+		}
+	}
+	return ""
+}
+
+// AddDisputeMessage appends a message to the dispute thread. authorID is
+// empty for system messages.
+func AddDisputeMessage(ctx context.Context, q orders.Execer, disputeID, authorID, authorRole string, req DisputeMessageRequest) (*DisputeMessage, error) {
+	m := &DisputeMessage{
+		ID: uuid.New().String(), DisputeID: disputeID, AuthorID: authorID, AuthorRole: authorRole,
+		Body: req.Body, Attachments: req.Attachments, CreatedAt: time.Now(),
+	}
+	if m.Attachments == nil {
+		m.Attachments = []Attachment{}
+	}
+	b, err := json.Marshal(m.Attachments)
+	if err != nil {
+		return nil, err
+	}
+	_, err = q.Exec(ctx,
+		`INSERT INTO dispute_messages (id, dispute_id, author_id, author_role, body, attachments, created_at)
+		 VALUES ($1, $2, NULLIF($3, '')::uuid, $4, $5, $6, $7)`,
+		m.ID, disputeID, authorID, authorRole, m.Body, b, m.CreatedAt,
+	)
+	return m, err
+}
+
+// DisputeMessages returns the dispute thread, oldest first
+func DisputeMessages(ctx context.Context, disputeID string) ([]DisputeMessage, error) {
+	rows, err := db.Conn.Query(ctx,
+		`SELECT id::text, COALESCE(author_id::text, ''), author_role, body, attachments, created_at
+		 FROM dispute_messages WHERE dispute_id = $1 ORDER BY created_at, id`, disputeID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	msgs := []DisputeMessage{}
+	for rows.Next() {
+		m := DisputeMessage{DisputeID: disputeID}
+		var attachments []byte
+		if err := rows.Scan(&m.ID, &m.AuthorID, &m.AuthorRole, &m.Body, &attachments, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(attachments, &m.Attachments); err != nil || m.Attachments == nil {
+			m.Attachments = []Attachment{}
+		}
+		msgs = append(msgs, m)
+	}
+	return msgs, rows.Err()
+}
+
+// disputeAccess returns the caller's role on the dispute, the participants to
+// notify, and whether the dispute is open. role is "" if the caller may not see it.
+func disputeAccess(ctx context.Context, disputeID, userID string) (role string, notify []string, open bool, err error) {
+	var buyerID, sellerID, status, assignee string
+	err = db.Conn.QueryRow(ctx,
+		`SELECT o.buyer_id::text, o.seller_id::text, d.status, COALESCE(d.assigned_to::text, '')
+		 FROM disputes d JOIN orders o ON o.id = d.order_id WHERE d.id = $1`, disputeID,
+	).Scan(&buyerID, &sellerID, &status, &assignee)
+	if err != nil {
+		return "", nil, false, err
+	}
+	switch userID {
+	case buyerID:
+		role = orders.ActorBuyer
+	case sellerID:
+		role = orders.ActorSeller
+	case assignee:
+		role = orders.ActorAdmin
+	}
+	for _, id := range []string{buyerID, sellerID, assignee} {
+		if id != "" && id != userID {
+			notify = append(notify, id)
+		}
+	}
+	return role, notify, status == "open", nil
+}
+
+// NotifyDisputeMessage tells the other participants about a new message
+func NotifyDisputeMessage(disputeID string, recipients []string, m *DisputeMessage) {
+	ref := disputeID
+	meta := fmt.Sprintf(`{"message_id":%q,"attachments":%d}`, m.ID, len(m.Attachments))
+	preview := m.Body
+	if r := []rune(preview); len(r) > 140 {
+		preview = string(r[:140]) + "..."
+	}
+	for _, uid := range recipients {
+		_ = alerts.CreateNotification(uid, "dispute:message", "New message on dispute from the "+m.AuthorRole, preview, &ref, &meta)
+	}
+}
+
+// GET /marketplace/disputes/:id/messages
+func ListDisputeMessages(c echo.Context) error {
+	uid, ok := c.Get("user_id").(string)
+	if !ok || uid == "" {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "unauthorized"})
+	}
+	ctx := context.Background()
+	role, _, _, err := disputeAccess(ctx, c.Param("id"), uid)
+	if err != nil || role == "" {
+		return c.JSON(http.StatusNotFound, echo.Map{"error": "dispute not found"})
+	}
+	msgs, err := DisputeMessages(ctx, c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not fetch messages"})
+	}
+	return c.JSON(http.StatusOK, echo.Map{"messages": msgs})
+}
+
+// POST /marketplace/disputes/:id/messages
+// Buyer, seller or the assigned admin posts to the thread, optionally with evidence.
+func PostDisputeMessage(c echo.Context) error {
+	uid, ok := c.Get("user_id").(string)
+	if !ok || uid == "" {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "unauthorized"})
+	}
+	var req DisputeMessageRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid payload"})
+	}
+	if msg := req.Validate(); msg != "" {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": msg})
+	}
+
+	ctx := context.Background()
+	role, notify, open, err := disputeAccess(ctx, c.Param("id"), uid)
+	if err != nil || role == "" {
+		return c.JSON(http.StatusNotFound, echo.Map{"error": "dispute not found"})
+	}
+	if !open {
+		return c.JSON(http.StatusConflict, echo.Map{"error": "dispute is already resolved"})
+	}
+	m, err := AddDisputeMessage(ctx, db.Conn, c.Param("id"), uid, role, req)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not post message"})
+	}
+	if role == orders.ActorAdmin {
+		// Stops the first-response SLA timer
+		_, _ = db.Conn.Exec(ctx, `UPDATE disputes SET first_admin_response_at = COALESCE(first_admin_response_at, NOW()) WHERE id = $1`, c.Param("id"))
+	}
+	NotifyDisputeMessage(c.Param("id"), notify, m)
+	return c.JSON(http.StatusCreated, echo.Map{"message": m})
+}
+
+// DisputeHistory renders the dispute as plain text: the opening reason, the
+// thread, and any settlement proposals. Used in resolution notifications.
+func DisputeHistory(ctx context.Context, disputeID string) (string, error) {
+	var reason, filerID, buyerID string
+	var openedAt time.Time
+	err := db.Conn.QueryRow(ctx,
+		`SELECT d.reason, d.filer_id::text, o.buyer_id::text, d.created_at
+		 FROM disputes d JOIN orders o ON o.id = d.order_id WHERE d.id = $1`, disputeID,
+	).Scan(&reason, &filerID, &buyerID, &openedAt)
+	if err != nil {
+		return "", err
+	}
+	filer := orders.ActorSeller
+	if filerID == buyerID {
+		filer = orders.ActorBuyer
+	}
+
+	type item struct {
+		at   time.Time
+		line string
+	}
+	items := []item{{openedAt, fmt.Sprintf("Opened by the %s: %s", filer, reason)}}
+
+	msgs, err := DisputeMessages(ctx, disputeID)
+	if err != nil {
+		return "", err
+	}
+	for _, m := range msgs {
+		line := m.AuthorRole + ": " + m.Body
+		if len(m.Attachments) > 0 {
+			line += fmt.Sprintf(" [%d attachment(s)]", len(m.Attachments))
+		}
+		items = append(items, item{m.CreatedAt, line})
+	}
+
+	rows, err := db.Conn.Query(ctx,
+		`SELECT p.created_at, CASE WHEN p.proposer_id = o.buyer_id THEN 'buyer' ELSE 'seller' END, p.refund_amount, p.status
+		 FROM dispute_proposals p
+		 JOIN disputes d ON d.id = p.dispute_id
+		 JOIN orders o ON o.id = d.order_id
+		 WHERE p.dispute_id = $1`, disputeID,
+	)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var at time.Time
+		var by, status string
+		var refund int64
+		if err := rows.Scan(&at, &by, &refund, &status); err != nil {
+			return "", err
+		}
+		items = append(items, item{at, fmt.Sprintf("%s proposed a refund of %d (%s)", by, refund, status)})
+	}
+
+	sort.SliceStable(items, func(i, j int) bool { return items[i].at.Before(items[j].at) })
+	var b strings.Builder
+	for _, it := range items {
+		fmt.Fprintf(&b, "[%s] %s\n", it.at.UTC().Format("2006-01-02 15:04"), it.line)
+	}
+	return b.String(), nil
+}
@@ -10,6 +10,7 @@ import (
     "github.com/labstack/echo/v4"
     "github.com/sudo-init-do/crafthub/internal/alerts"
     "github.com/sudo-init-do/crafthub/internal/db"
+    "github.com/sudo-init-do/crafthub/internal/orders"
 )
 
 // OpenDispute allows a buyer or seller to open a dispute against an order
@@ -42,24 +43,40 @@ func OpenDispute(c echo.Context) error {
         return c.JSON(http.StatusForbidden, echo.Map{"error": "not a participant in this order"})
     }
 
+    var alreadyOpen bool
+    _ = db.Conn.QueryRow(context.Background(), `SELECT EXISTS (SELECT 1 FROM disputes WHERE order_id = $1 AND status = 'open')`, orderID).Scan(&alreadyOpen)
+    if alreadyOpen {
+        return c.JSON(http.StatusConflict, echo.Map{"error": "a dispute is already open for this order"})
+    }
+
+    // Disputes start in mediation; admins are only involved after escalation
     disputeID := uuid.New().String()
-    var createdAt time.Time
+    var createdAt, deadline time.Time
     if err := db.Conn.QueryRow(context.Background(),
-        `INSERT INTO disputes (id, order_id, filer_id, reason) VALUES ($1, $2, $3, $4) RETURNING created_at`,
-        disputeID, orderID, uid, req.Reason,
-    ).Scan(&createdAt); err != nil {
+        `INSERT INTO disputes (id, order_id, filer_id, reason, stage, mediation_deadline)
+         VALUES ($1, $2, $3, $4, 'mediation', NOW() + make_interval(secs => $5))
+         RETURNING created_at, mediation_deadline`,
+        disputeID, orderID, uid, req.Reason, mediationWindow().Seconds(),
+    ).Scan(&createdAt, &deadline); err != nil {
         return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not open dispute"})
     }
+    actor := orders.ActorSeller
+    if uid == buyerID { actor = orders.ActorBuyer }
+    _ = orders.LogEvent(context.Background(), db.Conn, orderID, actor, uid, "dispute_opened", map[string]any{"dispute_id": disputeID, "reason": req.Reason})
 
-    // Notify other participant and admins (best-effort)
+    // Notify other participant (best-effort)
     other := buyerID
     if uid == buyerID { other = sellerID }
     notifTitle := "Dispute opened on your order"
     ref := disputeID
     meta := "{}"
-    _ = alerts.CreateNotification(other, "dispute:opened", notifTitle, req.Reason, &ref, &meta)
-    _ = alerts.EnqueueAdminAlert(uid, "info", "New dispute opened: order "+orderID)
+    _ = alerts.CreateNotification(other, "dispute:opened", notifTitle, req.Reason+" - propose a settlement or escalate to our team.", &ref, &meta)
 
-    return c.JSON(http.StatusCreated, echo.Map{"dispute_id": disputeID, "created_at": createdAt.UTC().Format(time.RFC3339)})
+    return c.JSON(http.StatusCreated, echo.Map{
+        "dispute_id":         disputeID,
+        "stage":              DisputeStageMediation,
+        "mediation_deadline": deadline.UTC().Format(time.RFC3339),
+        "created_at":         createdAt.UTC().Format(time.RFC3339),
+    })
 }
 
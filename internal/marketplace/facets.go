@@ -0,0 +1,192 @@
+package marketplace
+
+import (
+	"context"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Facets, each named after the filter it counts
+const (
+	facetCategory = "category"
+	facetDelivery = "delivery"
+	facetPrice    = "price"
+	facetRating   = "rating"
+)
+
+// Delivery and rating buckets are cumulative so each can be sent back as
+// delivery_time_max or rating_min
+var (
+	deliveryBuckets = []int{1, 3, 7, 14}
+	ratingBuckets   = []float64{4.5, 4, 3}
+)
+
+const defaultPriceBuckets = "5000,10000,25000,50000,100000"
+
+// CategoryCount is the number of matching services in a category
+type CategoryCount struct {
+	Category string `json:"category"`
+	Count    int64  `json:"count"`
+}
+
+// DeliveryBucket counts services delivering within MaxDays; nil is any time
+type DeliveryBucket struct {
+	MaxDays *int  `json:"max_days"`
+	Count   int64 `json:"count"`
+}
+
+// PriceBucket counts services priced from Min up to Max inclusive; the last
+// bucket has no Max
+type PriceBucket struct {
+	Min   int64  `json:"min"`
+	Max   *int64 `json:"max"`
+	Count int64  `json:"count"`
+}
+
+// RatingBucket counts services rated at least Min
+type RatingBucket struct {
+	Min   float64 `json:"min"`
+	Count int64   `json:"count"`
+}
+
+// ServiceFacets are counts for refining a discovery query. Each facet is
+// counted under every filter in the query except its own.
+type ServiceFacets struct {
+	Total      int64            `json:"total"` // services matching all filters
+	Categories []CategoryCount  `json:"categories"`
+	Delivery   []DeliveryBucket `json:"delivery_time"`
+	Price      []PriceBucket    `json:"price"`
+	Rating     []RatingBucket   `json:"rating"`
+}
+
+// priceBucketEdges reads the ascending lower edges of the price buckets
+// from SEARCH_PRICE_BUCKETS (comma separated)
+func priceBucketEdges() []int64 {
+	raw := os.Getenv("SEARCH_PRICE_BUCKETS")
+	if raw == "" {
+		raw = defaultPriceBuckets
+	}
+	var edges []int64
+	for _, part := range strings.Split(raw, ",") {
+		if v, err := strconv.ParseInt(strings.TrimSpace(part), 10, 64); err == nil && v > 0 {
+			edges = append(edges, v)
+		}
+	}
+	sort.Slice(edges, func(i, j int) bool { return edges[i] < edges[j] })
+	return edges
+}
+
+// countFacet runs one COUNT(*) FILTER per bucket condition under all filters
+// but except's
+func countFacet(ctx context.Context, tx pgx.Tx, f serviceFilters, except string, buckets func(args *sqlArgs) []string) ([]int64, error) {
+	var args sqlArgs
+	conds := buckets(&args)
+	cols := make([]string, len(conds))
+	for i, cond := range conds {
+		cols[i] = "COUNT(*) FILTER (WHERE " + cond + ")"
+	}
+	counts := make([]int64, len(conds))
+	dest := make([]any, len(conds))
+	for i := range counts {
+		dest[i] = &counts[i]
+	}
+	err := tx.QueryRow(ctx,
+		`SELECT `+strings.Join(cols, ", ")+` FROM services s WHERE `+f.conditions(&args, except), args...,
+	).Scan(dest...)
+	return counts, err
+}
+
+// serviceFacets counts categories and delivery, price and rating buckets
+// for the filters
+func serviceFacets(ctx context.Context, tx pgx.Tx, f serviceFilters) (*ServiceFacets, error) {
+	facets := &ServiceFacets{Categories: []CategoryCount{}}
+
+	var args sqlArgs
+	rows, err := tx.Query(ctx,
+		`SELECT s.category, COUNT(*) FROM services s
+		 WHERE `+f.conditions(&args, facetCategory)+` AND COALESCE(s.category, '') <> ''
+		 GROUP BY s.category ORDER BY COUNT(*) DESC, s.category`, args...)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var cc CategoryCount
+		if err := rows.Scan(&cc.Category, &cc.Count); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		facets.Categories = append(facets.Categories, cc)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	counts, err := countFacet(ctx, tx, f, "", func(*sqlArgs) []string { return []string{"TRUE"} })
+	if err != nil {
+		return nil, err
+	}
+	facets.Total = counts[0]
+
+	counts, err = countFacet(ctx, tx, f, facetDelivery, func(args *sqlArgs) []string {
+		conds := []string{}
+		for _, days := range deliveryBuckets {
+			conds = append(conds, "s.delivery_time_days <= "+args.add(days))
+		}
+		return append(conds, "TRUE")
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i, n := range counts {
+		b := DeliveryBucket{Count: n}
+		if i < len(deliveryBuckets) {
+			b.MaxDays = &deliveryBuckets[i]
+		}
+		facets.Delivery = append(facets.Delivery, b)
+	}
+
+	edges := priceBucketEdges()
+	counts, err = countFacet(ctx, tx, f, facetPrice, func(args *sqlArgs) []string {
+		conds := []string{}
+		lower := int64(0)
+		for _, edge := range edges {
+			conds = append(conds, "s.price >= "+args.add(lower)+" AND s.price < "+args.add(edge))
+			lower = edge
+		}
+		return append(conds, "s.price >= "+args.add(lower))
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i, n := range counts {
+		b := PriceBucket{Count: n}
+		if i > 0 {
+			b.Min = edges[i-1]
+		}
+		if i < len(edges) {
+			max := edges[i] - 1
+			b.Max = &max
+		}
+		facets.Price = append(facets.Price, b)
+	}
+
+	counts, err = countFacet(ctx, tx, f, facetRating, func(args *sqlArgs) []string {
+		conds := []string{}
+		for _, min := range ratingBuckets {
+			conds = append(conds, "s.rating_avg >= "+args.add(min))
+		}
+		return conds
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i, n := range counts {
+		facets.Rating = append(facets.Rating, RatingBucket{Min: ratingBuckets[i], Count: n})
+	}
+	return facets, nil
+}
@@ -0,0 +1,246 @@
+package marketplace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"github.com/jackc/pgx/v5"
+	"github.com/sudo-init-do/crafthub/internal/alerts"
+	"github.com/sudo-init-do/crafthub/internal/db"
+	"github.com/sudo-init-do/crafthub/internal/orders"
+)
+
+// Periodic order maintenance run by the asynq scheduler
+const (
+	TaskAutoReleaseOrders = "orders:auto_release"
+	TaskExpireOrders      = "orders:expire_unaccepted"
+	TaskEscalateDisputes  = "disputes:escalate_expired"
+	TaskOrderDeadlines    = "orders:deadlines"
+)
+
+var errOrderNotDue = errors.New("order no longer due")
+
+func init() {
+	alerts.HandleFunc(TaskAutoReleaseOrders, handleAutoReleaseOrders)
+	alerts.HandleFunc(TaskExpireOrders, handleExpireOrders)
+	every := envDuration("ORDER_JOBS_INTERVAL_MINUTES", 5, time.Minute)
+	alerts.Schedule(every, TaskAutoReleaseOrders)
+	alerts.Schedule(every, TaskExpireOrders)
+	alerts.HandleFunc(TaskEscalateDisputes, func(ctx context.Context, _ *asynq.Task) error {
+		return escalateExpiredMediations(ctx)
+	})
+	alerts.Schedule(every, TaskEscalateDisputes)
+	alerts.HandleFunc(TaskOrderDeadlines, handleOrderDeadlines)
+	alerts.Schedule(every, TaskOrderDeadlines)
+}
+
+// envDuration reads a positive integer setting in the given unit
+func envDuration(key string, def int, unit time.Duration) time.Duration {
+	if v, err := strconv.Atoi(os.Getenv(key)); err == nil && v > 0 {
+		return time.Duration(v) * unit
+	}
+	return time.Duration(def) * unit
+}
+
+// inspectionWindow is how long a buyer has to review a delivery before the
+// order completes on its own (ORDER_INSPECTION_HOURS, default 72)
+func inspectionWindow() time.Duration {
+	return envDuration("ORDER_INSPECTION_HOURS", 72, time.Hour)
+}
+
+// releaseReminderLead is how long before auto-release the buyer is reminded
+// (ORDER_RELEASE_REMINDER_HOURS, default 24)
+func releaseReminderLead() time.Duration {
+	return envDuration("ORDER_RELEASE_REMINDER_HOURS", 24, time.Hour)
+}
+
+// acceptanceTTL is how long a seller has to accept a new order before it is
+// cancelled and the buyer's hold released (ORDER_ACCEPTANCE_TTL_HOURS, default 48)
+func acceptanceTTL() time.Duration {
+	return envDuration("ORDER_ACCEPTANCE_TTL_HOURS", 48, time.Hour)
+}
+
+func handleAutoReleaseOrders(ctx context.Context, _ *asynq.Task) error {
+	window := inspectionWindow()
+	now := time.Now()
+
+	if err := sendReleaseReminders(ctx, now, window, releaseReminderLead()); err != nil {
+		log.Printf("[orders] release reminders failed: %v", err)
+	}
+
+	rows, err := db.Conn.Query(ctx,
+		`SELECT o.id::text FROM orders o
+		 WHERE o.status = 'delivered'
+		   AND COALESCE(o.delivered_at, o.updated_at) <= $1
+		   AND NOT EXISTS (SELECT 1 FROM disputes d WHERE d.order_id = o.id AND d.status = 'open')
+		 ORDER BY COALESCE(o.delivered_at, o.updated_at)
+		 LIMIT 200`, now.Add(-window),
+	)
+	if err != nil {
+		return err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		if err := autoReleaseOrder(ctx, id, window); err != nil && !errors.Is(err, errOrderNotDue) {
+			log.Printf("[orders] auto-release failed: order=%s err=%v", id, err)
+		}
+	}
+	return nil
+}
+
+// autoReleaseOrder completes a delivered order whose inspection window has
+// passed, paying the seller exactly as CompleteOrder would.
+func autoReleaseOrder(ctx context.Context, orderID string, window time.Duration) error {
+	_, err := orders.Apply(ctx, orderID, orders.ActionAutoRelease, orders.ActorSystem, "", orders.Options{
+		// Re-check under the row lock: the buyer may have disputed meanwhile
+		Guard: func(ctx context.Context, tx pgx.Tx, o *orders.Order) error {
+			var disputed bool
+			if err := tx.QueryRow(ctx,
+				`SELECT EXISTS (SELECT 1 FROM disputes WHERE order_id = $1 AND status = 'open')`, o.ID,
+			).Scan(&disputed); err != nil {
+				return err
+			}
+			if disputed || time.Since(o.DeliveredAt) < window {
+				return errOrderNotDue
+			}
+			return nil
+		},
+		Details: map[string]any{"inspection_hours": window.Hours()},
+	})
+	if errors.Is(err, orders.ErrInvalidTransition) {
+		return errOrderNotDue
+	}
+	return err
+}
+
+// sendReleaseReminders warns buyers once, lead before their order auto-completes
+func sendReleaseReminders(ctx context.Context, now time.Time, window, lead time.Duration) error {
+	rows, err := db.Conn.Query(ctx,
+		`SELECT o.id::text, o.buyer_id::text, o.seller_id::text, COALESCE(o.delivered_at, o.updated_at)
+		 FROM orders o
+		 WHERE o.status = 'delivered'
+		   AND o.release_reminder_sent_at IS NULL
+		   AND COALESCE(o.delivered_at, o.updated_at) <= $1
+		   AND COALESCE(o.delivered_at, o.updated_at) > $2
+		   AND NOT EXISTS (SELECT 1 FROM disputes d WHERE d.order_id = o.id AND d.status = 'open')
+		 LIMIT 200`, now.Add(-window+lead), now.Add(-window),
+	)
+	if err != nil {
+		return err
+	}
+	type due struct {
+		orderID, buyerID, sellerID string
+		releaseAt                  time.Time
+	}
+	var items []due
+	for rows.Next() {
+		var d due
+		var deliveredAt time.Time
+		if err := rows.Scan(&d.orderID, &d.buyerID, &d.sellerID, &deliveredAt); err != nil {
+			rows.Close()
+			return err
+		}
+		d.releaseAt = deliveredAt.Add(window)
+		items = append(items, d)
+	}
+	rows.Close()
+
+	for _, d := range items {
+		// Claim the reminder so concurrent runs send it once
+		ct, err := db.Conn.Exec(ctx,
+			`UPDATE orders SET release_reminder_sent_at = NOW() WHERE id = $1 AND release_reminder_sent_at IS NULL`, d.orderID)
+		if err != nil || ct.RowsAffected() == 0 {
+			continue
+		}
+		_ = orders.LogEvent(ctx, db.Conn, d.orderID, orders.ActorSystem, "", "release_reminder_sent", map[string]any{
+			"release_at": d.releaseAt.UTC().Format(time.RFC3339),
+		})
+
+		ref := d.orderID
+		meta := fmt.Sprintf(`{"release_at":%q}`, d.releaseAt.UTC().Format(time.RFC3339))
+		body := fmt.Sprintf("Please review the delivery. Unless you complete the order or open a dispute, it will complete automatically on %s.",
+			d.releaseAt.UTC().Format("Jan 2, 2006 15:04 UTC"))
+		_ = alerts.CreateNotification(d.buyerID, "order:release_reminder", "Your order will complete soon", body, &ref, &meta)
+
+		var buyerEmail string
+		_ = db.Conn.QueryRow(ctx, `SELECT email FROM users WHERE id = $1`, d.buyerID).Scan(&buyerEmail)
+		if buyerEmail != "" {
+			_ = alerts.EnqueueOrderReleaseReminder(d.orderID, d.buyerID, d.sellerID, buyerEmail, d.releaseAt)
+		}
+	}
+	return nil
+}
+
+func handleExpireOrders(ctx context.Context, _ *asynq.Task) error {
+	ttl := acceptanceTTL()
+	rows, err := db.Conn.Query(ctx,
+		`SELECT id::text FROM orders
+		 WHERE status = 'pending_acceptance' AND created_at <= NOW() - make_interval(secs => $1)
+		 ORDER BY created_at
+		 LIMIT 200`, ttl.Seconds(),
+	)
+	if err != nil {
+		return err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		if err := expireOrder(ctx, id, ttl); err != nil && !errors.Is(err, errOrderNotDue) {
+			log.Printf("[orders] expiry failed: order=%s err=%v", id, err)
+		}
+	}
+	return nil
+}
+
+// expireOrder cancels an order the seller never accepted, refunding the buyer
+// through the same path as CancelOrder.
+func expireOrder(ctx context.Context, orderID string, ttl time.Duration) error {
+	_, err := orders.Apply(ctx, orderID, orders.ActionExpire, orders.ActorSystem, "", orders.Options{
+		Guard: func(ctx context.Context, tx pgx.Tx, o *orders.Order) error {
+			var due bool
+			if err := tx.QueryRow(ctx,
+				`SELECT created_at <= NOW() - make_interval(secs => $2) FROM orders WHERE id = $1`, o.ID, ttl.Seconds(),
+			).Scan(&due); err != nil {
+				return err
+			}
+			if !due {
+				return errOrderNotDue
+			}
+			return nil
+		},
+		Details: map[string]any{
+			"reason":               "not accepted by seller in time",
+			"acceptance_ttl_hours": ttl.Hours(),
+		},
+	})
+	// The seller may have accepted or declined since the scan
+	if errors.Is(err, orders.ErrInvalidTransition) {
+		return errOrderNotDue
+	}
+	return err
+}
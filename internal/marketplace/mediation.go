@@ -0,0 +1,541 @@
+package marketplace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/labstack/echo/v4"
+	"github.com/sudo-init-do/crafthub/internal/alerts"
+	"github.com/sudo-init-do/crafthub/internal/db"
+	"github.com/sudo-init-do/crafthub/internal/ledger"
+	"github.com/sudo-init-do/crafthub/internal/orders"
+)
+
+// A new dispute starts in mediation, where buyer and seller can settle it
+// between themselves. It reaches the admin queue (stage escalated) when either
+// party asks for it or the mediation window runs out.
+const (
+	DisputeStageMediation = "mediation"
+	DisputeStageEscalated = "escalated"
+)
+
+// Settlement proposal statuses
+const (
+	ProposalPending   = "pending"
+	ProposalAccepted  = "accepted"
+	ProposalRejected  = "rejected"
+	ProposalCountered = "countered"
+	ProposalExpired   = "expired"
+)
+
+// mediationWindow is how long a dispute stays in mediation before it is
+// escalated (DISPUTE_MEDIATION_HOURS, default 72)
+func mediationWindow() time.Duration {
+	return envDuration("DISPUTE_MEDIATION_HOURS", 72, time.Hour)
+}
+
+type SettlementProposal struct {
+	ID           string     `json:"id"`
+	DisputeID    string     `json:"dispute_id"`
+	ProposerID   string     `json:"proposer_id"`
+	ProposerRole string     `json:"proposer_role"`
+	RefundAmount int64      `json:"refund_amount"`
+	Note         string     `json:"note,omitempty"`
+	Status       string     `json:"status"`
+	CreatedAt    time.Time  `json:"created_at"`
+	RespondedAt  *time.Time `json:"responded_at,omitempty"`
+}
+
+// disputeParty is a dispute row locked for update together with its order
+type disputeParty struct {
+	disputeID, orderID string
+	buyerID, sellerID  string
+	status, stage      string
+	orderAmount        int64
+	orderStatus        string
+}
+
+// role returns the user's side of the dispute, or "" if not a participant
+func (d *disputeParty) role(userID string) string {
+	switch userID {
+	case d.buyerID:
+		return orders.ActorBuyer
+	case d.sellerID:
+		return orders.ActorSeller
+	}
+	return ""
+}
+
+func (d *disputeParty) other(userID string) string {
+	if userID == d.buyerID {
+		return d.sellerID
+	}
+	return d.buyerID
+}
+
+func lockDispute(ctx context.Context, tx pgx.Tx, disputeID string) (*disputeParty, error) {
+	d := &disputeParty{disputeID: disputeID}
+	err := tx.QueryRow(ctx,
+		`SELECT d.order_id::text, o.buyer_id::text, o.seller_id::text, d.status, d.stage, o.amount, o.status
+		 FROM disputes d JOIN orders o ON o.id = d.order_id
+		 WHERE d.id = $1
+		 FOR UPDATE OF d`, disputeID,
+	).Scan(&d.orderID, &d.buyerID, &d.sellerID, &d.status, &d.stage, &d.orderAmount, &d.orderStatus)
+	return d, err
+}
+
+// loadDisputeForParty starts a transaction, locks the dispute and checks the
+// caller takes part in it. On failure it writes the response and returns a nil tx.
+func loadDisputeForParty(ctx context.Context, c echo.Context, userID string) (pgx.Tx, *disputeParty, error) {
+	tx, err := db.Conn.Begin(ctx)
+	if err != nil {
+		return nil, nil, c.JSON(http.StatusInternalServerError, echo.Map{"error": "transaction start failed"})
+	}
+	d, err := lockDispute(ctx, tx, c.Param("id"))
+	if err != nil || d.role(userID) == "" {
+		tx.Rollback(ctx)
+		return nil, nil, c.JSON(http.StatusNotFound, echo.Map{"error": "dispute not found"})
+	}
+	if d.status != "open" {
+		tx.Rollback(ctx)
+		return nil, nil, c.JSON(http.StatusConflict, echo.Map{"error": "dispute is already resolved"})
+	}
+	return tx, d, nil
+}
+
+type proposalRequest struct {
+	RefundAmount int64  `json:"refund_amount"`
+	Note         string `json:"note"`
+}
+
+func (r *proposalRequest) validate(orderAmount int64) string {
+	r.Note = strings.TrimSpace(r.Note)
+	if r.RefundAmount < 0 || r.RefundAmount > orderAmount {
+		return fmt.Sprintf("refund_amount must be between 0 and %d", orderAmount)
+	}
+	if len(r.Note) > 1000 {
+		return "note must be at most 1000 characters"
+	}
+	return ""
+}
+
+func insertProposal(ctx context.Context, tx pgx.Tx, d *disputeParty, userID string, req proposalRequest) (*SettlementProposal, error) {
+	p := &SettlementProposal{
+		ID: uuid.New().String(), DisputeID: d.disputeID, ProposerID: userID, ProposerRole: d.role(userID),
+		RefundAmount: req.RefundAmount, Note: req.Note, Status: ProposalPending,
+	}
+	err := tx.QueryRow(ctx,
+		`INSERT INTO dispute_proposals (id, dispute_id, proposer_id, refund_amount, note, status)
+		 VALUES ($1, $2, $3, $4, NULLIF($5, ''), 'pending') RETURNING created_at`,
+		p.ID, p.DisputeID, userID, p.RefundAmount, p.Note,
+	).Scan(&p.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	err = orders.LogEvent(ctx, tx, d.orderID, p.ProposerRole, userID, "settlement_proposed", map[string]any{
+		"dispute_id": d.disputeID, "proposal_id": p.ID, "refund_amount": p.RefundAmount,
+	})
+	return p, err
+}
+
+func notifyProposal(d *disputeParty, userID string, p *SettlementProposal, title string) {
+	ref := d.disputeID
+	meta := fmt.Sprintf(`{"proposal_id":%q,"refund_amount":%d,"order_amount":%d}`, p.ID, p.RefundAmount, d.orderAmount)
+	body := fmt.Sprintf("Proposed settlement: refund %d of %d to the buyer, the rest released to the seller.", p.RefundAmount, d.orderAmount)
+	if p.Note != "" {
+		body += " " + p.Note
+	}
+	_ = alerts.CreateNotification(d.other(userID), "dispute:proposal", title, body, &ref, &meta)
+}
+
+// POST /marketplace/disputes/:id/proposals
+// Proposes a settlement. Only one proposal can be pending at a time; answer a
+// pending proposal from the other party with accept, counter or reject.
+func ProposeSettlement(c echo.Context) error {
+	uid, ok := c.Get("user_id").(string)
+	if !ok || uid == "" {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "unauthorized"})
+	}
+	var req proposalRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid payload"})
+	}
+
+	ctx := context.Background()
+	tx, d, resp := loadDisputeForParty(ctx, c, uid)
+	if tx == nil {
+		return resp
+	}
+	defer tx.Rollback(ctx)
+
+	if d.stage != DisputeStageMediation {
+		return c.JSON(http.StatusConflict, echo.Map{"error": "dispute has been escalated to an admin"})
+	}
+	if msg := req.validate(d.orderAmount); msg != "" {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": msg})
+	}
+	var pendingBy string
+	err := tx.QueryRow(ctx,
+		`SELECT proposer_id::text FROM dispute_proposals WHERE dispute_id = $1 AND status = 'pending'`, d.disputeID,
+	).Scan(&pendingBy)
+	if err == nil {
+		if pendingBy == uid {
+			return c.JSON(http.StatusConflict, echo.Map{"error": "you already have a pending proposal"})
+		}
+		return c.JSON(http.StatusConflict, echo.Map{"error": "respond to the pending proposal with accept, counter or reject"})
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to check proposals"})
+	}
+
+	p, err := insertProposal(ctx, tx, d, uid, req)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not create proposal"})
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "commit failed"})
+	}
+	notifyProposal(d, uid, p, "New settlement proposal")
+	return c.JSON(http.StatusCreated, echo.Map{"proposal": p})
+}
+
+// GET /marketplace/disputes/:id/proposals
+func ListProposals(c echo.Context) error {
+	uid, ok := c.Get("user_id").(string)
+	if !ok || uid == "" {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "unauthorized"})
+	}
+	ctx := context.Background()
+	var buyerID, sellerID, stage string
+	var deadline *time.Time
+	err := db.Conn.QueryRow(ctx,
+		`SELECT o.buyer_id::text, o.seller_id::text, d.stage, d.mediation_deadline
+		 FROM disputes d JOIN orders o ON o.id = d.order_id WHERE d.id = $1`, c.Param("id"),
+	).Scan(&buyerID, &sellerID, &stage, &deadline)
+	if err != nil || (uid != buyerID && uid != sellerID) {
+		return c.JSON(http.StatusNotFound, echo.Map{"error": "dispute not found"})
+	}
+
+	rows, err := db.Conn.Query(ctx,
+		`SELECT id::text, proposer_id::text, refund_amount, COALESCE(note, ''), status, created_at, responded_at
+		 FROM dispute_proposals WHERE dispute_id = $1 ORDER BY created_at`, c.Param("id"),
+	)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not fetch proposals"})
+	}
+	defer rows.Close()
+	proposals := []SettlementProposal{}
+	for rows.Next() {
+		p := SettlementProposal{DisputeID: c.Param("id")}
+		if err := rows.Scan(&p.ID, &p.ProposerID, &p.RefundAmount, &p.Note, &p.Status, &p.CreatedAt, &p.RespondedAt); err != nil {
+			return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to read proposal"})
+		}
+		p.ProposerRole = orders.ActorSeller
+		if p.ProposerID == buyerID {
+			p.ProposerRole = orders.ActorBuyer
+		}
+		proposals = append(proposals, p)
+	}
+	return c.JSON(http.StatusOK, echo.Map{"stage": stage, "mediation_deadline": deadline, "proposals": proposals})
+}
+
+// lockPendingProposal locks a pending proposal addressed to uid
+func lockPendingProposal(ctx context.Context, tx pgx.Tx, d *disputeParty, proposalID, uid string) (*SettlementProposal, error) {
+	p := &SettlementProposal{ID: proposalID, DisputeID: d.disputeID}
+	err := tx.QueryRow(ctx,
+		`SELECT proposer_id::text, refund_amount, COALESCE(note, ''), status, created_at
+		 FROM dispute_proposals WHERE id = $1 AND dispute_id = $2 FOR UPDATE`, proposalID, d.disputeID,
+	).Scan(&p.ProposerID, &p.RefundAmount, &p.Note, &p.Status, &p.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	p.ProposerRole = d.role(p.ProposerID)
+	return p, nil
+}
+
+// respondToProposal loads the dispute and the pending proposal the caller
+// must answer. On failure it writes the response and returns a nil tx.
+func respondToProposal(ctx context.Context, c echo.Context, uid string) (pgx.Tx, *disputeParty, *SettlementProposal, error) {
+	tx, d, resp := loadDisputeForParty(ctx, c, uid)
+	if tx == nil {
+		return nil, nil, nil, resp
+	}
+	fail := func(status int, msg string) (pgx.Tx, *disputeParty, *SettlementProposal, error) {
+		tx.Rollback(ctx)
+		return nil, nil, nil, c.JSON(status, echo.Map{"error": msg})
+	}
+	if d.stage != DisputeStageMediation {
+		return fail(http.StatusConflict, "dispute has been escalated to an admin")
+	}
+	p, err := lockPendingProposal(ctx, tx, d, c.Param("proposal_id"), uid)
+	if err != nil {
+		return fail(http.StatusNotFound, "proposal not found")
+	}
+	if p.Status != ProposalPending {
+		return fail(http.StatusConflict, "proposal is no longer pending")
+	}
+	if p.ProposerID == uid {
+		return fail(http.StatusForbidden, "you cannot respond to your own proposal")
+	}
+	return tx, d, p, nil
+}
+
+func markProposal(ctx context.Context, tx pgx.Tx, proposalID, status string) error {
+	_, err := tx.Exec(ctx, `UPDATE dispute_proposals SET status = $2, responded_at = NOW() WHERE id = $1`, proposalID, status)
+	return err
+}
+
+// POST /marketplace/disputes/:id/proposals/:proposal_id/accept
+// Accepting settles the escrow as proposed and resolves the dispute.
+func AcceptProposal(c echo.Context) error {
+	uid, ok := c.Get("user_id").(string)
+	if !ok || uid == "" {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "unauthorized"})
+	}
+	ctx := context.Background()
+	tx, d, p, resp := respondToProposal(ctx, c, uid)
+	if tx == nil {
+		return resp
+	}
+	defer tx.Rollback(ctx)
+
+	s := Settlement{Mode: SettleSplit, RefundAmount: p.RefundAmount}
+	switch p.RefundAmount {
+	case 0:
+		s = Settlement{Mode: SettleRelease}
+	case d.orderAmount:
+		s = Settlement{Mode: SettleRefund}
+	}
+	result, err := SettleOrder(ctx, tx, d.orderID, d.role(uid), uid, s)
+	switch {
+	case errors.Is(err, ErrNotSettleable):
+		return c.JSON(http.StatusConflict, echo.Map{"error": "order cannot be settled in its current status"})
+	case errors.Is(err, ledger.ErrInsufficientFunds):
+		return c.JSON(http.StatusConflict, echo.Map{"error": "order escrow does not cover the order amount"})
+	case err != nil:
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to settle order"})
+	}
+
+	if err = markProposal(ctx, tx, p.ID, ProposalAccepted); err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to update proposal"})
+	}
+	notes := "Settled by agreement between buyer and seller"
+	if p.Note != "" {
+		notes += ": " + p.Note
+	}
+	_, err = tx.Exec(ctx,
+		`UPDATE disputes SET status = 'resolved', resolution = $2, notes = $3, resolved_at = NOW(),
+		        buyer_refund = $4, seller_payout = $5
+		 WHERE id = $1`,
+		d.disputeID, result.Mode, notes, result.BuyerRefund, result.SellerNet,
+	)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to resolve dispute"})
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "commit failed"})
+	}
+
+	// Both sides get the breakdown
+	ref := d.disputeID
+	meta := fmt.Sprintf(`{"proposal_id":%q,"buyer_refund":%d,"seller_net":%d,"platform_fee":%d}`,
+		p.ID, result.BuyerRefund, result.SellerNet, result.PlatformFee)
+	history := ""
+	if h, err := DisputeHistory(ctx, d.disputeID); err == nil && h != "" {
+		history = "\n\nDispute history:\n" + h
+	}
+	_ = alerts.CreateNotification(d.buyerID, "dispute:settled", "Dispute settled",
+		fmt.Sprintf("The settlement was accepted. You were refunded %d of %d.", result.BuyerRefund, result.OrderAmount)+history, &ref, &meta)
+	_ = alerts.CreateNotification(d.sellerID, "dispute:settled", "Dispute settled",
+		fmt.Sprintf("The settlement was accepted. You received %d (%d less %d platform fee).", result.SellerNet, result.SellerGross, result.PlatformFee)+history, &ref, &meta)
+
+	return c.JSON(http.StatusOK, echo.Map{"message": "settlement accepted", "settlement": result})
+}
+
+// POST /marketplace/disputes/:id/proposals/:proposal_id/counter
+// Replaces the pending proposal with the caller's own terms.
+func CounterProposal(c echo.Context) error {
+	uid, ok := c.Get("user_id").(string)
+	if !ok || uid == "" {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "unauthorized"})
+	}
+	var req proposalRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid payload"})
+	}
+	ctx := context.Background()
+	tx, d, p, resp := respondToProposal(ctx, c, uid)
+	if tx == nil {
+		return resp
+	}
+	defer tx.Rollback(ctx)
+
+	if msg := req.validate(d.orderAmount); msg != "" {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": msg})
+	}
+	if err := markProposal(ctx, tx, p.ID, ProposalCountered); err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to update proposal"})
+	}
+	counter, err := insertProposal(ctx, tx, d, uid, req)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not create proposal"})
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "commit failed"})
+	}
+	notifyProposal(d, uid, counter, "Settlement counter-offer")
+	return c.JSON(http.StatusCreated, echo.Map{"proposal": counter})
+}
+
+// POST /marketplace/disputes/:id/proposals/:proposal_id/reject
+func RejectProposal(c echo.Context) error {
+	uid, ok := c.Get("user_id").(string)
+	if !ok || uid == "" {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "unauthorized"})
+	}
+	ctx := context.Background()
+	tx, d, p, resp := respondToProposal(ctx, c, uid)
+	if tx == nil {
+		return resp
+	}
+	defer tx.Rollback(ctx)
+
+	if err := markProposal(ctx, tx, p.ID, ProposalRejected); err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to update proposal"})
+	}
+	_ = orders.LogEvent(ctx, tx, d.orderID, d.role(uid), uid, "settlement_rejected", map[string]any{
+		"dispute_id": d.disputeID, "proposal_id": p.ID,
+	})
+	if err := tx.Commit(ctx); err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "commit failed"})
+	}
+
+	ref := d.disputeID
+	meta := fmt.Sprintf(`{"proposal_id":%q}`, p.ID)
+	_ = alerts.CreateNotification(p.ProposerID, "dispute:proposal_rejected", "Settlement proposal rejected",
+		"Your settlement proposal was rejected. You can propose new terms or escalate to our team.", &ref, &meta)
+	return c.JSON(http.StatusOK, echo.Map{"message": "proposal rejected"})
+}
+
+// POST /marketplace/disputes/:id/escalate
+// Either party can hand the dispute to the admin team at any time.
+func EscalateDispute(c echo.Context) error {
+	uid, ok := c.Get("user_id").(string)
+	if !ok || uid == "" {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "unauthorized"})
+	}
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	_ = c.Bind(&req)
+
+	ctx := context.Background()
+	tx, d, resp := loadDisputeForParty(ctx, c, uid)
+	if tx == nil {
+		return resp
+	}
+	defer tx.Rollback(ctx)
+
+	if d.stage == DisputeStageEscalated {
+		return c.JSON(http.StatusConflict, echo.Map{"error": "dispute is already escalated"})
+	}
+	reason := strings.TrimSpace(req.Reason)
+	if reason == "" {
+		reason = "requested by " + d.role(uid)
+	}
+	if err := escalateDispute(ctx, tx, d, d.role(uid), uid, reason); err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to escalate dispute"})
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "commit failed"})
+	}
+	notifyEscalation(d, uid, reason)
+	return c.JSON(http.StatusOK, echo.Map{"message": "dispute escalated", "dispute_id": d.disputeID})
+}
+
+// escalateDispute moves a dispute to the admin queue and expires any pending proposal
+func escalateDispute(ctx context.Context, tx pgx.Tx, d *disputeParty, actorType, actorID, reason string) error {
+	if _, err := tx.Exec(ctx,
+		`UPDATE disputes SET stage = 'escalated', escalated_at = NOW(), escalation_reason = $2 WHERE id = $1`,
+		d.disputeID, reason,
+	); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx,
+		`UPDATE dispute_proposals SET status = 'expired', responded_at = NOW() WHERE dispute_id = $1 AND status = 'pending'`,
+		d.disputeID,
+	); err != nil {
+		return err
+	}
+	return orders.LogEvent(ctx, tx, d.orderID, actorType, actorID, "dispute_escalated", map[string]any{
+		"dispute_id": d.disputeID, "reason": reason,
+	})
+}
+
+// notifyEscalation tells the parties (except the one who escalated) and the
+// admins. escalatedBy is the escalating user's id, or orders.ActorSystem when
+// the mediation window ran out.
+func notifyEscalation(d *disputeParty, escalatedBy, reason string) {
+	ref := d.disputeID
+	meta := "{}"
+	for _, uid := range []string{d.buyerID, d.sellerID} {
+		if uid == escalatedBy {
+			continue
+		}
+		_ = alerts.CreateNotification(uid, "dispute:escalated", "Dispute escalated",
+			"The dispute has been handed to our team for a decision: "+reason, &ref, &meta)
+	}
+	_ = alerts.EnqueueAdminAlert(escalatedBy, "info", "Dispute escalated: order "+d.orderID+" ("+reason+")")
+}
+
+// escalateExpiredMediations hands disputes whose mediation window has passed to the admins
+func escalateExpiredMediations(ctx context.Context) error {
+	rows, err := db.Conn.Query(ctx,
+		`SELECT id::text FROM disputes
+		 WHERE status = 'open' AND stage = 'mediation' AND mediation_deadline <= NOW()
+		 LIMIT 200`,
+	)
+	if err != nil {
+		return err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		tx, err := db.Conn.Begin(ctx)
+		if err != nil {
+			return err
+		}
+		d, err := lockDispute(ctx, tx, id)
+		if err != nil || d.status != "open" || d.stage != DisputeStageMediation {
+			tx.Rollback(ctx)
+			continue
+		}
+		reason := "no agreement within the mediation window"
+		if err = escalateDispute(ctx, tx, d, orders.ActorSystem, "", reason); err == nil {
+			err = tx.Commit(ctx)
+		}
+		tx.Rollback(ctx)
+		if err != nil {
+			log.Printf("[disputes] escalation failed: dispute=%s err=%v", id, err)
+			continue
+		}
+		notifyEscalation(d, orders.ActorSystem, reason)
+	}
+	return nil
+}
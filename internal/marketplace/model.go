@@ -11,7 +11,10 @@ type Service struct {
     Price       int64     `json:"price"`
     Category    string    `json:"category,omitempty"`
     DeliveryTimeDays int   `json:"delivery_time_days,omitempty"`
-    Status      string    `json:"status,omitempty"`
+    RevisionsIncluded  int    `json:"revisions_included"`
+    ExtraRevisionPrice *int64 `json:"extra_revision_price,omitempty"`
+    Status      string    `json:"status,omitempty"` // active, paused, suspended, pending or deleted
+    Version     int       `json:"version"`          // bumped on every edit
     CreatedAt   time.Time `json:"created_at"`
 }
 
@@ -24,8 +27,14 @@ type ServiceSummary struct {
     Price       int64     `json:"price"`
     Category    string    `json:"category,omitempty"`
     DeliveryTimeDays int   `json:"delivery_time_days,omitempty"`
+    RevisionsIncluded  int    `json:"revisions_included"`
+    ExtraRevisionPrice *int64 `json:"extra_revision_price,omitempty"`
     Status      string    `json:"status,omitempty"`
     AvgRating   float64   `json:"avg_rating"`
+    StartingAt  int64     `json:"starting_at"` // cheapest package, or price when there are none
+    Version     int       `json:"version"`
+    Rank        *float64  `json:"rank,omitempty"`      // search relevance, set when searching with q
+    Highlight   *ServiceHighlight `json:"highlight,omitempty"` // matched words marked in title and description
     CreatedAt   time.Time `json:"created_at"`
 }
 
@@ -36,6 +45,26 @@ type Order struct {
     BuyerID    string    `json:"buyer_id"`
     SellerID   string    `json:"seller_id"`
     Amount     int64     `json:"amount"`
+    PlatformFee   int64  `json:"platform_fee"`
+    FeePercentBps int    `json:"fee_percent_bps"`
+    FeeFixed      int64  `json:"fee_fixed"`
+    SellerNet     int64  `json:"seller_net"` // amount paid to the seller on release
     Status     string    `json:"status"` // pending_acceptance, in_progress, delivered, declined, completed, canceled
+    Version    int64     `json:"version"`  // bumped on every transition; send as If-Match
+    RefundedAmount int64 `json:"refunded_amount"`
+    RevisionsIncluded  int    `json:"revisions_included"`
+    RevisionsUsed      int    `json:"revisions_used"`
+    ExtraRevisionPrice *int64 `json:"extra_revision_price,omitempty"` // nil when extra revisions are not offered
+    PackageTier *string         `json:"package_tier,omitempty"`
+    Selection   *OrderSelection `json:"selection,omitempty"` // package and extras as priced when ordered
+    CustomOfferID *string       `json:"custom_offer_id,omitempty"` // set when placed by accepting a custom offer
+    ServiceTitle   *string `json:"service_title,omitempty"`   // as listed when ordered; later edits do not change it
+    ServicePrice   *int64  `json:"service_price,omitempty"`   // base price paid before extras
+    ServiceVersion *int    `json:"service_version,omitempty"` // service version the buyer saw
+    RequirementsCompletedAt *time.Time `json:"requirements_completed_at,omitempty"` // nil while the buyer owes answers
+    DeliveryDays int        `json:"delivery_days"`
+    DueAt        *time.Time `json:"due_at,omitempty"` // set on acceptance when the service has a delivery time
+    DeliveredOnTime *bool   `json:"delivered_on_time,omitempty"`
+    DeliveredAt *time.Time `json:"delivered_at,omitempty"`
     CreatedAt  time.Time `json:"created_at"`
 }
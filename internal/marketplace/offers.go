@@ -0,0 +1,347 @@
+package marketplace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/labstack/echo/v4"
+	"github.com/sudo-init-do/crafthub/internal/alerts"
+	"github.com/sudo-init-do/crafthub/internal/db"
+	"github.com/sudo-init-do/crafthub/internal/ledger"
+	"github.com/sudo-init-do/crafthub/internal/messaging"
+)
+
+// Custom offer statuses. Pending offers past expires_at read as expired.
+const (
+	OfferPending   = "pending"
+	OfferAccepted  = "accepted"
+	OfferDeclined  = "declined"
+	OfferWithdrawn = "withdrawn"
+	OfferExpired   = "expired"
+)
+
+const (
+	offerScopeMaxLen = 5000
+	defaultOfferTTL  = 72 * time.Hour
+	maxOfferTTL      = 30 * 24 * time.Hour
+)
+
+// CustomOffer is bespoke work a seller offers a buyer from a message thread
+type CustomOffer struct {
+	ID                string     `json:"id"`
+	ThreadOrderID     string     `json:"thread_order_id"` // the order whose conversation it was sent in
+	ServiceID         string     `json:"service_id"`
+	SellerID          string     `json:"seller_id"`
+	BuyerID           string     `json:"buyer_id"`
+	Scope             string     `json:"scope"`
+	Price             int64      `json:"price"`
+	DeliveryDays      int        `json:"delivery_days"`
+	RevisionsIncluded int        `json:"revisions_included"`
+	Status            string     `json:"status"`
+	ExpiresAt         time.Time  `json:"expires_at"`
+	OrderID           *string    `json:"order_id,omitempty"` // the order placed when accepted
+	CreatedAt         time.Time  `json:"created_at"`
+	RespondedAt       *time.Time `json:"responded_at,omitempty"`
+}
+
+// offerColumns is the select list scanned by scanOffer
+const offerColumns = `id::text, thread_order_id::text, service_id::text, seller_id::text, buyer_id::text, scope, price,
+	delivery_days, revisions_included,
+	CASE WHEN status = 'pending' AND expires_at <= NOW() THEN 'expired' ELSE status END,
+	expires_at, order_id::text, created_at, responded_at`
+
+func scanOffer(row pgx.Row) (*CustomOffer, error) {
+	var o CustomOffer
+	err := row.Scan(&o.ID, &o.ThreadOrderID, &o.ServiceID, &o.SellerID, &o.BuyerID, &o.Scope, &o.Price,
+		&o.DeliveryDays, &o.RevisionsIncluded, &o.Status, &o.ExpiresAt, &o.OrderID, &o.CreatedAt, &o.RespondedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &o, nil
+}
+
+// broadcastOffer pushes the offer to the thread's order hub as a rich event
+func broadcastOffer(offer *CustomOffer, kind string, message echo.Map) {
+	if message == nil {
+		message = echo.Map{"order_id": offer.ThreadOrderID}
+	}
+	message["kind"] = kind
+	message["offer"] = offer
+	messaging.BroadcastNewMessage(offer.ThreadOrderID, message)
+}
+
+// POST /marketplace/orders/:id/offers
+// The seller of the thread's order sends its buyer a custom offer.
+func SendOffer(c echo.Context) error {
+	uid, ok := c.Get("user_id").(string)
+	if !ok || uid == "" {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "unauthorized"})
+	}
+	var req struct {
+		Scope             string     `json:"scope"`
+		Price             int64      `json:"price"`
+		DeliveryDays      int        `json:"delivery_days"`
+		RevisionsIncluded int        `json:"revisions_included"`
+		ExpiresAt         *time.Time `json:"expires_at"` // defaults to 72 hours from now
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid payload"})
+	}
+	req.Scope = strings.TrimSpace(req.Scope)
+	if req.Scope == "" || len(req.Scope) > offerScopeMaxLen {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": fmt.Sprintf("scope is required and at most %d characters", offerScopeMaxLen)})
+	}
+	if req.Price <= 0 || req.DeliveryDays < 0 || req.RevisionsIncluded < 0 {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "price must be > 0 and delivery_days and revisions_included >= 0"})
+	}
+	now := time.Now()
+	expiresAt := now.Add(defaultOfferTTL)
+	if req.ExpiresAt != nil {
+		expiresAt = *req.ExpiresAt
+	}
+	if !expiresAt.After(now) || expiresAt.Sub(now) > maxOfferTTL {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "expires_at must be in the future and within 30 days"})
+	}
+
+	ctx := context.Background()
+	offer := CustomOffer{
+		ID: uuid.New().String(), ThreadOrderID: c.Param("id"), SellerID: uid, Scope: req.Scope, Price: req.Price,
+		DeliveryDays: req.DeliveryDays, RevisionsIncluded: req.RevisionsIncluded, Status: OfferPending, ExpiresAt: expiresAt,
+	}
+	var sellerID string
+	err := db.Conn.QueryRow(ctx,
+		`SELECT service_id::text, buyer_id::text, seller_id::text FROM orders WHERE id = $1`, offer.ThreadOrderID,
+	).Scan(&offer.ServiceID, &offer.BuyerID, &sellerID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return c.JSON(http.StatusNotFound, echo.Map{"error": "order not found"})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to fetch order"})
+	}
+	if uid != sellerID {
+		if uid == offer.BuyerID {
+			return c.JSON(http.StatusForbidden, echo.Map{"error": "only the seller can send a custom offer"})
+		}
+		return c.JSON(http.StatusNotFound, echo.Map{"error": "order not found"})
+	}
+
+	tx, err := db.Conn.Begin(ctx)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "transaction start failed"})
+	}
+	defer tx.Rollback(ctx)
+
+	if err = tx.QueryRow(ctx,
+		`INSERT INTO custom_offers (id, thread_order_id, service_id, seller_id, buyer_id, scope, price, delivery_days, revisions_included, expires_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING created_at`,
+		offer.ID, offer.ThreadOrderID, offer.ServiceID, offer.SellerID, offer.BuyerID, offer.Scope, offer.Price,
+		offer.DeliveryDays, offer.RevisionsIncluded, offer.ExpiresAt,
+	).Scan(&offer.CreatedAt); err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to create offer"})
+	}
+	// The offer also lands in the conversation as a message
+	msgID := uuid.New().String()
+	content := fmt.Sprintf("Custom offer: %s (price %d, %d day delivery)", offer.Scope, offer.Price, offer.DeliveryDays)
+	var msgAt time.Time
+	if err = tx.QueryRow(ctx,
+		`INSERT INTO messages (id, order_id, sender_id, recipient_id, content, offer_id)
+		 VALUES ($1, $2, $3, $4, $5, $6) RETURNING created_at`,
+		msgID, offer.ThreadOrderID, uid, offer.BuyerID, content, offer.ID,
+	).Scan(&msgAt); err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to create offer"})
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "commit failed"})
+	}
+
+	broadcastOffer(&offer, "custom_offer", echo.Map{
+		"id":           msgID,
+		"order_id":     offer.ThreadOrderID,
+		"sender_id":    uid,
+		"recipient_id": offer.BuyerID,
+		"content":      content,
+		"created_at":   msgAt.UTC().Format(time.RFC3339),
+	})
+	ref := offer.ThreadOrderID
+	meta := fmt.Sprintf(`{"offer_id":%q,"price":%d}`, offer.ID, offer.Price)
+	_ = alerts.CreateNotification(offer.BuyerID, "offer:new", "New custom offer", content, &ref, &meta)
+
+	return c.JSON(http.StatusCreated, echo.Map{"offer": offer, "message_id": msgID})
+}
+
+// GET /marketplace/orders/:id/offers
+// Custom offers sent in the order's thread, newest first.
+func ListOffers(c echo.Context) error {
+	o, err := orderForViewer(c)
+	if o == nil {
+		return err
+	}
+	rows, err := db.Conn.Query(context.Background(),
+		`SELECT `+offerColumns+` FROM custom_offers WHERE thread_order_id = $1 ORDER BY created_at DESC`, o.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to fetch offers"})
+	}
+	defer rows.Close()
+
+	offers := []CustomOffer{}
+	for rows.Next() {
+		offer, err := scanOffer(rows)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to parse offer"})
+		}
+		offers = append(offers, *offer)
+	}
+	return c.JSON(http.StatusOK, echo.Map{"offers": offers})
+}
+
+// lockOffer loads a pending offer for update if uid is the given party.
+// Writes the error response and returns nil otherwise.
+func lockOffer(c echo.Context, ctx context.Context, tx pgx.Tx, uid string, asBuyer bool) (*CustomOffer, error) {
+	offer, err := scanOffer(tx.QueryRow(ctx,
+		`SELECT `+offerColumns+` FROM custom_offers WHERE id = $1 FOR UPDATE`, c.Param("id")))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, c.JSON(http.StatusNotFound, echo.Map{"error": "offer not found"})
+	}
+	if err != nil {
+		return nil, c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to fetch offer"})
+	}
+	if uid != offer.BuyerID && uid != offer.SellerID {
+		return nil, c.JSON(http.StatusNotFound, echo.Map{"error": "offer not found"})
+	}
+	if asBuyer && uid != offer.BuyerID {
+		return nil, c.JSON(http.StatusForbidden, echo.Map{"error": "only the buyer can respond to this offer"})
+	}
+	if !asBuyer && uid != offer.SellerID {
+		return nil, c.JSON(http.StatusForbidden, echo.Map{"error": "only the seller can withdraw this offer"})
+	}
+	if offer.Status != OfferPending {
+		return nil, c.JSON(http.StatusConflict, echo.Map{"error": "offer is " + offer.Status})
+	}
+	return offer, nil
+}
+
+// POST /marketplace/offers/:id/accept
+// Buyer accepts a custom offer. The order is placed and funds held exactly
+// as CreateOrder does, at the offer's price and terms.
+func AcceptOffer(c echo.Context) error {
+	uid, ok := c.Get("user_id").(string)
+	if !ok || uid == "" {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "unauthorized"})
+	}
+
+	ctx := context.Background()
+	tx, err := db.Conn.Begin(ctx)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "transaction start failed"})
+	}
+	defer tx.Rollback(ctx)
+
+	offer, err := lockOffer(c, ctx, tx, uid, true)
+	if offer == nil {
+		return err
+	}
+
+	no := &newOrder{
+		ServiceID: offer.ServiceID, BuyerID: offer.BuyerID, SellerID: offer.SellerID,
+		Amount: offer.Price, DeliveryDays: offer.DeliveryDays, RevisionsIncluded: offer.RevisionsIncluded,
+		CustomOfferID: &offer.ID, ServicePrice: offer.Price,
+		Details: map[string]any{"custom_offer_id": offer.ID},
+	}
+	var status string
+	if err = tx.QueryRow(ctx,
+		`SELECT COALESCE(s.category, ''), COALESCE(u.role, ''), s.title, s.version, COALESCE(s.status, 'active')
+		 FROM services s JOIN users u ON u.id = s.user_id WHERE s.id = $1`, offer.ServiceID,
+	).Scan(&no.Category, &no.SellerRole, &no.ServiceTitle, &no.ServiceVersion, &status); err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to fetch service"})
+	}
+	// A paused service still honours offers its seller sent
+	if status == ServiceSuspended || status == ServiceDeleted {
+		return c.JSON(http.StatusConflict, echo.Map{"error": "service is no longer available"})
+	}
+	quote, err := placeOrder(ctx, tx, no)
+	if errors.Is(err, ledger.ErrInsufficientFunds) {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "insufficient available balance"})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to create order"})
+	}
+	if err = tx.QueryRow(ctx,
+		`UPDATE custom_offers SET status = 'accepted', order_id = $2, responded_at = NOW() WHERE id = $1 RETURNING responded_at`,
+		offer.ID, no.ID,
+	).Scan(&offer.RespondedAt); err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to accept offer"})
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "commit failed"})
+	}
+	offer.Status, offer.OrderID = OfferAccepted, &no.ID
+
+	broadcastOffer(offer, "custom_offer_accepted", nil)
+	ref := no.ID
+	meta := fmt.Sprintf(`{"offer_id":%q,"amount":%d}`, offer.ID, offer.Price)
+	_ = alerts.CreateNotification(offer.SellerID, "offer:accepted", "Custom offer accepted",
+		"The buyer accepted your custom offer. Accept the new order to start work.", &ref, &meta)
+
+	return c.JSON(http.StatusCreated, echo.Map{
+		"order_id": no.ID,
+		"fees":     quote,
+		"offer":    offer,
+		"message":  "Offer accepted. Funds reserved pending seller acceptance.",
+	})
+}
+
+// POST /marketplace/offers/:id/decline
+func DeclineOffer(c echo.Context) error {
+	return closeOffer(c, OfferDeclined)
+}
+
+// POST /marketplace/offers/:id/withdraw
+func WithdrawOffer(c echo.Context) error {
+	return closeOffer(c, OfferWithdrawn)
+}
+
+// closeOffer ends a pending offer without an order: declined by the buyer or
+// withdrawn by the seller
+func closeOffer(c echo.Context, status string) error {
+	uid, ok := c.Get("user_id").(string)
+	if !ok || uid == "" {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "unauthorized"})
+	}
+
+	ctx := context.Background()
+	tx, err := db.Conn.Begin(ctx)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "transaction start failed"})
+	}
+	defer tx.Rollback(ctx)
+
+	offer, err := lockOffer(c, ctx, tx, uid, status == OfferDeclined)
+	if offer == nil {
+		return err
+	}
+	if err = tx.QueryRow(ctx,
+		`UPDATE custom_offers SET status = $2, responded_at = NOW() WHERE id = $1 RETURNING responded_at`,
+		offer.ID, status,
+	).Scan(&offer.RespondedAt); err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to update offer"})
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "commit failed"})
+	}
+	offer.Status = status
+
+	broadcastOffer(offer, "custom_offer_"+status, nil)
+	if status == OfferDeclined {
+		ref := offer.ThreadOrderID
+		meta := fmt.Sprintf(`{"offer_id":%q}`, offer.ID)
+		_ = alerts.CreateNotification(offer.SellerID, "offer:declined", "Custom offer declined",
+			"The buyer declined your custom offer.", &ref, &meta)
+	}
+	return c.JSON(http.StatusOK, echo.Map{"offer": offer})
+}
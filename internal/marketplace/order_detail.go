@@ -0,0 +1,81 @@
+package marketplace
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/labstack/echo/v4"
+	"github.com/sudo-init-do/crafthub/internal/db"
+	"github.com/sudo-init-do/crafthub/internal/orders"
+)
+
+// orderColumns is the select list scanned by scanOrder
+const orderColumns = `id, service_id, buyer_id, seller_id, amount, platform_fee, COALESCE(fee_percent_bps, 0), COALESCE(fee_fixed, 0),
+	status, version, COALESCE(refunded_amount, 0), revisions_included, revisions_used, extra_revision_price,
+	package_tier, selection, custom_offer_id::text, service_title, service_price, service_version, requirements_completed_at, delivery_days, due_at, delivered_on_time, delivered_at, created_at`
+
+func scanOrder(row pgx.Row) (*Order, error) {
+	var o Order
+	err := row.Scan(&o.ID, &o.ServiceID, &o.BuyerID, &o.SellerID, &o.Amount, &o.PlatformFee, &o.FeePercentBps, &o.FeeFixed,
+		&o.Status, &o.Version, &o.RefundedAmount, &o.RevisionsIncluded, &o.RevisionsUsed, &o.ExtraRevisionPrice,
+		&o.PackageTier, &o.Selection, &o.CustomOfferID, &o.ServiceTitle, &o.ServicePrice, &o.ServiceVersion, &o.RequirementsCompletedAt, &o.DeliveryDays, &o.DueAt, &o.DeliveredOnTime, &o.DeliveredAt, &o.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	o.SellerNet = o.Amount - o.PlatformFee
+	return &o, nil
+}
+
+// orderForViewer loads the order in the URL if the caller is its buyer, its
+// seller or an admin. Writes the error response and returns nil otherwise.
+func orderForViewer(c echo.Context) (*Order, error) {
+	uid, ok := c.Get("user_id").(string)
+	if !ok || uid == "" {
+		return nil, c.JSON(http.StatusUnauthorized, echo.Map{"error": "unauthorized"})
+	}
+	o, err := scanOrder(db.Conn.QueryRow(context.Background(),
+		`SELECT `+orderColumns+` FROM orders WHERE id = $1`, c.Param("id")))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, c.JSON(http.StatusNotFound, echo.Map{"error": "order not found"})
+	}
+	if err != nil {
+		return nil, c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to fetch order"})
+	}
+	role, _ := c.Get("role").(string)
+	if uid != o.BuyerID && uid != o.SellerID && role != "admin" {
+		return nil, c.JSON(http.StatusNotFound, echo.Map{"error": "order not found"})
+	}
+	return o, nil
+}
+
+// GET /marketplace/orders/:id
+func GetOrder(c echo.Context) error {
+	o, err := orderForViewer(c)
+	if o == nil {
+		return err
+	}
+	var disputeID string
+	_ = db.Conn.QueryRow(context.Background(),
+		`SELECT id::text FROM disputes WHERE order_id = $1 AND status = 'open'`, o.ID).Scan(&disputeID)
+	resp := echo.Map{"order": o}
+	if disputeID != "" {
+		resp["open_dispute_id"] = disputeID
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
+// GET /marketplace/orders/:id/timeline
+// Status changes, money movements, message activity and dispute events, oldest first.
+func GetOrderTimeline(c echo.Context) error {
+	o, err := orderForViewer(c)
+	if o == nil {
+		return err
+	}
+	items, err := orders.Timeline(context.Background(), o.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to build timeline"})
+	}
+	return c.JSON(http.StatusOK, echo.Map{"order": o, "timeline": items})
+}
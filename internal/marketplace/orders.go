@@ -2,14 +2,20 @@ package marketplace
 
 import (
     "context"
-    "database/sql"
+    "encoding/json"
+    "errors"
     "net/http"
+    "strconv"
+    "strings"
     "time"
 
     "github.com/google/uuid"
+    "github.com/jackc/pgx/v5"
     "github.com/labstack/echo/v4"
     "github.com/sudo-init-do/crafthub/internal/db"
-    "github.com/sudo-init-do/crafthub/internal/alerts"
+    "github.com/sudo-init-do/crafthub/internal/fees"
+    "github.com/sudo-init-do/crafthub/internal/ledger"
+    "github.com/sudo-init-do/crafthub/internal/orders"
 )
 
 // =========================
@@ -22,26 +28,66 @@ func CreateOrder(c echo.Context) error {
 	}
 
 	var req struct {
-		ServiceID string `json:"service_id"`
+		ServiceID     string   `json:"service_id"`
+		Package       string   `json:"package"` // tier or package id; required when the service has packages
+		Extras        []string `json:"extras"`  // service extra ids
+		ExpectedTotal *int64   `json:"expected_total"` // optional; rejects the order if the catalog changed
+		Answers       map[string]json.RawMessage `json:"answers"` // requirement answers keyed by question id
 	}
 	if err := c.Bind(&req); err != nil || req.ServiceID == "" {
 		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid service_id"})
 	}
 
-    var sellerID string
+    var sellerID, category, sellerRole, title, status string
     var price int64
+    var revisionsIncluded, deliveryDays, serviceVersion int
+    var extraRevisionPrice *int64
+    var questions []RequirementQuestion
     err := db.Conn.QueryRow(context.Background(),
-        `SELECT user_id, price FROM services WHERE id = $1`,
+        `SELECT s.user_id, s.price, COALESCE(s.category, ''), COALESCE(u.role, ''), s.revisions_included, s.extra_revision_price, COALESCE(s.delivery_time_days, 0),
+                s.requirements, s.title, s.version, COALESCE(s.status, 'active')
+         FROM services s JOIN users u ON u.id = s.user_id
+         WHERE s.id = $1`,
         req.ServiceID,
-    ).Scan(&sellerID, &price)
+    ).Scan(&sellerID, &price, &category, &sellerRole, &revisionsIncluded, &extraRevisionPrice, &deliveryDays, &questions, &title, &serviceVersion, &status)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && status == ServiceDeleted) {
+		return c.JSON(http.StatusNotFound, echo.Map{"error": "service not found"})
+	}
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to fetch service"})
 	}
+	if status != ServiceActive {
+		return c.JSON(http.StatusConflict, echo.Map{"error": "service is not taking orders", "status": status})
+	}
 
 	if sellerID == buyerID {
 		return c.JSON(http.StatusBadRequest, echo.Map{"error": "you cannot order your own service"})
 	}
 
+    // Price the chosen package and extras against the current catalog
+    sel, err := priceSelection(context.Background(), req.ServiceID, price, deliveryDays, revisionsIncluded, req.Package, req.Extras)
+    if errors.Is(err, errInvalidSelection) {
+        return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+    }
+    if err != nil {
+        return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to fetch service packages"})
+    }
+    if req.ExpectedTotal != nil && *req.ExpectedTotal != sel.Total {
+        return c.JSON(http.StatusConflict, echo.Map{"error": "price has changed", "selection": sel})
+    }
+    price, deliveryDays, revisionsIncluded = sel.Total, sel.DeliveryDays, sel.RevisionsIncluded
+    var packageID, packageTier *string
+    if sel.Package != nil {
+        packageID, packageTier = &sel.Package.ID, &sel.Package.Tier
+    }
+
+    // Answers may be partial; the delivery clock waits until they are complete
+    answers, msg := validateAnswers(questions, req.Answers)
+    if msg != "" {
+        return c.JSON(http.StatusBadRequest, echo.Map{"error": msg})
+    }
+    missing := missingAnswers(questions, answers)
+
     var balance int64
     var locked int64
     err = db.Conn.QueryRow(context.Background(),
@@ -64,35 +110,20 @@ func CreateOrder(c echo.Context) error {
     }
     defer tx.Rollback(context.Background())
 
-    orderID := uuid.New().String()
-
-    // Reserve funds by increasing locked_amount (do not deduct balance yet)
-    _, err = tx.Exec(context.Background(),
-        `UPDATE wallets SET locked_amount = locked_amount + $1 WHERE user_id = $2`,
-        price, buyerID,
-    )
-    if err != nil {
-        return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to reserve funds"})
+    no := &newOrder{
+        ServiceID: req.ServiceID, BuyerID: buyerID, SellerID: sellerID, Category: category, SellerRole: sellerRole,
+        Amount: price, RevisionsIncluded: revisionsIncluded, ExtraRevisionPrice: extraRevisionPrice, DeliveryDays: deliveryDays,
+        PackageID: packageID, PackageTier: packageTier, Selection: sel,
+        ServiceTitle: title, ServicePrice: sel.BasePrice, ServiceVersion: serviceVersion,
+        Requirements: questions, Answers: answers, RequirementsComplete: len(missing) == 0,
+        Details: map[string]any{"package": packageTier, "extras": len(sel.Extras), "requirements_missing": len(missing)},
     }
-
-    // Create order in pending_acceptance
-    _, err = tx.Exec(context.Background(),
-        `INSERT INTO orders (id, service_id, buyer_id, seller_id, amount, status, created_at)
-         VALUES ($1, $2, $3, $4, $5, 'pending_acceptance', $6)`,
-        orderID, req.ServiceID, buyerID, sellerID, price, time.Now(),
-    )
-    if err != nil {
-        return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to create order"})
+    quote, err := placeOrder(context.Background(), tx, no)
+    if errors.Is(err, ledger.ErrInsufficientFunds) {
+        return c.JSON(http.StatusBadRequest, echo.Map{"error": "insufficient available balance"})
     }
-
-    // Log a pending hold transaction tied to this order
-    _, err = tx.Exec(context.Background(),
-        `INSERT INTO transactions (user_id, amount, type, status, reference, created_at)
-         VALUES ($1, $2, 'debit', 'pending_hold', $3, $4)`,
-        buyerID, price, orderID, time.Now(),
-    )
     if err != nil {
-        return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to record hold"})
+        return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to create order"})
     }
 
     if err = tx.Commit(context.Background()); err != nil {
@@ -100,252 +131,110 @@ func CreateOrder(c echo.Context) error {
     }
 
     return c.JSON(http.StatusCreated, echo.Map{
-        "order_id": orderID,
+        "order_id":  no.ID,
+        "fees":      quote,
+        "selection": sel,
+        "requirements_missing": missing,
         "message":  "Order created. Funds reserved pending seller acceptance.",
     })
 }
 
-// =========================
-// AcceptOrder - Seller accepts order
-// =========================
-func AcceptOrder(c echo.Context) error {
-    sellerID, ok := c.Get("user_id").(string)
-    if !ok || sellerID == "" {
-        return c.JSON(http.StatusUnauthorized, echo.Map{"error": "unauthorized"})
-    }
+// newOrder is an order about to be placed against the buyer's wallet
+type newOrder struct {
+    ID                 string // assigned by placeOrder
+    ServiceID          string
+    BuyerID            string
+    SellerID           string
+    Category           string
+    SellerRole         string
+    Amount             int64
+    RevisionsIncluded  int
+    ExtraRevisionPrice *int64
+    DeliveryDays       int
+    PackageID          *string
+    PackageTier        *string
+    Selection          *OrderSelection
+    CustomOfferID      *string
+    ServiceTitle       string // snapshot of the listing the buyer agreed to
+    ServicePrice       int64
+    ServiceVersion     int
+    Requirements       []RequirementQuestion // nil when the order asks for nothing
+    Answers            map[string]any
+    RequirementsComplete bool
+    Details            map[string]any // extra fields for the "created" event
+}
 
-    orderID := c.Param("id")
-    if orderID == "" {
-        return c.JSON(http.StatusBadRequest, echo.Map{"error": "missing order id in URL"})
-    }
-    // Fetch order details
-    var buyerID string
-    var amount int64
-    var status string
-    err := db.Conn.QueryRow(context.Background(),
-        `SELECT buyer_id, amount, status FROM orders WHERE id = $1 AND seller_id = $2`,
-        orderID, sellerID,
-    ).Scan(&buyerID, &amount, &status)
-    if err != nil {
-        if err == sql.ErrNoRows {
-            return c.JSON(http.StatusNotFound, echo.Map{"error": "order not found or not yours"})
+// placeOrder fixes the platform fee, inserts the order in pending_acceptance
+// and holds the buyer's funds inside tx. Returns ledger.ErrInsufficientFunds
+// when the buyer cannot cover the amount.
+func placeOrder(ctx context.Context, tx pgx.Tx, o *newOrder) (fees.Quote, error) {
+    o.ID = uuid.New().String()
+    now := time.Now()
+    var completedAt *time.Time
+    if o.RequirementsComplete || len(o.Requirements) == 0 {
+        completedAt = &now
+    }
+    var requirements, answers []byte
+    if len(o.Requirements) > 0 {
+        var err error
+        if requirements, err = json.Marshal(o.Requirements); err != nil {
+            return fees.Quote{}, err
+        }
+        if answers, err = json.Marshal(o.Answers); err != nil {
+            return fees.Quote{}, err
         }
-        return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to fetch order"})
-    }
-
-    if status != "pending_acceptance" {
-        return c.JSON(http.StatusBadRequest, echo.Map{"error": "order not awaiting acceptance"})
-    }
-
-    // Begin transaction: convert hold to debit and move to escrow; set status in_progress
-    tx, err := db.Conn.Begin(context.Background())
-    if err != nil {
-        return c.JSON(http.StatusInternalServerError, echo.Map{"error": "transaction start failed"})
-    }
-    defer tx.Rollback(context.Background())
-
-    // Ensure buyer has the held amount
-    var balance int64
-    var locked int64
-    err = tx.QueryRow(context.Background(), `SELECT balance, locked_amount FROM wallets WHERE user_id = $1 FOR UPDATE`, buyerID).Scan(&balance, &locked)
-    if err != nil {
-        return c.JSON(http.StatusInternalServerError, echo.Map{"error": "buyer wallet not found"})
-    }
-    if locked < amount {
-        return c.JSON(http.StatusBadRequest, echo.Map{"error": "held funds unavailable"})
     }
 
-    // Convert hold to debit: decrease locked_amount, decrease balance, increase escrow
-    _, err = tx.Exec(context.Background(),
-        `UPDATE wallets SET locked_amount = locked_amount - $1, balance = balance - $1, escrow = escrow + $1 WHERE user_id = $2`,
-        amount, buyerID,
-    )
+    // Platform fee is fixed at order time and deducted from the seller at release
+    quote, err := fees.QuoteFor(ctx, tx, o.Category, o.SellerRole, o.Amount, now)
     if err != nil {
-        return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to convert hold to escrow"})
+        return quote, err
     }
 
-    // Update order status to in_progress
-    _, err = tx.Exec(context.Background(),
-        `UPDATE orders SET status = 'in_progress', updated_at = NOW() WHERE id = $1`,
-        orderID,
+    _, err = tx.Exec(ctx,
+        `INSERT INTO orders (id, service_id, buyer_id, seller_id, amount, platform_fee, fee_schedule_id, fee_percent_bps, fee_fixed,
+                             revisions_included, extra_revision_price, delivery_days, package_id, package_tier, selection, custom_offer_id,
+                             requirements, answers, requirements_completed_at, service_title, service_price, service_version, status, created_at)
+         VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, '')::uuid, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, 'pending_acceptance', $23)`,
+        o.ID, o.ServiceID, o.BuyerID, o.SellerID, o.Amount, quote.Fee, quote.ScheduleID, quote.PercentBps, quote.FixedAmount,
+        o.RevisionsIncluded, o.ExtraRevisionPrice, o.DeliveryDays, o.PackageID, o.PackageTier, o.Selection, o.CustomOfferID,
+        requirements, answers, completedAt, o.ServiceTitle, o.ServicePrice, o.ServiceVersion, now,
     )
     if err != nil {
-        return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to update order status"})
+        return quote, err
     }
 
-    // Update the pending hold transaction to 'debited'
-    _, err = tx.Exec(context.Background(),
-        `UPDATE transactions SET status = 'debited' WHERE user_id = $1 AND reference = $2 AND status = 'pending_hold'`,
-        buyerID, orderID,
-    )
-    if err != nil {
-        return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to update transaction status"})
+    // Reserve funds (available -> held) and log a pending hold transaction tied to this order
+    if err = orders.HoldFunds(ctx, tx, o.ID, o.BuyerID, o.Amount); err != nil {
+        return quote, err
     }
 
-    if err = tx.Commit(context.Background()); err != nil {
-        return c.JSON(http.StatusInternalServerError, echo.Map{"error": "commit failed"})
+    details := map[string]any{"amount": o.Amount, "platform_fee": quote.Fee}
+    for k, v := range o.Details {
+        details[k] = v
     }
+    return quote, orders.LogEvent(ctx, tx, o.ID, orders.ActorBuyer, o.BuyerID, "created", details)
+}
 
-    return c.JSON(http.StatusOK, echo.Map{"message": "Order accepted; funds debited and work in progress"})
+// =========================
+// AcceptOrder - Seller accepts order
+// =========================
+func AcceptOrder(c echo.Context) error {
+	return transitionOrder(c, orders.ActionAccept, orders.ActorSeller, "Order accepted; funds debited and work in progress")
 }
 
 // =========================
 // RejectOrder - Seller rejects order (refunds buyer)
 // =========================
 func RejectOrder(c echo.Context) error {
-    sellerID, ok := c.Get("user_id").(string)
-    if !ok || sellerID == "" {
-        return c.JSON(http.StatusUnauthorized, echo.Map{"error": "unauthorized"})
-    }
-
-	orderID := c.Param("id")
-	if orderID == "" {
-		return c.JSON(http.StatusBadRequest, echo.Map{"error": "missing order id in URL"})
-	}
-
-    // Handle rejection for both 'pending' and 'confirmed' (refund escrow if needed)
-    var buyerID string
-    var amount int64
-    var status string
-    err := db.Conn.QueryRow(context.Background(),
-        `SELECT buyer_id, amount, status FROM orders WHERE id = $1 AND seller_id = $2`,
-        orderID, sellerID).Scan(&buyerID, &amount, &status)
-    if err != nil {
-        return c.JSON(http.StatusBadRequest, echo.Map{"error": "order not found or already handled"})
-    }
-
-    tx, err := db.Conn.Begin(context.Background())
-    if err != nil {
-        return c.JSON(http.StatusInternalServerError, echo.Map{"error": "transaction start failed"})
-    }
-    defer tx.Rollback(context.Background())
-
-    if status == "in_progress" || status == "delivered" {
-        // Refund escrow to buyer
-        _, err = tx.Exec(context.Background(),
-            `UPDATE wallets SET escrow = escrow - $1, balance = balance + $1 WHERE user_id = $2 AND escrow >= $1`,
-            amount, buyerID,
-        )
-        if err != nil {
-            return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to refund escrow"})
-        }
-        // Log refund transaction
-        _, err = tx.Exec(context.Background(),
-            `INSERT INTO transactions (user_id, amount, type, status, reference, created_at)
-             VALUES ($1, $2, 'credit', 'refunded', $3, $4)`,
-            buyerID, amount, orderID, time.Now(),
-        )
-        if err != nil {
-            return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to record refund"})
-        }
-    } else if status == "pending_acceptance" {
-        // Release held funds
-        _, err = tx.Exec(context.Background(),
-            `UPDATE wallets SET locked_amount = locked_amount - $1 WHERE user_id = $2 AND locked_amount >= $1`,
-            amount, buyerID,
-        )
-        if err != nil {
-            return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to release held funds"})
-        }
-        // Log refund transaction
-        _, err = tx.Exec(context.Background(),
-            `INSERT INTO transactions (user_id, amount, type, status, reference, created_at)
-             VALUES ($1, $2, 'credit', 'refunded', $3, $4)`,
-            buyerID, amount, orderID, time.Now(),
-        )
-        if err != nil {
-            return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to record refund"})
-        }
-    }
-
-    _, err = tx.Exec(context.Background(),
-        `UPDATE orders SET status = 'declined', updated_at = NOW() WHERE id = $1`,
-        orderID,
-    )
-    if err != nil {
-        return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to update order status"})
-    }
-
-    if err = tx.Commit(context.Background()); err != nil {
-        return c.JSON(http.StatusInternalServerError, echo.Map{"error": "commit failed"})
-    }
-
-    return c.JSON(http.StatusOK, echo.Map{"message": "Order rejected"})
+	return transitionOrder(c, orders.ActionReject, orders.ActorSeller, "Order rejected")
 }
 
 // =========================
 // CompleteOrder - Buyer marks order complete (releases escrow funds)
 // =========================
 func CompleteOrder(c echo.Context) error {
-	buyerID, ok := c.Get("user_id").(string)
-	if !ok || buyerID == "" {
-		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "unauthorized"})
-	}
-
-	orderID := c.Param("id")
-	if orderID == "" {
-		return c.JSON(http.StatusBadRequest, echo.Map{"error": "missing order id in URL"})
-	}
-
-    var sellerID string
-    var amount int64
-    err := db.Conn.QueryRow(context.Background(),
-        `SELECT seller_id, amount FROM orders WHERE id = $1 AND buyer_id = $2 AND status IN ('in_progress','delivered')`,
-        orderID, buyerID).Scan(&sellerID, &amount)
-    if err != nil {
-        return c.JSON(http.StatusBadRequest, echo.Map{"error": "order not found or not active"})
-    }
-
-    tx, err := db.Conn.Begin(context.Background())
-	if err != nil {
-		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "transaction start failed"})
-	}
-	defer tx.Rollback(context.Background())
-
-    // Move funds from buyer escrow to seller balance
-    _, err = tx.Exec(context.Background(),
-        `UPDATE wallets SET escrow = escrow - $1 WHERE user_id = $2 AND escrow >= $1`,
-        amount, buyerID)
-    if err != nil {
-        return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to deduct buyer escrow"})
-    }
-
-    _, err = tx.Exec(context.Background(),
-        `UPDATE wallets SET balance = balance + $1 WHERE user_id = $2`,
-        amount, sellerID)
-    if err != nil {
-        return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to credit seller"})
-    }
-
-    _, err = tx.Exec(context.Background(),
-        `UPDATE orders SET status = 'completed', updated_at = NOW() WHERE id = $1`,
-        orderID)
-    if err != nil {
-        return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to update status"})
-    }
-
-    // Log transactions: buyer escrow release (debit) and seller credit
-    _, err = tx.Exec(context.Background(),
-        `INSERT INTO transactions (user_id, amount, type, status, reference, created_at)
-         VALUES ($1, $2, 'credit', 'credited', $3, $4)`,
-        sellerID, amount, orderID, time.Now(),
-    )
-    if err != nil {
-        return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to record seller credit"})
-    }
-
-    if err = tx.Commit(context.Background()); err != nil {
-        return c.JSON(http.StatusInternalServerError, echo.Map{"error": "commit failed"})
-    }
-
-    // Notify seller of completion/payout (best-effort)
-    var sellerEmail string
-    _ = db.Conn.QueryRow(context.Background(), `SELECT email FROM users WHERE id = $1`, sellerID).Scan(&sellerEmail)
-    if sellerEmail != "" {
-        _ = alerts.EnqueueOrderCompleted(orderID, buyerID, sellerID, sellerEmail, float64(amount))
-    }
-
-    return c.JSON(http.StatusOK, echo.Map{"message": "Order completed successfully"})
+	return transitionOrder(c, orders.ActionComplete, orders.ActorBuyer, "Order completed successfully")
 }
 
 // =========================
@@ -358,7 +247,7 @@ func GetUserOrders(c echo.Context) error {
 	}
 
 	rows, err := db.Conn.Query(context.Background(),
-		`SELECT id, service_id, buyer_id, seller_id, amount, status, created_at
+		`SELECT `+orderColumns+`
 		 FROM orders WHERE buyer_id = $1 OR seller_id = $1 ORDER BY created_at DESC`, uid)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to fetch orders"})
@@ -367,226 +256,108 @@ func GetUserOrders(c echo.Context) error {
 
 	var orders []Order
 	for rows.Next() {
-		var o Order
-		if err := rows.Scan(&o.ID, &o.ServiceID, &o.BuyerID, &o.SellerID, &o.Amount, &o.Status, &o.CreatedAt); err != nil {
+		o, err := scanOrder(rows)
+		if err != nil {
 			return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to parse record"})
 		}
-		orders = append(orders, o)
+		orders = append(orders, *o)
 	}
 
 	return c.JSON(http.StatusOK, echo.Map{"orders": orders})
 }
 
+
 // =========================
 // CancelOrder - Buyer cancels an order
 // =========================
 func CancelOrder(c echo.Context) error {
-    buyerID, ok := c.Get("user_id").(string)
-    if !ok || buyerID == "" {
-        return c.JSON(http.StatusUnauthorized, echo.Map{"error": "unauthorized"})
-    }
-
-    orderID := c.Param("id")
-    if orderID == "" {
-        return c.JSON(http.StatusBadRequest, echo.Map{"error": "missing order id in URL"})
-    }
-
-    var amount int64
-    var status string
-    var sellerID string
-    err := db.Conn.QueryRow(context.Background(),
-        `SELECT amount, status, seller_id FROM orders WHERE id = $1 AND buyer_id = $2`,
-        orderID, buyerID,
-    ).Scan(&amount, &status, &sellerID)
-    if err != nil {
-        return c.JSON(http.StatusNotFound, echo.Map{"error": "order not found"})
-    }
-
-    // Only pending_acceptance, in_progress or delivered can be cancelled by buyer
-    if status != "pending_acceptance" && status != "in_progress" && status != "delivered" {
-        return c.JSON(http.StatusBadRequest, echo.Map{"error": "order cannot be cancelled at this stage"})
-    }
-
-    tx, err := db.Conn.Begin(context.Background())
-    if err != nil {
-        return c.JSON(http.StatusInternalServerError, echo.Map{"error": "transaction start failed"})
-    }
-    defer tx.Rollback(context.Background())
-
-    if status == "in_progress" || status == "delivered" {
-        // Refund escrow to buyer
-        _, err = tx.Exec(context.Background(),
-            `UPDATE wallets SET escrow = escrow - $1, balance = balance + $1 WHERE user_id = $2 AND escrow >= $1`,
-            amount, buyerID,
-        )
-        if err != nil {
-            return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to refund escrow"})
-        }
-        // Log refund transaction
-        _, err = tx.Exec(context.Background(),
-            `INSERT INTO transactions (user_id, amount, type, status, reference, created_at)
-             VALUES ($1, $2, 'credit', 'refunded', $3, $4)`,
-            buyerID, amount, orderID, time.Now(),
-        )
-        if err != nil {
-            return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to record refund"})
-        }
-    } else if status == "pending_acceptance" {
-        // Release held funds: decrease locked_amount
-        _, err = tx.Exec(context.Background(),
-            `UPDATE wallets SET locked_amount = locked_amount - $1 WHERE user_id = $2 AND locked_amount >= $1`,
-            amount, buyerID,
-        )
-        if err != nil {
-            return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to release held funds"})
-        }
-        // Log refund transaction
-        _, err = tx.Exec(context.Background(),
-            `INSERT INTO transactions (user_id, amount, type, status, reference, created_at)
-             VALUES ($1, $2, 'credit', 'refunded', $3, $4)`,
-            buyerID, amount, orderID, time.Now(),
-        )
-        if err != nil {
-            return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to record refund"})
-        }
-    }
-
-    // Update order status
-    _, err = tx.Exec(context.Background(),
-        `UPDATE orders SET status = 'canceled', updated_at = NOW() WHERE id = $1`,
-        orderID,
-    )
-    if err != nil {
-        return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to update order status"})
-    }
-
-    if err = tx.Commit(context.Background()); err != nil {
-        return c.JSON(http.StatusInternalServerError, echo.Map{"error": "commit failed"})
-    }
-
-    // Notify seller of cancellation (best-effort)
-    var sellerEmail string
-    _ = db.Conn.QueryRow(context.Background(), `SELECT email FROM users WHERE id = $1`, sellerID).Scan(&sellerEmail)
-    if sellerEmail != "" {
-        _ = alerts.EnqueueOrderCancelled(orderID, buyerID, sellerID, sellerEmail, float64(amount))
-    }
-
-    return c.JSON(http.StatusOK, echo.Map{"message": "Order cancelled"})
+	return transitionOrder(c, orders.ActionCancel, orders.ActorBuyer, "Order cancelled")
 }
 
 // =========================
 // DeclineOrder - Seller declines after accepting/confirming
 // =========================
 func DeclineOrder(c echo.Context) error {
-    sellerID, ok := c.Get("user_id").(string)
-    if !ok || sellerID == "" {
-        return c.JSON(http.StatusUnauthorized, echo.Map{"error": "unauthorized"})
-    }
-
-    orderID := c.Param("id")
-    if orderID == "" {
-        return c.JSON(http.StatusBadRequest, echo.Map{"error": "missing order id in URL"})
-    }
+	return transitionOrder(c, orders.ActionDecline, orders.ActorSeller, "Order declined")
+}
 
-    var buyerID string
-    var amount int64
-    var status string
-    err := db.Conn.QueryRow(context.Background(),
-        `SELECT buyer_id, amount, status FROM orders WHERE id = $1 AND seller_id = $2`,
-        orderID, sellerID,
-    ).Scan(&buyerID, &amount, &status)
-    if err != nil {
-        return c.JSON(http.StatusNotFound, echo.Map{"error": "order not found"})
-    }
+// transitionResponse flattens the transition result next to the message
+type transitionResponse struct {
+	Message string `json:"message"`
+	*orders.Result
+	Delivery *Delivery `json:"delivery,omitempty"`
+	Revision *Revision `json:"revision,omitempty"`
+}
 
-    if status != "in_progress" && status != "delivered" {
-        return c.JSON(http.StatusBadRequest, echo.Map{"error": "order not in declinable state"})
-    }
+// transitionOrder runs an order state machine action as the caller. An
+// If-Match header carrying the order version makes the update conditional.
+func transitionOrder(c echo.Context, action, actorType, message string) error {
+	return transitionOrderTx(c, action, actorType, message, orders.Options{}, nil)
+}
 
-    tx, err := db.Conn.Begin(context.Background())
-    if err != nil {
-        return c.JSON(http.StatusInternalServerError, echo.Map{"error": "transaction start failed"})
-    }
-    defer tx.Rollback(context.Background())
+// transitionOrderTx is transitionOrder with extra work done in the same
+// transaction after the transition is applied.
+func transitionOrderTx(c echo.Context, action, actorType, message string, opts orders.Options,
+	after func(ctx context.Context, tx pgx.Tx, resp *transitionResponse) error) error {
+	uid, ok := c.Get("user_id").(string)
+	if !ok || uid == "" {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "unauthorized"})
+	}
 
-    if status == "in_progress" || status == "delivered" {
-        // Refund escrow to buyer
-        _, err = tx.Exec(context.Background(),
-            `UPDATE wallets SET escrow = escrow - $1, balance = balance + $1 WHERE user_id = $2 AND escrow >= $1`,
-            amount, buyerID,
-        )
-        if err != nil {
-            return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to refund escrow"})
-        }
-        // Log refund transaction
-        _, err = tx.Exec(context.Background(),
-            `INSERT INTO transactions (user_id, amount, type, status, reference, created_at)
-             VALUES ($1, $2, 'credit', 'refunded', $3, $4)`,
-            buyerID, amount, orderID, time.Now(),
-        )
-        if err != nil {
-            return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to record refund"})
-        }
-    }
+	orderID := c.Param("id")
+	if orderID == "" {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "missing order id in URL"})
+	}
 
-    // Update order status
-    _, err = tx.Exec(context.Background(),
-        `UPDATE orders SET status = 'declined', updated_at = NOW() WHERE id = $1`,
-        orderID,
-    )
-    if err != nil {
-        return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to update order status"})
-    }
+	if v := strings.Trim(c.Request().Header.Get("If-Match"), `"`); v != "" {
+		version, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": "If-Match must be the order version"})
+		}
+		opts.ExpectedVersion = &version
+	}
 
-    if err = tx.Commit(context.Background()); err != nil {
-        return c.JSON(http.StatusInternalServerError, echo.Map{"error": "commit failed"})
-    }
+	ctx := context.Background()
+	tx, err := db.Conn.Begin(ctx)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "transaction start failed"})
+	}
+	defer tx.Rollback(ctx)
 
-    // Notify buyer of decline (best-effort)
-    var buyerEmail string
-    _ = db.Conn.QueryRow(context.Background(), `SELECT email FROM users WHERE id = $1`, buyerID).Scan(&buyerEmail)
-    if buyerEmail != "" {
-        _ = alerts.EnqueueOrderDeclined(orderID, buyerID, sellerID, buyerEmail, float64(amount))
-    }
+	r, err := orders.ApplyTx(ctx, tx, orderID, action, actorType, uid, opts)
+	if err != nil {
+		return orderTransitionError(c, action, err)
+	}
+	resp := &transitionResponse{Message: message, Result: r}
+	if after != nil {
+		if err := after(ctx, tx, resp); err != nil {
+			return orderTransitionError(c, action, err)
+		}
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "commit failed"})
+	}
+	orders.Notify(ctx, r)
 
-    return c.JSON(http.StatusOK, echo.Map{"message": "Order declined"})
+	c.Response().Header().Set("ETag", strconv.Quote(strconv.FormatInt(r.Version, 10)))
+	return c.JSON(http.StatusOK, resp)
 }
 
-// =========================
-// DeliverOrder - Seller marks work delivered
-// =========================
-func DeliverOrder(c echo.Context) error {
-    sellerID, ok := c.Get("user_id").(string)
-    if !ok || sellerID == "" {
-        return c.JSON(http.StatusUnauthorized, echo.Map{"error": "unauthorized"})
-    }
-
-    orderID := c.Param("id")
-    if orderID == "" {
-        return c.JSON(http.StatusBadRequest, echo.Map{"error": "missing order id in URL"})
-    }
-
-    // Mark delivered
-    res, err := db.Conn.Exec(context.Background(),
-        `UPDATE orders SET status = 'delivered', updated_at = NOW() WHERE id = $1 AND seller_id = $2 AND status = 'in_progress'`,
-        orderID, sellerID,
-    )
-    if err != nil {
-        return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to update order status"})
-    }
-    if res.RowsAffected() == 0 {
-        return c.JSON(http.StatusBadRequest, echo.Map{"error": "order not found or not confirmable"})
-    }
-
-    // Notify buyer of delivery (best-effort)
-    var buyerID string
-    var amount float64
-    _ = db.Conn.QueryRow(context.Background(), `SELECT buyer_id, amount FROM orders WHERE id = $1`, orderID).Scan(&buyerID, &amount)
-    var buyerEmail string
-    _ = db.Conn.QueryRow(context.Background(), `SELECT email FROM users WHERE id = $1`, buyerID).Scan(&buyerEmail)
-    if buyerEmail != "" {
-        _ = alerts.EnqueueOrderDelivered(orderID, buyerID, sellerID, buyerEmail, amount)
-    }
-
-    return c.JSON(http.StatusOK, echo.Map{"message": "Order delivered"})
+// orderTransitionError maps state machine errors to HTTP responses
+func orderTransitionError(c echo.Context, action string, err error) error {
+	switch {
+	case errors.Is(err, orders.ErrNotFound):
+		return c.JSON(http.StatusNotFound, echo.Map{"error": "order not found"})
+	case errors.Is(err, orders.ErrForbidden):
+		return c.JSON(http.StatusForbidden, echo.Map{"error": err.Error()})
+	case errors.Is(err, orders.ErrInvalidTransition), errors.Is(err, orders.ErrVersionConflict),
+		errors.Is(err, orders.ErrPrecondition), errors.Is(err, orders.ErrNoRevisionsLeft),
+		errors.Is(err, orders.ErrNoDeadline):
+		return c.JSON(http.StatusConflict, echo.Map{"error": err.Error()})
+	case errors.Is(err, ledger.ErrInsufficientFunds) && action == orders.ActionRequestRevision:
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "insufficient available balance for an extra revision"})
+	case errors.Is(err, ledger.ErrInsufficientFunds):
+		return c.JSON(http.StatusConflict, echo.Map{"error": "order funds do not cover the order amount"})
+	}
+	return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to update order"})
 }
@@ -0,0 +1,317 @@
+package marketplace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/labstack/echo/v4"
+	"github.com/sudo-init-do/crafthub/internal/db"
+)
+
+// Package tiers, cheapest first
+const (
+	TierBasic    = "basic"
+	TierStandard = "standard"
+	TierPremium  = "premium"
+)
+
+var packageTiers = []string{TierBasic, TierStandard, TierPremium}
+
+const maxServiceExtras = 20
+
+// ServicePackage is one priced tier of a service
+type ServicePackage struct {
+	ID                string `json:"id,omitempty"`
+	Tier              string `json:"tier"`
+	Name              string `json:"name"`
+	Description       string `json:"description,omitempty"`
+	Price             int64  `json:"price"`
+	DeliveryDays      int    `json:"delivery_days"`
+	RevisionsIncluded int    `json:"revisions_included"`
+}
+
+// ServiceExtra is an optional add-on ordered on top of the base price
+type ServiceExtra struct {
+	ID                string `json:"id,omitempty"`
+	Name              string `json:"name"`
+	Description       string `json:"description,omitempty"`
+	Price             int64  `json:"price"`
+	DeliveryDaysDelta int    `json:"delivery_days_delta"` // negative for express delivery
+}
+
+// OrderSelection is the priced package and extras, snapshotted on the order
+type OrderSelection struct {
+	Package           *ServicePackage `json:"package,omitempty"`
+	Extras            []ServiceExtra  `json:"extras"`
+	BasePrice         int64           `json:"base_price"`
+	ExtrasTotal       int64           `json:"extras_total"`
+	Total             int64           `json:"total"`
+	DeliveryDays      int             `json:"delivery_days"`
+	RevisionsIncluded int             `json:"revisions_included"`
+}
+
+// validateCatalog checks the packages and extras a seller submits
+func validateCatalog(pkgs []ServicePackage, extras []ServiceExtra) string {
+	seen := map[string]bool{}
+	for i := range pkgs {
+		p := &pkgs[i]
+		p.Tier = strings.ToLower(strings.TrimSpace(p.Tier))
+		p.Name = strings.TrimSpace(p.Name)
+		valid := false
+		for _, t := range packageTiers {
+			valid = valid || p.Tier == t
+		}
+		if !valid {
+			return "package tier must be basic, standard or premium"
+		}
+		if seen[p.Tier] {
+			return "each package tier can only be listed once"
+		}
+		seen[p.Tier] = true
+		if p.Name == "" {
+			p.Name = strings.ToUpper(p.Tier[:1]) + p.Tier[1:]
+		}
+		if p.Price <= 0 || p.DeliveryDays < 0 || p.RevisionsIncluded < 0 {
+			return "package price must be > 0 and delivery days and revisions >= 0"
+		}
+	}
+	if len(extras) > maxServiceExtras {
+		return fmt.Sprintf("at most %d extras per service", maxServiceExtras)
+	}
+	for i := range extras {
+		e := &extras[i]
+		e.Name = strings.TrimSpace(e.Name)
+		if e.Name == "" {
+			return "extra name is required"
+		}
+		if e.Price < 0 {
+			return "extra price must be >= 0"
+		}
+	}
+	return ""
+}
+
+// insertCatalog stores a service's packages and extras
+func insertCatalog(ctx context.Context, tx pgx.Tx, serviceID string, pkgs []ServicePackage, extras []ServiceExtra) error {
+	for i := range pkgs {
+		p := &pkgs[i]
+		if err := tx.QueryRow(ctx,
+			`INSERT INTO service_packages (service_id, tier, name, description, price, delivery_days, revisions_included)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id::text`,
+			serviceID, p.Tier, p.Name, p.Description, p.Price, p.DeliveryDays, p.RevisionsIncluded,
+		).Scan(&p.ID); err != nil {
+			return err
+		}
+	}
+	for i := range extras {
+		e := &extras[i]
+		if err := tx.QueryRow(ctx,
+			`INSERT INTO service_extras (service_id, name, description, price, delivery_days_delta)
+			 VALUES ($1, $2, $3, $4, $5) RETURNING id::text`,
+			serviceID, e.Name, e.Description, e.Price, e.DeliveryDaysDelta,
+		).Scan(&e.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replaceCatalog applies an edit to a service's packages and/or extras. Rows
+// are deactivated rather than deleted so past orders keep their references.
+func replaceCatalog(ctx context.Context, tx pgx.Tx, serviceID string, pkgs *[]ServicePackage, extras *[]ServiceExtra) error {
+	if pkgs != nil {
+		tiers := []string{}
+		for i := range *pkgs {
+			p := &(*pkgs)[i]
+			if err := tx.QueryRow(ctx,
+				`INSERT INTO service_packages (service_id, tier, name, description, price, delivery_days, revisions_included)
+				 VALUES ($1, $2, $3, $4, $5, $6, $7)
+				 ON CONFLICT (service_id, tier) DO UPDATE
+				 SET name = EXCLUDED.name, description = EXCLUDED.description, price = EXCLUDED.price,
+				     delivery_days = EXCLUDED.delivery_days, revisions_included = EXCLUDED.revisions_included, active = TRUE
+				 RETURNING id::text`,
+				serviceID, p.Tier, p.Name, p.Description, p.Price, p.DeliveryDays, p.RevisionsIncluded,
+			).Scan(&p.ID); err != nil {
+				return err
+			}
+			tiers = append(tiers, p.Tier)
+		}
+		if _, err := tx.Exec(ctx,
+			`UPDATE service_packages SET active = FALSE WHERE service_id = $1 AND NOT (tier = ANY($2))`, serviceID, tiers,
+		); err != nil {
+			return err
+		}
+	}
+	if extras != nil {
+		kept := []string{}
+		for i := range *extras {
+			e := &(*extras)[i]
+			if e.ID != "" {
+				tag, err := tx.Exec(ctx,
+					`UPDATE service_extras SET name = $3, description = $4, price = $5, delivery_days_delta = $6
+					 WHERE id::text = $1 AND service_id = $2 AND active`,
+					e.ID, serviceID, e.Name, e.Description, e.Price, e.DeliveryDaysDelta,
+				)
+				if err != nil {
+					return err
+				}
+				if tag.RowsAffected() == 1 {
+					kept = append(kept, e.ID)
+					continue
+				}
+			}
+			// unknown ids are added as new extras
+			if err := tx.QueryRow(ctx,
+				`INSERT INTO service_extras (service_id, name, description, price, delivery_days_delta)
+				 VALUES ($1, $2, $3, $4, $5) RETURNING id::text`,
+				serviceID, e.Name, e.Description, e.Price, e.DeliveryDaysDelta,
+			).Scan(&e.ID); err != nil {
+				return err
+			}
+			kept = append(kept, e.ID)
+		}
+		if _, err := tx.Exec(ctx,
+			`UPDATE service_extras SET active = FALSE WHERE service_id = $1 AND NOT (id::text = ANY($2))`, serviceID, kept,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadCatalog returns the service's active packages (cheapest tier first) and extras
+func loadCatalog(ctx context.Context, serviceID string) ([]ServicePackage, []ServiceExtra, error) {
+	pkgs := []ServicePackage{}
+	rows, err := db.Conn.Query(ctx,
+		`SELECT id::text, tier, name, COALESCE(description, ''), price, delivery_days, revisions_included
+		 FROM service_packages WHERE service_id = $1 AND active
+		 ORDER BY array_position(ARRAY['basic','standard','premium'], tier)`, serviceID,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	for rows.Next() {
+		var p ServicePackage
+		if err := rows.Scan(&p.ID, &p.Tier, &p.Name, &p.Description, &p.Price, &p.DeliveryDays, &p.RevisionsIncluded); err != nil {
+			rows.Close()
+			return nil, nil, err
+		}
+		pkgs = append(pkgs, p)
+	}
+	rows.Close()
+
+	extras := []ServiceExtra{}
+	rows, err = db.Conn.Query(ctx,
+		`SELECT id::text, name, COALESCE(description, ''), price, delivery_days_delta
+		 FROM service_extras WHERE service_id = $1 AND active ORDER BY created_at, id`, serviceID,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var e ServiceExtra
+		if err := rows.Scan(&e.ID, &e.Name, &e.Description, &e.Price, &e.DeliveryDaysDelta); err != nil {
+			return nil, nil, err
+		}
+		extras = append(extras, e)
+	}
+	return pkgs, extras, rows.Err()
+}
+
+var errInvalidSelection = errors.New("invalid selection")
+
+// priceSelection validates the buyer's package and extras against the
+// service's current catalog and prices them. Services without packages are
+// ordered at their base price. Errors wrapping errInvalidSelection are
+// user-facing.
+func priceSelection(ctx context.Context, serviceID string, basePrice int64, baseDays, baseRevisions int, tier string, extraIDs []string) (*OrderSelection, error) {
+	pkgs, extras, err := loadCatalog(ctx, serviceID)
+	if err != nil {
+		return nil, err
+	}
+	sel := &OrderSelection{Extras: []ServiceExtra{}, BasePrice: basePrice, DeliveryDays: baseDays, RevisionsIncluded: baseRevisions}
+
+	tier = strings.ToLower(strings.TrimSpace(tier))
+	switch {
+	case len(pkgs) == 0 && tier != "":
+		return nil, fmt.Errorf("%w: this service has no packages", errInvalidSelection)
+	case len(pkgs) > 0 && tier == "":
+		return nil, fmt.Errorf("%w: package is required", errInvalidSelection)
+	}
+	for i := range pkgs {
+		if pkgs[i].Tier == tier || pkgs[i].ID == tier {
+			sel.Package = &pkgs[i]
+		}
+	}
+	if len(pkgs) > 0 {
+		if sel.Package == nil {
+			return nil, fmt.Errorf("%w: package %q is not offered", errInvalidSelection, tier)
+		}
+		sel.BasePrice = sel.Package.Price
+		sel.DeliveryDays = sel.Package.DeliveryDays
+		sel.RevisionsIncluded = sel.Package.RevisionsIncluded
+	}
+	baseDays = sel.DeliveryDays
+
+	byID := map[string]ServiceExtra{}
+	for _, e := range extras {
+		byID[e.ID] = e
+	}
+	picked := map[string]bool{}
+	for _, id := range extraIDs {
+		e, ok := byID[id]
+		if !ok {
+			return nil, fmt.Errorf("%w: extra %q is not offered", errInvalidSelection, id)
+		}
+		if picked[id] {
+			return nil, fmt.Errorf("%w: extra %q selected twice", errInvalidSelection, id)
+		}
+		picked[id] = true
+		sel.Extras = append(sel.Extras, e)
+		sel.ExtrasTotal += e.Price
+		sel.DeliveryDays += e.DeliveryDaysDelta
+	}
+	// Express extras shorten delivery but never below a day; 0 means no deadline
+	if baseDays == 0 {
+		sel.DeliveryDays = 0
+	} else if sel.DeliveryDays < 1 {
+		sel.DeliveryDays = 1
+	}
+	sel.Total = sel.BasePrice + sel.ExtrasTotal
+	return sel, nil
+}
+
+// GET /marketplace/services/:id
+// Public service detail with its packages, extras and requirements.
+func GetService(c echo.Context) error {
+	ctx := context.Background()
+	var s ServiceSummary
+	err := db.Conn.QueryRow(ctx,
+		`SELECT s.id, s.user_id, s.title, COALESCE(s.description, ''), s.price, COALESCE(s.category, ''), COALESCE(s.delivery_time_days, 0),
+		        s.revisions_included, s.extra_revision_price, COALESCE(s.status, ''), s.version, s.created_at,
+		        s.rating_avg,
+		        COALESCE((SELECT MIN(p.price) FROM service_packages p WHERE p.service_id = s.id AND p.active), s.price)
+		 FROM services s WHERE s.id = $1 AND COALESCE(s.status, 'active') <> 'deleted'`, c.Param("id"),
+	).Scan(&s.ID, &s.UserID, &s.Title, &s.Description, &s.Price, &s.Category, &s.DeliveryTimeDays,
+		&s.RevisionsIncluded, &s.ExtraRevisionPrice, &s.Status, &s.Version, &s.CreatedAt, &s.AvgRating, &s.StartingAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return c.JSON(http.StatusNotFound, echo.Map{"error": "service not found"})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not fetch service"})
+	}
+	pkgs, extras, err := loadCatalog(ctx, s.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not fetch packages"})
+	}
+	questions := []RequirementQuestion{}
+	if err := db.Conn.QueryRow(ctx, `SELECT requirements FROM services WHERE id = $1`, s.ID).Scan(&questions); err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not fetch requirements"})
+	}
+	return c.JSON(http.StatusOK, echo.Map{"service": s, "packages": pkgs, "extras": extras, "requirements": questions})
+}
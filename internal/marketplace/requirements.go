@@ -0,0 +1,291 @@
+package marketplace
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/sudo-init-do/crafthub/internal/alerts"
+	"github.com/sudo-init-do/crafthub/internal/db"
+	"github.com/sudo-init-do/crafthub/internal/ledger"
+	"github.com/sudo-init-do/crafthub/internal/orders"
+)
+
+// Requirement question types
+const (
+	QuestionText   = "text"
+	QuestionChoice = "choice"
+	QuestionFile   = "file"
+)
+
+const (
+	maxRequirementQuestions = 20
+	questionLabelMaxLen     = 500
+	textAnswerMaxLen        = 5000
+)
+
+// RequirementQuestion is one input a service needs from the buyer
+type RequirementQuestion struct {
+	ID       string   `json:"id"` // answers are keyed by this
+	Type     string   `json:"type"`
+	Label    string   `json:"label"`
+	Help     string   `json:"help,omitempty"`
+	Required bool     `json:"required"`
+	Options  []string `json:"options,omitempty"`  // choice only
+	Multiple bool     `json:"multiple,omitempty"` // choice: several options may be picked
+}
+
+// Requirements is an order's questionnaire snapshot and the buyer's answers
+type Requirements struct {
+	Questions   []RequirementQuestion `json:"questions"`
+	Answers     map[string]any        `json:"answers"`
+	Missing     []string              `json:"missing"` // required questions still unanswered
+	CompletedAt *time.Time            `json:"completed_at,omitempty"`
+}
+
+// validateQuestions checks a seller's requirements schema, assigning ids to
+// questions that have none
+func validateQuestions(qs []RequirementQuestion) string {
+	if len(qs) > maxRequirementQuestions {
+		return fmt.Sprintf("at most %d requirement questions per service", maxRequirementQuestions)
+	}
+	seen := map[string]bool{}
+	for i := range qs {
+		q := &qs[i]
+		q.ID = strings.TrimSpace(q.ID)
+		q.Label = strings.TrimSpace(q.Label)
+		if q.ID == "" {
+			q.ID = uuid.New().String()
+		}
+		if seen[q.ID] {
+			return "requirement question ids must be unique"
+		}
+		seen[q.ID] = true
+		if q.Label == "" || len(q.Label) > questionLabelMaxLen {
+			return fmt.Sprintf("requirement label is required and at most %d characters", questionLabelMaxLen)
+		}
+		switch q.Type {
+		case QuestionChoice:
+			if len(q.Options) < 2 {
+				return "choice questions need at least two options"
+			}
+		case QuestionText, QuestionFile:
+			q.Options, q.Multiple = nil, false
+		default:
+			return "requirement type must be text, choice or file"
+		}
+	}
+	return ""
+}
+
+// validateAnswers checks submitted answers against the questions and returns
+// them normalised. Unanswered questions are left out; see missingAnswers.
+func validateAnswers(qs []RequirementQuestion, raw map[string]json.RawMessage) (map[string]any, string) {
+	byID := map[string]RequirementQuestion{}
+	for _, q := range qs {
+		byID[q.ID] = q
+	}
+	answers := map[string]any{}
+	for id, v := range raw {
+		q, ok := byID[id]
+		if !ok {
+			return nil, fmt.Sprintf("unknown requirement %q", id)
+		}
+		if string(v) == "null" {
+			continue
+		}
+		switch q.Type {
+		case QuestionText:
+			var s string
+			if json.Unmarshal(v, &s) != nil || len(s) > textAnswerMaxLen {
+				return nil, fmt.Sprintf("%q must be text of at most %d characters", q.Label, textAnswerMaxLen)
+			}
+			if s = strings.TrimSpace(s); s != "" {
+				answers[id] = s
+			}
+		case QuestionChoice:
+			var picked []string
+			if q.Multiple {
+				if json.Unmarshal(v, &picked) != nil {
+					return nil, fmt.Sprintf("%q must be a list of options", q.Label)
+				}
+			} else {
+				var s string
+				if json.Unmarshal(v, &s) != nil {
+					return nil, fmt.Sprintf("%q must be one of the options", q.Label)
+				}
+				picked = []string{s}
+			}
+			for _, p := range picked {
+				valid := false
+				for _, o := range q.Options {
+					valid = valid || p == o
+				}
+				if !valid {
+					return nil, fmt.Sprintf("%q is not an option for %q", p, q.Label)
+				}
+			}
+			if len(picked) > 0 {
+				if q.Multiple {
+					answers[id] = picked
+				} else {
+					answers[id] = picked[0]
+				}
+			}
+		case QuestionFile:
+			var atts []Attachment
+			if json.Unmarshal(v, &atts) != nil {
+				return nil, fmt.Sprintf("%q must be a list of files", q.Label)
+			}
+			if msg := validateAttachments(atts); msg != "" {
+				return nil, msg
+			}
+			if len(atts) > 0 {
+				answers[id] = atts
+			}
+		}
+	}
+	return answers, ""
+}
+
+// missingAnswers lists the required questions without an answer
+func missingAnswers(qs []RequirementQuestion, answers map[string]any) []string {
+	missing := []string{}
+	for _, q := range qs {
+		if _, ok := answers[q.ID]; q.Required && !ok {
+			missing = append(missing, q.ID)
+		}
+	}
+	return missing
+}
+
+// loadRequirements reads the questionnaire snapshot and answers stored on an order
+func loadRequirements(ctx context.Context, q ledger.Querier, orderID string) (*Requirements, error) {
+	var questions, answers []byte
+	r := &Requirements{}
+	if err := q.QueryRow(ctx,
+		`SELECT COALESCE(requirements, '[]'::jsonb), COALESCE(answers, '{}'::jsonb), requirements_completed_at
+		 FROM orders WHERE id = $1`, orderID,
+	).Scan(&questions, &answers, &r.CompletedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(questions, &r.Questions); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(answers, &r.Answers); err != nil {
+		return nil, err
+	}
+	r.Missing = missingAnswers(r.Questions, r.Answers)
+	return r, nil
+}
+
+// GET /marketplace/orders/:id/requirements
+func GetRequirements(c echo.Context) error {
+	o, err := orderForViewer(c)
+	if o == nil {
+		return err
+	}
+	r, err := loadRequirements(context.Background(), db.Conn, o.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to fetch requirements"})
+	}
+	return c.JSON(http.StatusOK, echo.Map{"order_id": o.ID, "requirements": r})
+}
+
+// POST /marketplace/orders/:id/requirements
+// Buyer fills in or updates answers until the order is delivered. Once every
+// required question is answered an accepted order starts its delivery clock;
+// from then on required answers can be changed but not cleared.
+func SubmitRequirements(c echo.Context) error {
+	uid, ok := c.Get("user_id").(string)
+	if !ok || uid == "" {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "unauthorized"})
+	}
+	var req struct {
+		Answers map[string]json.RawMessage `json:"answers"`
+	}
+	if err := c.Bind(&req); err != nil || len(req.Answers) == 0 {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "answers are required"})
+	}
+
+	ctx := context.Background()
+	tx, err := db.Conn.Begin(ctx)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "transaction start failed"})
+	}
+	defer tx.Rollback(ctx)
+
+	o, err := orders.Lock(ctx, tx, c.Param("id"))
+	if errors.Is(err, orders.ErrNotFound) || (err == nil && o.BuyerID != uid) {
+		return c.JSON(http.StatusNotFound, echo.Map{"error": "order not found"})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to fetch order"})
+	}
+	if o.Status != orders.StatusPendingAcceptance && o.Status != orders.StatusInProgress {
+		return c.JSON(http.StatusConflict, echo.Map{"error": "requirements can only be changed before the order is delivered"})
+	}
+	r, err := loadRequirements(ctx, tx, o.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to fetch requirements"})
+	}
+	answers, msg := validateAnswers(r.Questions, req.Answers)
+	if msg != "" {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": msg})
+	}
+	// Later submissions update earlier answers; null clears one
+	for id, v := range req.Answers {
+		if string(v) == "null" {
+			delete(r.Answers, id)
+		}
+	}
+	for id, v := range answers {
+		r.Answers[id] = v
+	}
+	r.Missing = missingAnswers(r.Questions, r.Answers)
+	wasComplete := r.CompletedAt != nil
+
+	b, err := json.Marshal(r.Answers)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to save answers"})
+	}
+	dueAt, err := orders.SaveRequirements(ctx, tx, o, b, len(r.Missing) == 0)
+	if errors.Is(err, orders.ErrVersionConflict) || errors.Is(err, orders.ErrRequirementsLocked) {
+		return c.JSON(http.StatusConflict, echo.Map{"error": err.Error()})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to save answers"})
+	}
+	switch {
+	case len(r.Missing) > 0:
+		r.CompletedAt = nil
+	case !wasComplete:
+		now := time.Now()
+		r.CompletedAt = &now
+	}
+	if err = orders.LogEvent(ctx, tx, o.ID, orders.ActorBuyer, uid, "requirements_submitted", map[string]any{
+		"answered": len(r.Answers),
+		"missing":  len(r.Missing),
+	}); err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to save answers"})
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "commit failed"})
+	}
+
+	if r.CompletedAt != nil && !wasComplete {
+		ref := o.ID
+		meta := "{}"
+		_ = alerts.CreateNotification(o.SellerID, "order:requirements_completed", "Order requirements completed",
+			"The buyer has answered all of the order's requirements.", &ref, &meta)
+	}
+	c.Response().Header().Set("ETag", strconv.Quote(strconv.FormatInt(o.Version, 10)))
+	return c.JSON(http.StatusOK, echo.Map{"order_id": o.ID, "requirements": r, "due_at": dueAt, "version": o.Version})
+}
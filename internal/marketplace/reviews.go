@@ -129,6 +129,9 @@ func CreateReview(c echo.Context) error {
 	}
 
 	log.Printf("DEBUG: Review created successfully with ID: %s", reviewID)
+	if err := refreshServiceRating(ctx, orderID); err != nil {
+		log.Printf("failed to refresh service rating for order %s: %v", orderID, err)
+	}
 
 	return c.JSON(http.StatusCreated, CreateReviewResponse{
 		ReviewID: reviewID,
@@ -136,6 +139,22 @@ func CreateReview(c echo.Context) error {
 	})
 }
 
+// refreshServiceRating recomputes the rating aggregates discovery reads for
+// the order's service
+func refreshServiceRating(ctx context.Context, orderID string) error {
+	_, err := db.Conn.Exec(ctx,
+		`UPDATE services s SET rating_avg = agg.avg, rating_count = agg.n
+		 FROM (
+		     SELECT COALESCE(AVG(r.rating)::float, 0) AS avg, COUNT(r.id) AS n
+		     FROM orders o LEFT JOIN reviews r ON r.order_id = o.id
+		     WHERE o.service_id = (SELECT service_id FROM orders WHERE id = $1::uuid)
+		 ) agg
+		 WHERE s.id = (SELECT service_id FROM orders WHERE id = $1::uuid)`,
+		orderID,
+	)
+	return err
+}
+
 // GetSellerReviews returns all reviews for a specific seller with rating summary
 func GetSellerReviews(c echo.Context) error {
 	sellerID := c.Param("id")
@@ -0,0 +1,132 @@
+package marketplace
+
+import (
+	"html"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	searchConfig   = "english"
+	maxSearchTerms = 8
+	// typoSimilarity is the pg_trgm word similarity a title needs to match a
+	// misspelt query ("desgin" vs "design" is about 0.43)
+	typoSimilarity = "0.35"
+	// typoRankWeight scales trigram similarity against ts_rank when ordering
+	typoRankWeight = "0.3"
+)
+
+// ts_headline wraps matches in these markers; they are swapped for <mark>
+// after the text is HTML-escaped
+const (
+	markOpen  = "[[mark]]"
+	markClose = "[[/mark]]"
+)
+
+const (
+	titleHeadlineOpts       = `StartSel="` + markOpen + `", StopSel="` + markClose + `", HighlightAll=true`
+	descriptionHeadlineOpts = `StartSel="` + markOpen + `", StopSel="` + markClose + `", MaxFragments=2, MaxWords=30, MinWords=10, FragmentDelimiter=" ... "`
+)
+
+// ServiceHighlight is HTML-escaped text with matched words in <mark> tags
+type ServiceHighlight struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+}
+
+// sqlArgs collects query parameters and hands out their placeholders
+type sqlArgs []any
+
+func (a *sqlArgs) add(v any) string {
+	*a = append(*a, v)
+	return "$" + strconv.Itoa(len(*a))
+}
+
+// searchTerms turns free text into a tsquery matching every word as a
+// prefix: "logo desi" becomes "logo:* & desi:*"
+func searchTerms(q string) string {
+	words := strings.FieldsFunc(strings.ToLower(q), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) > maxSearchTerms {
+		words = words[:maxSearchTerms]
+	}
+	for i, w := range words {
+		words[i] = w + ":*"
+	}
+	return strings.Join(words, " & ")
+}
+
+// serviceFilters are the discovery filters read from the query string.
+// Unparseable values are ignored.
+type serviceFilters struct {
+	q           string
+	terms       string
+	minPrice    *int64
+	maxPrice    *int64
+	category    string
+	deliveryMax *int
+	ratingMin   *float64
+}
+
+func parseServiceFilters(c echo.Context) serviceFilters {
+	f := serviceFilters{q: strings.TrimSpace(c.QueryParam("q")), category: c.QueryParam("category")}
+	f.terms = searchTerms(f.q)
+	if f.terms == "" {
+		f.q = ""
+	}
+	if v, err := strconv.ParseInt(c.QueryParam("min_price"), 10, 64); err == nil {
+		f.minPrice = &v
+	}
+	if v, err := strconv.ParseInt(c.QueryParam("max_price"), 10, 64); err == nil {
+		f.maxPrice = &v
+	}
+	if v, err := strconv.Atoi(c.QueryParam("delivery_time_max")); err == nil {
+		f.deliveryMax = &v
+	}
+	if v, err := strconv.ParseFloat(c.QueryParam("rating_min"), 64); err == nil {
+		f.ratingMin = &v
+	}
+	return f
+}
+
+// tsquery is the SQL for the parsed search terms
+func (f serviceFilters) tsquery(args *sqlArgs) string {
+	return "to_tsquery('" + searchConfig + "', " + args.add(f.terms) + ")"
+}
+
+// conditions renders the WHERE clause for the filters, leaving out the
+// filter of the facet named by except. Only active services are ever listed.
+// A query matches on full text or, for typos, on the title's trigram similarity.
+func (f serviceFilters) conditions(args *sqlArgs, except string) string {
+	conds := []string{"COALESCE(s.status, 'active') = 'active'"}
+	if f.q != "" {
+		conds = append(conds, "(s.search_vector @@ "+f.tsquery(args)+" OR "+args.add(f.q)+" <% s.title)")
+	}
+	if f.minPrice != nil && except != facetPrice {
+		conds = append(conds, "s.price >= "+args.add(*f.minPrice))
+	}
+	if f.maxPrice != nil && except != facetPrice {
+		conds = append(conds, "s.price <= "+args.add(*f.maxPrice))
+	}
+	if f.category != "" && except != facetCategory {
+		conds = append(conds, "s.category = "+args.add(f.category))
+	}
+	if f.deliveryMax != nil && except != facetDelivery {
+		conds = append(conds, "s.delivery_time_days <= "+args.add(*f.deliveryMax))
+	}
+	if f.ratingMin != nil && except != facetRating {
+		conds = append(conds, "s.rating_avg >= "+args.add(*f.ratingMin))
+	}
+	return strings.Join(conds, " AND ")
+}
+
+// highlight escapes ts_headline output and turns its markers into <mark> tags
+func highlight(s string) string {
+	s = html.EscapeString(s)
+	s = strings.ReplaceAll(s, markOpen, "<mark>")
+	return strings.ReplaceAll(s, markClose, "</mark>")
+}
@@ -0,0 +1,312 @@
+package marketplace
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/labstack/echo/v4"
+	"github.com/sudo-init-do/crafthub/internal/db"
+	"github.com/sudo-init-do/crafthub/internal/orders"
+)
+
+// Service statuses. Sellers switch between active and paused; suspended and
+// pending are set by admins; deleted services are kept for existing orders.
+const (
+	ServiceActive    = "active"
+	ServicePaused    = "paused"
+	ServiceSuspended = "suspended"
+	ServicePending   = "pending"
+	ServiceDeleted   = "deleted"
+)
+
+var ErrServiceNotFound = errors.New("service not found")
+
+// ServiceVersion is a snapshot of a service after one change
+type ServiceVersion struct {
+	Version            int                   `json:"version"`
+	Title              string                `json:"title"`
+	Description        string                `json:"description"`
+	Price              int64                 `json:"price"`
+	Category           string                `json:"category,omitempty"`
+	DeliveryTimeDays   int                   `json:"delivery_time_days"`
+	RevisionsIncluded  int                   `json:"revisions_included"`
+	ExtraRevisionPrice *int64                `json:"extra_revision_price,omitempty"`
+	Requirements       []RequirementQuestion `json:"requirements"`
+	Packages           []ServicePackage      `json:"packages"`
+	Extras             []ServiceExtra        `json:"extras"`
+	Status             string                `json:"status"`
+	Change             string                `json:"change"`
+	EditedBy           *string               `json:"edited_by,omitempty"`
+	CreatedAt          time.Time             `json:"created_at"`
+}
+
+// RecordServiceVersion snapshots the service's current state, packages and
+// extras as its current version. Call it after every change in the same tx.
+func RecordServiceVersion(ctx context.Context, q orders.Execer, serviceID, editorID, change string) error {
+	_, err := q.Exec(ctx,
+		`INSERT INTO service_versions (service_id, version, title, description, price, category, delivery_time_days,
+		                               revisions_included, extra_revision_price, requirements, packages, extras, status, change, edited_by)
+		 SELECT s.id, s.version, s.title, s.description, s.price, s.category, s.delivery_time_days,
+		        s.revisions_included, s.extra_revision_price, s.requirements,
+		        COALESCE((SELECT jsonb_agg(to_jsonb(p) - 'service_id') FROM service_packages p WHERE p.service_id = s.id AND p.active), '[]'::jsonb),
+		        COALESCE((SELECT jsonb_agg(to_jsonb(x) - 'service_id') FROM service_extras x WHERE x.service_id = s.id AND x.active), '[]'::jsonb),
+		        COALESCE(s.status, 'active'), $3, NULLIF($2, '')::uuid
+		 FROM services s WHERE s.id = $1`,
+		serviceID, editorID, change,
+	)
+	return err
+}
+
+// SetServiceStatus moves a service that has not been deleted to status and
+// records the change
+func SetServiceStatus(ctx context.Context, tx pgx.Tx, serviceID, status, editorID, change string) error {
+	var version int
+	err := tx.QueryRow(ctx,
+		`UPDATE services SET status = $2, version = version + 1, updated_at = NOW(),
+		        deleted_at = CASE WHEN $2 = 'deleted' THEN NOW() END
+		 WHERE id::text = $1 AND COALESCE(status, 'active') <> 'deleted'
+		 RETURNING version`,
+		serviceID, status,
+	).Scan(&version)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrServiceNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return RecordServiceVersion(ctx, tx, serviceID, editorID, change)
+}
+
+// lockOwnService locks the caller's service for an edit. Writes the error
+// response and returns an empty status otherwise.
+func lockOwnService(c echo.Context, ctx context.Context, tx pgx.Tx, uid string) (string, error) {
+	var ownerID, status string
+	err := tx.QueryRow(ctx,
+		`SELECT user_id::text, COALESCE(status, 'active') FROM services WHERE id::text = $1 FOR UPDATE`, c.Param("id"),
+	).Scan(&ownerID, &status)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && (ownerID != uid || status == ServiceDeleted)) {
+		return "", c.JSON(http.StatusNotFound, echo.Map{"error": "service not found"})
+	}
+	if err != nil {
+		return "", c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not fetch service"})
+	}
+	return status, nil
+}
+
+// PATCH /marketplace/services/:id
+// Seller edits any subset of the listing, or pauses/resumes it with status.
+// Orders already placed keep the snapshot they were bought with.
+func UpdateService(c echo.Context) error {
+	uid, ok := c.Get("user_id").(string)
+	if !ok || uid == "" {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "unauthorized"})
+	}
+	var req struct {
+		Title              *string                `json:"title"`
+		Description        *string                `json:"description"`
+		Price              *int64                 `json:"price"`
+		Category           *string                `json:"category"`
+		DeliveryTimeDays   *int                   `json:"delivery_time_days"`
+		RevisionsIncluded  *int                   `json:"revisions_included"`
+		ExtraRevisionPrice *int64                 `json:"extra_revision_price"`
+		Requirements       *[]RequirementQuestion `json:"requirements"`
+		Packages           *[]ServicePackage      `json:"packages"` // replaces the tiers; omitted tiers are withdrawn
+		Extras             *[]ServiceExtra        `json:"extras"`   // extras sent with their id are updated, others added
+		Status             *string                `json:"status"`   // active or paused
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid request"})
+	}
+
+	var changed []string
+	if req.Title != nil {
+		if *req.Title = strings.TrimSpace(*req.Title); *req.Title == "" {
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": "title cannot be empty"})
+		}
+		changed = append(changed, "title")
+	}
+	if req.Description != nil {
+		changed = append(changed, "description")
+	}
+	if req.Category != nil {
+		changed = append(changed, "category")
+	}
+	if req.Price != nil {
+		if *req.Price <= 0 {
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": "price must be > 0"})
+		}
+		changed = append(changed, "price")
+	}
+	if req.DeliveryTimeDays != nil {
+		if *req.DeliveryTimeDays < 0 {
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": "delivery_time_days must be >= 0"})
+		}
+		changed = append(changed, "delivery_time_days")
+	}
+	if req.RevisionsIncluded != nil || req.ExtraRevisionPrice != nil {
+		if (req.RevisionsIncluded != nil && *req.RevisionsIncluded < 0) || (req.ExtraRevisionPrice != nil && *req.ExtraRevisionPrice <= 0) {
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": "revisions_included must be >= 0 and extra_revision_price > 0"})
+		}
+		changed = append(changed, "revisions")
+	}
+	var requirements any
+	if req.Requirements != nil {
+		if msg := validateQuestions(*req.Requirements); msg != "" {
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": msg})
+		}
+		if *req.Requirements == nil {
+			*req.Requirements = []RequirementQuestion{}
+		}
+		requirements = *req.Requirements
+		changed = append(changed, "requirements")
+	}
+	var pkgs []ServicePackage
+	var extras []ServiceExtra
+	if req.Packages != nil {
+		pkgs = *req.Packages
+		changed = append(changed, "packages")
+	}
+	if req.Extras != nil {
+		extras = *req.Extras
+		changed = append(changed, "extras")
+	}
+	if msg := validateCatalog(pkgs, extras); msg != "" {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": msg})
+	}
+	if req.Status != nil {
+		if *req.Status != ServiceActive && *req.Status != ServicePaused {
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": "status must be active or paused"})
+		}
+		changed = append(changed, "status:"+*req.Status)
+	}
+	if len(changed) == 0 {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "nothing to update"})
+	}
+
+	ctx := context.Background()
+	tx, err := db.Conn.Begin(ctx)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "transaction start failed"})
+	}
+	defer tx.Rollback(ctx)
+
+	status, err := lockOwnService(c, ctx, tx, uid)
+	if status == "" {
+		return err
+	}
+	if req.Status != nil && status != ServiceActive && status != ServicePaused {
+		return c.JSON(http.StatusConflict, echo.Map{"error": "service is " + status + " and can only be reactivated by an admin"})
+	}
+	serviceID := c.Param("id")
+
+	if req.Packages != nil || req.Extras != nil {
+		if err = replaceCatalog(ctx, tx, serviceID, req.Packages, req.Extras); err != nil {
+			return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not update packages"})
+		}
+	}
+	var version int
+	err = tx.QueryRow(ctx,
+		`UPDATE services SET title = COALESCE($2, title), description = COALESCE($3, description),
+		        category = COALESCE($4, category), delivery_time_days = COALESCE($5, delivery_time_days),
+		        revisions_included = COALESCE($6, revisions_included), extra_revision_price = COALESCE($7, extra_revision_price),
+		        requirements = COALESCE($8, requirements), status = COALESCE($9, status),
+		        -- with packages the listed price is the cheapest tier
+		        price = COALESCE((SELECT MIN(p.price) FROM service_packages p WHERE p.service_id = services.id AND p.active), $10, price),
+		        version = version + 1, updated_at = NOW()
+		 WHERE id = $1
+		 RETURNING version`,
+		serviceID, req.Title, req.Description, req.Category, req.DeliveryTimeDays,
+		req.RevisionsIncluded, req.ExtraRevisionPrice, requirements, req.Status, req.Price,
+	).Scan(&version)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not update service"})
+	}
+	if err = RecordServiceVersion(ctx, tx, serviceID, uid, strings.Join(changed, ",")); err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not update service"})
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "commit failed"})
+	}
+	if req.Status != nil {
+		status = *req.Status
+	}
+	return c.JSON(http.StatusOK, echo.Map{
+		"service_id": serviceID,
+		"version":    version,
+		"status":     status,
+		"changed":    changed,
+		"message":    "service updated",
+	})
+}
+
+// DELETE /marketplace/services/:id
+// Removes the listing from the marketplace. The row is kept so existing
+// orders, reviews and statements still resolve.
+func DeleteService(c echo.Context) error {
+	uid, ok := c.Get("user_id").(string)
+	if !ok || uid == "" {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "unauthorized"})
+	}
+
+	ctx := context.Background()
+	tx, err := db.Conn.Begin(ctx)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "transaction start failed"})
+	}
+	defer tx.Rollback(ctx)
+
+	status, err := lockOwnService(c, ctx, tx, uid)
+	if status == "" {
+		return err
+	}
+	if err = SetServiceStatus(ctx, tx, c.Param("id"), ServiceDeleted, uid, "deleted"); err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not delete service"})
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "commit failed"})
+	}
+	return c.JSON(http.StatusOK, echo.Map{"service_id": c.Param("id"), "message": "service deleted"})
+}
+
+// GET /marketplace/services/:id/versions
+// The service's change history, newest first. Seller and admins only.
+func ListServiceVersions(c echo.Context) error {
+	uid, ok := c.Get("user_id").(string)
+	if !ok || uid == "" {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "unauthorized"})
+	}
+	role, _ := c.Get("role").(string)
+	ctx := context.Background()
+
+	var ownerID string
+	err := db.Conn.QueryRow(ctx, `SELECT user_id::text FROM services WHERE id::text = $1`, c.Param("id")).Scan(&ownerID)
+	if err != nil || (ownerID != uid && role != "admin") {
+		return c.JSON(http.StatusNotFound, echo.Map{"error": "service not found"})
+	}
+
+	rows, err := db.Conn.Query(ctx,
+		`SELECT version, title, COALESCE(description, ''), price, COALESCE(category, ''), COALESCE(delivery_time_days, 0),
+		        revisions_included, extra_revision_price, requirements, packages, extras, status, change, edited_by::text, created_at
+		 FROM service_versions WHERE service_id::text = $1 ORDER BY version DESC`, c.Param("id"),
+	)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not fetch versions"})
+	}
+	defer rows.Close()
+
+	versions := []ServiceVersion{}
+	for rows.Next() {
+		var v ServiceVersion
+		if err := rows.Scan(&v.Version, &v.Title, &v.Description, &v.Price, &v.Category, &v.DeliveryTimeDays,
+			&v.RevisionsIncluded, &v.ExtraRevisionPrice, &v.Requirements, &v.Packages, &v.Extras,
+			&v.Status, &v.Change, &v.EditedBy, &v.CreatedAt); err != nil {
+			return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to parse version"})
+		}
+		versions = append(versions, v)
+	}
+	return c.JSON(http.StatusOK, echo.Map{"service_id": c.Param("id"), "versions": versions})
+}
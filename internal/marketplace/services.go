@@ -2,10 +2,8 @@ package marketplace
 
 import (
     "context"
-    "fmt"
     "net/http"
     "strconv"
-    "strings"
     "time"
 
     "github.com/google/uuid"
@@ -27,20 +25,43 @@ func CreateService(c echo.Context) error {
         Price             float64 `json:"price"`
         Category          string  `json:"category"`
         DeliveryTimeDays  int     `json:"delivery_time_days"`
+        RevisionsIncluded  int    `json:"revisions_included"`
+        ExtraRevisionPrice *int64 `json:"extra_revision_price"` // omit to not offer paid extra revisions
+        Packages          []ServicePackage `json:"packages"` // optional basic/standard/premium tiers
+        Extras            []ServiceExtra   `json:"extras"`
+        Requirements      []RequirementQuestion `json:"requirements"` // asked of the buyer when ordering
     }
 	if err := c.Bind(&req); err != nil {
 		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid request"})
 	}
 
+    if msg := validateQuestions(req.Requirements); msg != "" {
+        return c.JSON(http.StatusBadRequest, echo.Map{"error": msg})
+    }
+    if req.Requirements == nil {
+        req.Requirements = []RequirementQuestion{}
+    }
+    if msg := validateCatalog(req.Packages, req.Extras); msg != "" {
+        return c.JSON(http.StatusBadRequest, echo.Map{"error": msg})
+    }
+    // With packages the listed price is the "starting at" price
+    for i, p := range req.Packages {
+        if i == 0 || float64(p.Price) < req.Price {
+            req.Price = float64(p.Price)
+        }
+    }
     if req.Title == "" || req.Price <= 0 {
         return c.JSON(http.StatusBadRequest, echo.Map{"error": "title and valid price are required"})
     }
+    if req.RevisionsIncluded < 0 || (req.ExtraRevisionPrice != nil && *req.ExtraRevisionPrice <= 0) {
+        return c.JSON(http.StatusBadRequest, echo.Map{"error": "revisions_included must be >= 0 and extra_revision_price > 0"})
+    }
 
     // Enforce role-based listing limits
     // Fans: up to 3 services; Creators: up to 50 services
     var serviceCount int
     if err := db.Conn.QueryRow(context.Background(),
-        `SELECT COUNT(*) FROM services WHERE user_id = $1`, uid,
+        `SELECT COUNT(*) FROM services WHERE user_id = $1 AND COALESCE(status, 'active') <> 'deleted'`, uid,
     ).Scan(&serviceCount); err == nil {
         var maxAllowed int = 3
         if role == "creator" {
@@ -58,32 +79,52 @@ func CreateService(c echo.Context) error {
 
 	serviceID := uuid.New().String()
 
-	_, err := db.Conn.Exec(
-		context.Background(),
-		`INSERT INTO services (id, user_id, title, description, price, category, delivery_time_days, status, created_at)
-		 VALUES ($1, $2, $3, $4, $5, $6, $7, 'active', $8)`,
-		serviceID, uid, req.Title, req.Description, req.Price, req.Category, req.DeliveryTimeDays, time.Now(),
+	ctx := context.Background()
+	tx, err := db.Conn.Begin(ctx)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not create service"})
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(
+		ctx,
+		`INSERT INTO services (id, user_id, title, description, price, category, delivery_time_days, revisions_included, extra_revision_price, requirements, status, created_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, 'active', $11)`,
+		serviceID, uid, req.Title, req.Description, req.Price, req.Category, req.DeliveryTimeDays, req.RevisionsIncluded, req.ExtraRevisionPrice, req.Requirements, time.Now(),
 	)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not create service"})
 	}
+	if err = insertCatalog(ctx, tx, serviceID, req.Packages, req.Extras); err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not create service packages"})
+	}
+	if err = RecordServiceVersion(ctx, tx, serviceID, uid, "created"); err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not create service"})
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not create service"})
+	}
 
 	return c.JSON(http.StatusCreated, echo.Map{
-		"service_id": serviceID,
-		"message":    "service created successfully",
+		"service_id":   serviceID,
+		"packages":     req.Packages,
+		"extras":       req.Extras,
+		"requirements": req.Requirements,
+		"message":      "service created successfully",
 	})
 }
 
-// GetAllServices returns all services visible in the marketplace
+// GetAllServices returns all services visible in the marketplace.
+// With q, services are matched on full text with prefix and typo tolerance
+// and sort=relevance (the default then) ranks the best matches first.
+// Facet counts for categories, delivery time, price and rating are returned
+// alongside; pass no_facets=true to skip them.
 func GetAllServices(c echo.Context) error {
-    // Optional search and pagination
-    q := c.QueryParam("q")
-    minPrice := c.QueryParam("min_price")
-    maxPrice := c.QueryParam("max_price")
-    category := c.QueryParam("category")
-    deliveryMax := c.QueryParam("delivery_time_max")
-    ratingMin := c.QueryParam("rating_min")
+    f := parseServiceFilters(c)
     sort := c.QueryParam("sort")
+    if sort == "" && f.q != "" {
+        sort = "relevance"
+    }
     limit := 20
     offset := 0
     if l := c.QueryParam("limit"); l != "" {
@@ -97,111 +138,85 @@ func GetAllServices(c echo.Context) error {
         }
     }
 
-    // Build dynamic conditions
-    // Aggregated query to support rating filter/sort
-    query := `SELECT s.id, s.user_id, s.title, s.description, s.price, s.category, s.delivery_time_days, s.status, s.created_at,
-                     COALESCE(AVG(r.rating)::float, 0) AS avg_rating
+    var args sqlArgs
+    rank, titleHL, descHL := "NULL::float8", "NULL::text", "NULL::text"
+    if f.q != "" {
+        tsq := f.tsquery(&args)
+        rank = "ts_rank(s.search_vector, " + tsq + ") + " + typoRankWeight + " * word_similarity(" + args.add(f.q) + ", s.title)"
+        titleHL = "ts_headline('" + searchConfig + "', s.title, " + tsq + ", '" + titleHeadlineOpts + "')"
+        descHL = "ts_headline('" + searchConfig + "', COALESCE(s.description, ''), " + tsq + ", '" + descriptionHeadlineOpts + "')"
+    }
+    query := `SELECT s.id, s.user_id, s.title, COALESCE(s.description, ''), s.price, COALESCE(s.category, ''), COALESCE(s.delivery_time_days, 0),
+                     s.revisions_included, s.extra_revision_price, COALESCE(s.status, 'active'), s.version, s.created_at, s.rating_avg,
+                     COALESCE((SELECT MIN(p.price) FROM service_packages p WHERE p.service_id = s.id AND p.active), s.price) AS starting_at,
+                     ` + rank + ` AS rank, ` + titleHL + `, ` + descHL + `
               FROM services s
-              LEFT JOIN orders o ON o.service_id = s.id
-              LEFT JOIN reviews r ON r.order_id = o.id`
-    var where []string
-    var args []any
-
-    if q != "" {
-        where = append(where, "(title ILIKE $%d OR description ILIKE $%d)")
-        // We'll add the same arg twice for title and description
-        qArg := "%" + q + "%"
-        args = append(args, qArg, qArg)
-    }
-    if minPrice != "" {
-        where = append(where, "s.price >= $%d")
-        args = append(args, minPrice)
-    }
-    if maxPrice != "" {
-        where = append(where, "s.price <= $%d")
-        args = append(args, maxPrice)
-    }
-    if category != "" {
-        where = append(where, "s.category = $%d")
-        args = append(args, category)
-    }
-    if deliveryMax != "" {
-        where = append(where, "s.delivery_time_days <= $%d")
-        args = append(args, deliveryMax)
-    }
-    if ratingMin != "" {
-        // We will apply HAVING after GROUP BY; keep placeholder for now
-        // Use a marker to render later
-    }
-
-    // Replace placeholders with correct positions
-    // Build WHERE with correct $n index expansion
-    if len(where) > 0 {
-        // We need to render the %d with actual indices
-        // Create a rendered slice
-        rendered := make([]string, len(where))
-        idx := 1
-        for i, w := range where {
-            // count occurrences of %d in w
-            // For simplicity, handle up to two %d per condition (title/description)
-            if strings.Count(w, "%d") == 2 {
-                rendered[i] = fmt.Sprintf(w, idx, idx+1)
-                idx += 2
-            } else {
-                rendered[i] = fmt.Sprintf(w, idx)
-                idx++
-            }
-        }
-        query += " WHERE " + strings.Join(rendered, " AND ")
-        // Keep idx for later appends
-        // idx reflects next parameter position
-        // We will reuse it below
-        // But since idx is local, recompute current parameter count
-    }
-    // Group by service fields
-    query += " GROUP BY s.id ORDER BY "
+              WHERE ` + f.conditions(&args, "") + `
+              ORDER BY `
     switch sort {
+    case "relevance":
+        if f.q != "" {
+            query += "rank DESC, "
+        }
+        query += "s.created_at DESC"
     case "price_asc":
         query += "s.price ASC"
     case "price_desc":
         query += "s.price DESC"
     case "rating_desc":
-        query += "avg_rating DESC"
+        query += "s.rating_avg DESC, s.rating_count DESC"
     case "oldest":
         query += "s.created_at ASC"
     default:
         query += "s.created_at DESC"
     }
-    // Optional rating_min HAVING clause
-    if ratingMin != "" {
-        // Append HAVING with next parameter index
-        currentIdx := 1
-        for range args { currentIdx++ }
-        query = strings.Replace(query, " GROUP BY s.id ORDER BY ", fmt.Sprintf(" GROUP BY s.id HAVING COALESCE(AVG(r.rating)::float,0) >= $%d ORDER BY ", currentIdx), 1)
-        args = append(args, ratingMin)
-    }
-    // Append limit and offset with next indices
-    currentIdx := 1
-    for range args { currentIdx++ }
-    query += fmt.Sprintf(" LIMIT $%d OFFSET $%d", currentIdx, currentIdx+1)
-    args = append(args, limit, offset)
-
-    rows, err := db.Conn.Query(context.Background(), query, args...)
+    query += " LIMIT " + args.add(limit) + " OFFSET " + args.add(offset)
+
+    // The typo threshold is set for this transaction only so <% can use the trigram index
+    ctx := context.Background()
+    tx, err := db.Conn.Begin(ctx)
+    if err != nil {
+        return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not fetch services"})
+    }
+    defer tx.Rollback(ctx)
+    if _, err = tx.Exec(ctx, `SELECT set_config('pg_trgm.word_similarity_threshold', $1, true)`, typoSimilarity); err != nil {
+        return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not fetch services"})
+    }
+
+    rows, err := tx.Query(ctx, query, args...)
     if err != nil {
         return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not fetch services"})
     }
     defer rows.Close()
 
-    var services []ServiceSummary
+    services := []ServiceSummary{}
     for rows.Next() {
         var s ServiceSummary
-        if err := rows.Scan(&s.ID, &s.UserID, &s.Title, &s.Description, &s.Price, &s.Category, &s.DeliveryTimeDays, &s.Status, &s.CreatedAt, &s.AvgRating); err != nil {
+        var title, description *string
+        if err := rows.Scan(&s.ID, &s.UserID, &s.Title, &s.Description, &s.Price, &s.Category, &s.DeliveryTimeDays, &s.RevisionsIncluded, &s.ExtraRevisionPrice,
+            &s.Status, &s.Version, &s.CreatedAt, &s.AvgRating, &s.StartingAt, &s.Rank, &title, &description); err != nil {
             return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to parse service record"})
         }
+        if title != nil && description != nil {
+            s.Highlight = &ServiceHighlight{Title: highlight(*title), Description: highlight(*description)}
+        }
         services = append(services, s)
     }
+    rows.Close()
+    if err := rows.Err(); err != nil {
+        return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not fetch services"})
+    }
 
-    return c.JSON(http.StatusOK, echo.Map{"services": services})
+    // Facet counts share the transaction so they see the same catalog as the page
+    resp := echo.Map{"services": services}
+    if skip, _ := strconv.ParseBool(c.QueryParam("no_facets")); !skip {
+        facets, err := serviceFacets(ctx, tx, f)
+        if err != nil {
+            return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not count facets"})
+        }
+        resp["facets"] = facets
+    }
+    return c.JSON(http.StatusOK, resp)
 }
 
 // GetUserServices returns all services created by the authenticated user
@@ -213,8 +228,8 @@ func GetUserServices(c echo.Context) error {
 
 	rows, err := db.Conn.Query(
 		context.Background(),
-		`SELECT id, user_id, title, description, price, created_at
-		 FROM services WHERE user_id = $1 ORDER BY created_at DESC`,
+		`SELECT id, user_id, title, description, price, revisions_included, extra_revision_price, COALESCE(status, 'active'), version, created_at
+		 FROM services WHERE user_id = $1 AND COALESCE(status, 'active') <> 'deleted' ORDER BY created_at DESC`,
 		uid,
 	)
 	if err != nil {
@@ -225,7 +240,7 @@ func GetUserServices(c echo.Context) error {
 	var services []Service
 	for rows.Next() {
 		var s Service
-		if err := rows.Scan(&s.ID, &s.UserID, &s.Title, &s.Description, &s.Price, &s.CreatedAt); err != nil {
+		if err := rows.Scan(&s.ID, &s.UserID, &s.Title, &s.Description, &s.Price, &s.RevisionsIncluded, &s.ExtraRevisionPrice, &s.Status, &s.Version, &s.CreatedAt); err != nil {
 			return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to parse service record"})
 		}
 		services = append(services, s)
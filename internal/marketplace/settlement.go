@@ -0,0 +1,160 @@
+package marketplace
+
+import (
+	"context"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/sudo-init-do/crafthub/internal/ledger"
+	"github.com/sudo-init-do/crafthub/internal/orders"
+)
+
+// Settlement modes for a disputed order
+const (
+	SettleRefund  = "refund"  // everything back to the buyer
+	SettleRelease = "release" // everything to the seller, less the platform fee
+	SettleSplit   = "split"   // part refunded, the rest released
+)
+
+var (
+	ErrNotSettleable     = errors.New("order cannot be settled in its current status")
+	ErrInvalidSettlement = errors.New("invalid settlement")
+)
+
+// Settlement describes how an order's escrow is divided. For a split, give
+// either RefundAmount or RefundPercent (0-100) of the order amount.
+type Settlement struct {
+	Mode          string
+	RefundAmount  int64
+	RefundPercent float64
+}
+
+// SettlementResult is the breakdown of a settled order
+type SettlementResult struct {
+	OrderID     string `json:"order_id"`
+	BuyerID     string `json:"buyer_id"`
+	SellerID    string `json:"seller_id"`
+	Mode        string `json:"mode"`
+	OrderAmount int64  `json:"order_amount"`
+	BuyerRefund int64  `json:"buyer_refund"`
+	SellerGross int64  `json:"seller_gross"`
+	PlatformFee int64  `json:"platform_fee"`
+	SellerNet   int64  `json:"seller_net"`
+	OrderStatus string `json:"order_status"`
+}
+
+// settleActions maps each settlement mode to its order transition
+var settleActions = map[string]string{
+	SettleRefund:  orders.ActionSettleRefund,
+	SettleRelease: orders.ActionSettleRelease,
+	SettleSplit:   orders.ActionSettleSplit,
+}
+
+// SettleOrder divides the order's escrow (or hold, for a refund of an order
+// not yet accepted) between buyer and seller inside tx through the order's
+// settle transitions, which require an open dispute. The platform fee is
+// charged pro rata on the seller's share. actorType/actorID identify who
+// settled it for the order's event log.
+func SettleOrder(ctx context.Context, tx pgx.Tx, orderID, actorType, actorID string, s Settlement) (*SettlementResult, error) {
+	action, ok := settleActions[s.Mode]
+	if !ok {
+		return nil, ErrInvalidSettlement
+	}
+	r := &SettlementResult{OrderID: orderID, Mode: s.Mode}
+	opts := orders.Options{Details: map[string]any{"mode": s.Mode}}
+	opts.Effect = func(ctx context.Context, tx pgx.Tx, o *orders.Order, or *orders.Result) error {
+		r.BuyerID, r.SellerID, r.OrderAmount = o.BuyerID, o.SellerID, o.Amount
+		if s.Mode != SettleSplit {
+			return nil
+		}
+		if err := splitShares(r, o.PlatformFee, s); err != nil {
+			return err
+		}
+		if err := splitOrderFunds(ctx, tx, r); err != nil {
+			return err
+		}
+		or.Refunded, or.SellerNet, or.PlatformFee = r.BuyerRefund, r.SellerNet, r.PlatformFee
+		_, err := tx.Exec(ctx, `UPDATE orders SET refunded_amount = $2, platform_fee = $3 WHERE id = $1`,
+			orderID, r.BuyerRefund, r.PlatformFee)
+		return err
+	}
+
+	res, err := orders.ApplyTx(ctx, tx, orderID, action, actorType, actorID, opts)
+	if errors.Is(err, orders.ErrInvalidTransition) || errors.Is(err, orders.ErrPrecondition) {
+		return nil, ErrNotSettleable
+	}
+	if err != nil {
+		return nil, err
+	}
+	if s.Mode == SettleRelease {
+		r.SellerGross = res.Amount
+		r.SellerNet, r.PlatformFee = res.SellerNet, res.PlatformFee
+	}
+	if s.Mode == SettleRefund {
+		r.BuyerRefund = res.Refunded
+	}
+	r.OrderStatus = res.Status
+	return r, nil
+}
+
+// splitShares fills in the buyer's refund and the seller's gross, fee and
+// net for a split of r.OrderAmount. fee is the order's full platform fee.
+func splitShares(r *SettlementResult, fee int64, s Settlement) error {
+	if fee < 0 || fee > r.OrderAmount {
+		fee = 0
+	}
+	refund := s.RefundAmount
+	if s.RefundPercent != 0 {
+		if s.RefundAmount != 0 || s.RefundPercent < 0 || s.RefundPercent > 100 {
+			return ErrInvalidSettlement
+		}
+		refund = int64(math.Round(float64(r.OrderAmount) * s.RefundPercent / 100))
+	}
+	// A split must leave something for each side; use refund or release otherwise
+	if refund <= 0 || refund >= r.OrderAmount {
+		return ErrInvalidSettlement
+	}
+	r.BuyerRefund = refund
+	r.SellerGross = r.OrderAmount - refund
+	r.PlatformFee = fee * r.SellerGross / r.OrderAmount
+	r.SellerNet = r.SellerGross - r.PlatformFee
+	return nil
+}
+
+// splitOrderFunds pays the escrow out in one entry: the refund to the buyer,
+// the seller's net share and the pro-rated fee to platform revenue.
+func splitOrderFunds(ctx context.Context, tx pgx.Tx, r *SettlementResult) error {
+	lines := []ledger.Line{
+		{Account: ledger.OrderEscrow(r.OrderID), Amount: -r.OrderAmount},
+		{Account: ledger.UserAvailable(r.BuyerID), Amount: r.BuyerRefund},
+	}
+	if r.SellerNet > 0 {
+		lines = append(lines, ledger.Line{Account: ledger.UserAvailable(r.SellerID), Amount: r.SellerNet})
+	}
+	if r.PlatformFee > 0 {
+		lines = append(lines, ledger.Line{Account: ledger.PlatformRevenue(), Amount: r.PlatformFee})
+	}
+	if _, err := ledger.Post(ctx, tx, ledger.Entry{Kind: ledger.EntryOrderSettlement, Reference: r.OrderID, Lines: lines}); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if _, err := tx.Exec(ctx,
+		`INSERT INTO transactions (user_id, amount, type, status, reference, created_at)
+         VALUES ($1, $2, 'credit', 'refunded', $3, $4)`,
+		r.BuyerID, r.BuyerRefund, r.OrderID, now,
+	); err != nil {
+		return err
+	}
+	if r.SellerNet == 0 {
+		return nil
+	}
+	_, err := tx.Exec(ctx,
+		`INSERT INTO transactions (user_id, amount, type, status, reference, created_at)
+         VALUES ($1, $2, 'credit', 'credited', $3, $4)`,
+		r.SellerID, r.SellerNet, r.OrderID, now,
+	)
+	return err
+}
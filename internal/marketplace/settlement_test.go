@@ -0,0 +1,58 @@
+package marketplace
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSplitShares(t *testing.T) {
+	tests := []struct {
+		name                         string
+		amount, fee                  int64
+		s                            Settlement
+		err                          error
+		refund, gross, platform, net int64
+	}{
+		{name: "amount", amount: 10000, fee: 1000, s: Settlement{RefundAmount: 4000},
+			refund: 4000, gross: 6000, platform: 600, net: 5400},
+		{name: "percent", amount: 10000, fee: 1000, s: Settlement{RefundPercent: 25},
+			refund: 2500, gross: 7500, platform: 750, net: 6750},
+		{name: "percent rounds to nearest", amount: 999, fee: 0, s: Settlement{RefundPercent: 50},
+			refund: 500, gross: 499, platform: 0, net: 499},
+		{name: "fee rounds down", amount: 1000, fee: 99, s: Settlement{RefundAmount: 1},
+			refund: 1, gross: 999, platform: 98, net: 901},
+		{name: "no fee", amount: 5000, fee: 0, s: Settlement{RefundAmount: 2000},
+			refund: 2000, gross: 3000, platform: 0, net: 3000},
+		{name: "negative fee ignored", amount: 5000, fee: -10, s: Settlement{RefundAmount: 2000},
+			refund: 2000, gross: 3000, platform: 0, net: 3000},
+		{name: "fee above amount ignored", amount: 5000, fee: 6000, s: Settlement{RefundAmount: 2000},
+			refund: 2000, gross: 3000, platform: 0, net: 3000},
+		{name: "zero refund", amount: 10000, s: Settlement{}, err: ErrInvalidSettlement},
+		{name: "full refund", amount: 10000, s: Settlement{RefundAmount: 10000}, err: ErrInvalidSettlement},
+		{name: "refund above amount", amount: 10000, s: Settlement{RefundAmount: 12000}, err: ErrInvalidSettlement},
+		{name: "negative refund", amount: 10000, s: Settlement{RefundAmount: -1}, err: ErrInvalidSettlement},
+		{name: "percent and amount", amount: 10000, s: Settlement{RefundAmount: 100, RefundPercent: 10}, err: ErrInvalidSettlement},
+		{name: "percent over 100", amount: 10000, s: Settlement{RefundPercent: 101}, err: ErrInvalidSettlement},
+		{name: "negative percent", amount: 10000, s: Settlement{RefundPercent: -5}, err: ErrInvalidSettlement},
+		{name: "percent rounds to nothing", amount: 10, s: Settlement{RefundPercent: 1}, err: ErrInvalidSettlement},
+	}
+	for _, tt := range tests {
+		tt.s.Mode = SettleSplit
+		r := &SettlementResult{OrderAmount: tt.amount}
+		err := splitShares(r, tt.fee, tt.s)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.err)
+			continue
+		}
+		if tt.err != nil {
+			continue
+		}
+		if r.BuyerRefund != tt.refund || r.SellerGross != tt.gross || r.PlatformFee != tt.platform || r.SellerNet != tt.net {
+			t.Errorf("%s: got refund %d, gross %d, fee %d, net %d; want %d, %d, %d, %d", tt.name,
+				r.BuyerRefund, r.SellerGross, r.PlatformFee, r.SellerNet, tt.refund, tt.gross, tt.platform, tt.net)
+		}
+		if r.BuyerRefund+r.SellerNet+r.PlatformFee != tt.amount {
+			t.Errorf("%s: shares do not add up to the order amount", tt.name)
+		}
+	}
+}
@@ -127,12 +127,12 @@ func ListMessages(c echo.Context) error {
 			return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid since timestamp, use RFC3339"})
 		}
 		rows, err = db.Conn.Query(context.Background(),
-			`SELECT id, sender_id, recipient_id, content, created_at, read_at
+			`SELECT id, sender_id, recipient_id, content, offer_id::text, created_at, read_at
              FROM messages WHERE order_id = $1 AND created_at > $2 ORDER BY created_at ASC`, orderID, sinceTime,
 		)
 	} else {
 		rows, err = db.Conn.Query(context.Background(),
-			`SELECT id, sender_id, recipient_id, content, created_at, read_at
+			`SELECT id, sender_id, recipient_id, content, offer_id::text, created_at, read_at
              FROM messages WHERE order_id = $1 ORDER BY created_at ASC`, orderID,
 		)
 	}
@@ -146,6 +146,7 @@ func ListMessages(c echo.Context) error {
 		SenderID    string      `json:"sender_id"`
 		RecipientID string      `json:"recipient_id"`
 		Content     string      `json:"content"`
+		OfferID     *string     `json:"offer_id,omitempty"` // set when the message carries a custom offer
 		CreatedAt   string      `json:"created_at"`
 		ReadAt      interface{} `json:"read_at"`
 	}
@@ -155,7 +156,7 @@ func ListMessages(c echo.Context) error {
 		var m message
 		var readAt sql.NullTime
 		var createdAt sql.NullTime
-		if err := rows.Scan(&m.ID, &m.SenderID, &m.RecipientID, &m.Content, &createdAt, &readAt); err != nil {
+		if err := rows.Scan(&m.ID, &m.SenderID, &m.RecipientID, &m.Content, &m.OfferID, &createdAt, &readAt); err != nil {
 			return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to parse record"})
 		}
 		if createdAt.Valid {
@@ -0,0 +1,122 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sudo-init-do/crafthub/internal/db"
+)
+
+const (
+	IdempotencyHeader = "Idempotency-Key"
+	// keys older than this are treated as unused
+	idempotencyTTL = "24 hours"
+)
+
+// Idempotency makes a route safe to retry. Requests carrying an
+// Idempotency-Key header are recorded per user along with a fingerprint of
+// the method, path and body; a retry with the same key replays the stored
+// response, and a key reused for a different request is rejected with 422.
+// Requests without the header pass through unchanged. Must run after JWTMiddleware.
+func Idempotency(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		key := c.Request().Header.Get(IdempotencyHeader)
+		if key == "" {
+			return next(c)
+		}
+		if len(key) > 255 {
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": "Idempotency-Key too long"})
+		}
+		userID, _ := c.Get("user_id").(string)
+		if userID == "" {
+			return c.JSON(http.StatusUnauthorized, echo.Map{"error": "unauthorized"})
+		}
+
+		req := c.Request()
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": "could not read request body"})
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+
+		sum := sha256.New()
+		sum.Write([]byte(req.Method + "\n" + req.URL.Path + "\n"))
+		sum.Write(body)
+		fingerprint := hex.EncodeToString(sum.Sum(nil))
+
+		ctx := context.Background()
+		// Claim the key; stale keys are taken over
+		ct, err := db.Conn.Exec(ctx, `
+            INSERT INTO idempotency_keys (user_id, key, fingerprint, method, path, created_at)
+            VALUES ($1, $2, $3, $4, $5, NOW())
+            ON CONFLICT (user_id, key) DO UPDATE
+                SET fingerprint = EXCLUDED.fingerprint, method = EXCLUDED.method, path = EXCLUDED.path,
+                    status_code = NULL, content_type = NULL, response_body = NULL,
+                    created_at = NOW(), completed_at = NULL
+                WHERE idempotency_keys.created_at < NOW() - INTERVAL '`+idempotencyTTL+`'`,
+			userID, key, fingerprint, req.Method, req.URL.Path,
+		)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not record idempotency key"})
+		}
+
+		if ct.RowsAffected() == 0 {
+			var storedFingerprint string
+			var status *int
+			var contentType *string
+			var stored []byte
+			if err := db.Conn.QueryRow(ctx,
+				`SELECT fingerprint, status_code, content_type, response_body FROM idempotency_keys WHERE user_id = $1 AND key = $2`,
+				userID, key,
+			).Scan(&storedFingerprint, &status, &contentType, &stored); err != nil {
+				return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not read idempotency key"})
+			}
+			if storedFingerprint != fingerprint {
+				return c.JSON(http.StatusUnprocessableEntity, echo.Map{"error": "Idempotency-Key was already used for a different request"})
+			}
+			if status == nil {
+				return c.JSON(http.StatusConflict, echo.Map{"error": "a request with this Idempotency-Key is still in progress"})
+			}
+			ctype := echo.MIMEApplicationJSON
+			if contentType != nil && *contentType != "" {
+				ctype = *contentType
+			}
+			c.Response().Header().Set("Idempotent-Replayed", "true")
+			return c.Blob(*status, ctype, stored)
+		}
+
+		rec := &responseRecorder{ResponseWriter: c.Response().Writer}
+		c.Response().Writer = rec
+		herr := next(c)
+
+		status := c.Response().Status
+		if herr != nil || status >= 500 {
+			// Let the client retry failed requests with the same key
+			_, _ = db.Conn.Exec(ctx, `DELETE FROM idempotency_keys WHERE user_id = $1 AND key = $2`, userID, key)
+			return herr
+		}
+		_, _ = db.Conn.Exec(ctx, `
+            UPDATE idempotency_keys
+            SET status_code = $3, content_type = $4, response_body = $5, completed_at = NOW()
+            WHERE user_id = $1 AND key = $2`,
+			userID, key, status, c.Response().Header().Get(echo.HeaderContentType), rec.body.Bytes(),
+		)
+		return nil
+	}
+}
+
+// responseRecorder copies the response body while it is written
+type responseRecorder struct {
+	http.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
@@ -0,0 +1,118 @@
+package orders
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/sudo-init-do/crafthub/internal/db"
+)
+
+var (
+	ErrNoDeadline = errors.New("order has no delivery deadline to extend")
+	// ErrRequirementsLocked is returned when a buyer would leave a required
+	// answer empty after the delivery clock has started
+	ErrRequirementsLocked = errors.New("required answers cannot be cleared once the delivery clock has started")
+)
+
+// SET clauses that keep the delivery deadline in step with transitions
+const (
+	// Accepting starts the clock from the service's delivery time, unless
+	// the buyer still owes answers to the order's requirements
+	setDueOnAccept = "due_at = CASE WHEN delivery_days > 0 AND requirements_completed_at IS NOT NULL " +
+		"THEN NOW() + make_interval(days => delivery_days) END"
+	// The first delivery decides whether the order counts as on time
+	setFirstDelivery = "first_delivered_at = COALESCE(first_delivered_at, NOW()), " +
+		"delivered_on_time = COALESCE(delivered_on_time, due_at IS NULL OR NOW() <= due_at)"
+	// A revision gives the seller a fresh delivery window
+	setDueOnRevision = "due_at = CASE WHEN delivery_days > 0 THEN NOW() + make_interval(days => delivery_days) ELSE due_at END, " +
+		"due_reminder_sent_at = NULL, overdue_notified_at = NULL"
+)
+
+// cancelRefund refunds a buyer's cancellation in full. Buyers keep the
+// cancel rights they had before deadlines existed; an overdue cancellation
+// is flagged in the order's event history.
+func cancelRefund(ctx context.Context, tx pgx.Tx, o *Order, r *Result) error {
+	if o.Status != StatusPendingAcceptance {
+		if err := tx.QueryRow(ctx,
+			`SELECT due_at IS NOT NULL AND due_at < NOW() FROM orders WHERE id = $1`, o.ID,
+		).Scan(&r.Overdue); err != nil {
+			return err
+		}
+	}
+	return refund(ctx, tx, o, r)
+}
+
+// ExtendDeadline pushes the due date of a locked, in-progress order back by
+// days, counted from now if it has already passed. Reminders are re-armed.
+func ExtendDeadline(ctx context.Context, tx pgx.Tx, o *Order, days int) (time.Time, error) {
+	var dueAt time.Time
+	if o.Status != StatusInProgress {
+		return dueAt, ErrInvalidTransition
+	}
+	err := tx.QueryRow(ctx,
+		`UPDATE orders SET due_at = GREATEST(due_at, NOW()) + make_interval(days => $2),
+		        due_reminder_sent_at = NULL, overdue_notified_at = NULL,
+		        version = version + 1, updated_at = NOW()
+		 WHERE id = $1 AND version = $3 AND due_at IS NOT NULL
+		 RETURNING due_at, version`,
+		o.ID, days, o.Version,
+	).Scan(&dueAt, &o.Version)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return dueAt, ErrNoDeadline
+	}
+	return dueAt, err
+}
+
+// SaveRequirements stores the buyer's answers on a locked order. When they
+// complete the requirements of an accepted order still waiting on them, its
+// delivery clock starts. Once it has started the requirements must stay
+// complete. Returns the due date, if any.
+func SaveRequirements(ctx context.Context, tx pgx.Tx, o *Order, answers []byte, complete bool) (*time.Time, error) {
+	var dueAt *time.Time
+	if !complete {
+		var started bool
+		if err := tx.QueryRow(ctx, `SELECT due_at IS NOT NULL FROM orders WHERE id = $1`, o.ID).Scan(&started); err != nil {
+			return nil, err
+		}
+		if started {
+			return nil, ErrRequirementsLocked
+		}
+	}
+	err := tx.QueryRow(ctx,
+		`UPDATE orders SET answers = $2,
+		        requirements_completed_at = CASE WHEN $3 THEN COALESCE(requirements_completed_at, NOW()) END,
+		        due_at = CASE WHEN $3 AND status = 'in_progress' AND due_at IS NULL AND delivery_days > 0
+		                      THEN NOW() + make_interval(days => delivery_days) ELSE due_at END,
+		        version = version + 1, updated_at = NOW()
+		 WHERE id = $1 AND version = $4
+		 RETURNING due_at, version`,
+		o.ID, answers, complete, o.Version,
+	).Scan(&dueAt, &o.Version)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrVersionConflict
+	}
+	return dueAt, err
+}
+
+// OnTimeStats summarises a seller's first deliveries against their deadlines
+type OnTimeStats struct {
+	Delivered int64    `json:"delivered_orders"`
+	OnTime    int64    `json:"on_time_orders"`
+	Rate      *float64 `json:"on_time_rate"` // 0-1, nil until the seller has delivered
+}
+
+// SellerOnTimeStats computes the on-time delivery rate shown on profiles
+func SellerOnTimeStats(ctx context.Context, sellerID string) (OnTimeStats, error) {
+	var s OnTimeStats
+	err := db.Conn.QueryRow(ctx,
+		`SELECT COUNT(*), COUNT(*) FILTER (WHERE delivered_on_time)
+		 FROM orders WHERE seller_id = $1 AND delivered_on_time IS NOT NULL`, sellerID,
+	).Scan(&s.Delivered, &s.OnTime)
+	if err == nil && s.Delivered > 0 {
+		rate := float64(s.OnTime) / float64(s.Delivered)
+		s.Rate = &rate
+	}
+	return s, err
+}
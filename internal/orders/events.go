@@ -0,0 +1,39 @@
+package orders
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Actor types recorded on order events and allowed on transitions
+const (
+	ActorBuyer  = "buyer"
+	ActorSeller = "seller"
+	ActorAdmin  = "admin"
+	ActorSystem = "system"
+)
+
+// Execer is satisfied by the pool and by a transaction
+type Execer interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+}
+
+// LogEvent records an action taken on an order. actorID is empty for
+// system actions.
+func LogEvent(ctx context.Context, q Execer, orderID, actorType, actorID, action string, details map[string]any) error {
+	if details == nil {
+		details = map[string]any{}
+	}
+	b, err := json.Marshal(details)
+	if err != nil {
+		return err
+	}
+	_, err = q.Exec(ctx,
+		`INSERT INTO order_events (order_id, actor_type, actor_id, action, details)
+		 VALUES ($1, $2, NULLIF($3, '')::uuid, $4, $5)`,
+		orderID, actorType, actorID, action, b,
+	)
+	return err
+}
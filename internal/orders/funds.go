@@ -0,0 +1,105 @@
+package orders
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/sudo-init-do/crafthub/internal/ledger"
+)
+
+// Wallet movements for the order lifecycle. Each helper posts a ledger entry
+// and records the matching user-facing row in transactions within tx.
+// Callers must hold the order row lock (see Lock).
+
+// HoldFunds reserves the order amount out of the buyer's available balance
+func HoldFunds(ctx context.Context, tx pgx.Tx, orderID, buyerID string, amount int64) error {
+	if _, err := ledger.Transfer(ctx, tx, ledger.EntryOrderHold, orderID,
+		ledger.UserAvailable(buyerID), ledger.UserHeld(buyerID), amount); err != nil {
+		return err
+	}
+	_, err := tx.Exec(ctx,
+		`INSERT INTO transactions (user_id, amount, type, status, reference, created_at)
+         VALUES ($1, $2, 'debit', 'pending_hold', $3, $4)`,
+		buyerID, amount, orderID, time.Now(),
+	)
+	return err
+}
+
+// EscrowFunds converts the buyer's hold into escrow for the order
+func EscrowFunds(ctx context.Context, tx pgx.Tx, orderID, buyerID string, amount int64) error {
+	if _, err := ledger.Transfer(ctx, tx, ledger.EntryOrderEscrow, orderID,
+		ledger.UserHeld(buyerID), ledger.OrderEscrow(orderID), amount); err != nil {
+		return err
+	}
+	_, err := tx.Exec(ctx,
+		`UPDATE transactions SET status = 'debited' WHERE user_id = $1 AND reference = $2 AND status = 'pending_hold'`,
+		buyerID, orderID,
+	)
+	return err
+}
+
+// RefundFunds returns the buyer's money: the hold for orders still
+// awaiting acceptance, the escrow for accepted ones.
+func RefundFunds(ctx context.Context, tx pgx.Tx, orderID, buyerID, status string, amount int64) error {
+	var err error
+	switch status {
+	case "pending_acceptance":
+		_, err = ledger.Transfer(ctx, tx, ledger.EntryOrderHoldRelease, orderID,
+			ledger.UserHeld(buyerID), ledger.UserAvailable(buyerID), amount)
+	case "in_progress", "delivered":
+		_, err = ledger.Transfer(ctx, tx, ledger.EntryOrderRefund, orderID,
+			ledger.OrderEscrow(orderID), ledger.UserAvailable(buyerID), amount)
+	default:
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	// Close out the original hold so it is not left pending
+	if _, err = tx.Exec(ctx,
+		`UPDATE transactions SET status = 'refunded' WHERE user_id = $1 AND reference = $2 AND status = 'pending_hold'`,
+		buyerID, orderID,
+	); err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx,
+		`INSERT INTO transactions (user_id, amount, type, status, reference, created_at)
+         VALUES ($1, $2, 'credit', 'refunded', $3, $4)`,
+		buyerID, amount, orderID, time.Now(),
+	)
+	return err
+}
+
+// ReleaseFunds pays the order escrow out to the seller, less the platform
+// fee fixed at order time, which goes to platform revenue. Returns the seller's net.
+func ReleaseFunds(ctx context.Context, tx pgx.Tx, orderID, sellerID string, amount int64) (int64, error) {
+	var fee int64
+	if err := tx.QueryRow(ctx, `SELECT COALESCE(platform_fee, 0) FROM orders WHERE id = $1`, orderID).Scan(&fee); err != nil {
+		return 0, err
+	}
+	if fee < 0 || fee > amount {
+		fee = 0
+	}
+	net := amount - fee
+
+	lines := []ledger.Line{{Account: ledger.OrderEscrow(orderID), Amount: -amount}}
+	if net > 0 {
+		lines = append(lines, ledger.Line{Account: ledger.UserAvailable(sellerID), Amount: net})
+	}
+	if fee > 0 {
+		lines = append(lines, ledger.Line{Account: ledger.PlatformRevenue(), Amount: fee})
+	}
+	if _, err := ledger.Post(ctx, tx, ledger.Entry{Kind: ledger.EntryOrderRelease, Reference: orderID, Lines: lines}); err != nil {
+		return 0, err
+	}
+	if net == 0 {
+		return 0, nil
+	}
+	_, err := tx.Exec(ctx,
+		`INSERT INTO transactions (user_id, amount, type, status, reference, created_at)
+         VALUES ($1, $2, 'credit', 'credited', $3, $4)`,
+		sellerID, net, orderID, time.Now(),
+	)
+	return net, err
+}
@@ -0,0 +1,339 @@
+package orders
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/sudo-init-do/crafthub/internal/db"
+)
+
+// Order statuses
+const (
+	StatusPendingAcceptance = "pending_acceptance"
+	StatusInProgress        = "in_progress"
+	StatusDelivered         = "delivered"
+	StatusCompleted         = "completed"
+	StatusDeclined          = "declined"
+	StatusCanceled          = "canceled"
+)
+
+// Actions, one per transition
+const (
+	ActionAccept      = "accept"
+	ActionReject      = "reject"
+	ActionDecline     = "decline"
+	ActionCancel      = "cancel"
+	ActionDeliver     = "deliver"
+	ActionComplete    = "complete"
+	ActionRelease     = "release"
+	ActionAutoRelease = "auto_release"
+	ActionExpire      = "expire"
+
+	ActionRequestRevision = "request_revision"
+
+	// Settling a dispute: the escrow goes back to the buyer, to the seller,
+	// or is split between them
+	ActionSettleRefund  = "settle_refund"
+	ActionSettleRelease = "settle_release"
+	ActionSettleSplit   = "settle_split"
+)
+
+var (
+	ErrNotFound          = errors.New("order not found")
+	ErrForbidden         = errors.New("not allowed to perform this action")
+	ErrUnknownAction     = errors.New("unknown order action")
+	ErrInvalidTransition = errors.New("action not allowed in the order's current status")
+	ErrVersionConflict   = errors.New("order was modified by another request")
+	ErrPrecondition      = errors.New("order no longer meets the conditions for this action")
+)
+
+// Order is the order row a transition works on, read under FOR UPDATE
+type Order struct {
+	ID          string
+	BuyerID     string
+	SellerID    string
+	ServiceID   string
+	Status      string
+	Amount      int64
+	PlatformFee int64
+	Version     int64
+	CreatedAt   time.Time
+	DeliveredAt time.Time // delivered_at, or updated_at for orders delivered before it existed
+}
+
+// Result describes an applied transition
+type Result struct {
+	OrderID     string `json:"order_id"`
+	Action      string `json:"action"`
+	From        string `json:"from"`
+	Status      string `json:"status"`
+	Version     int64  `json:"version"`
+	Amount      int64  `json:"amount"`
+	Refunded    int64  `json:"refunded,omitempty"`
+	SellerNet   int64  `json:"seller_net,omitempty"`
+	PlatformFee int64  `json:"platform_fee,omitempty"`
+	Charged     int64  `json:"charged,omitempty"`
+	Overdue     bool   `json:"overdue,omitempty"` // cancelled after its due date passed
+
+	order     *Order
+	actorType string
+	actorID   string
+}
+
+// Transition declares a legal status change: the statuses it applies from,
+// the actor types allowed to perform it, and its side effects.
+type Transition struct {
+	Action string
+	From   []string
+	To     string
+	Actors []string
+	// Set is an extra SET clause applied together with the status change
+	Set string
+	// Guard is a precondition beyond the current status, checked under the lock
+	Guard func(ctx context.Context, tx pgx.Tx, o *Order) error
+	// Effect moves funds inside the transaction
+	Effect func(ctx context.Context, tx pgx.Tx, o *Order, r *Result) error
+	// Notify runs after commit and is best-effort
+	Notify func(ctx context.Context, r *Result)
+}
+
+var transitions = map[string]*Transition{}
+
+func init() {
+	for _, t := range []*Transition{
+		{Action: ActionAccept, From: []string{StatusPendingAcceptance}, To: StatusInProgress,
+			Actors: []string{ActorSeller}, Set: setDueOnAccept, Effect: escrow, Notify: notifyAccepted},
+		{Action: ActionReject, From: []string{StatusPendingAcceptance}, To: StatusDeclined,
+			Actors: []string{ActorSeller}, Effect: refund, Notify: notifyDeclined},
+		{Action: ActionDecline, From: []string{StatusInProgress, StatusDelivered}, To: StatusDeclined,
+			Actors: []string{ActorSeller}, Effect: refund, Notify: notifyDeclined},
+		{Action: ActionCancel, From: []string{StatusPendingAcceptance, StatusInProgress, StatusDelivered}, To: StatusCanceled,
+			Actors: []string{ActorBuyer}, Effect: cancelRefund, Notify: notifyCancelled},
+		{Action: ActionDeliver, From: []string{StatusInProgress}, To: StatusDelivered,
+			Actors: []string{ActorSeller}, Set: "delivered_at = NOW(), release_reminder_sent_at = NULL, " + setFirstDelivery, Notify: notifyDelivered},
+		{Action: ActionRequestRevision, From: []string{StatusDelivered}, To: StatusInProgress,
+			Actors: []string{ActorBuyer}, Set: "delivered_at = NULL, release_reminder_sent_at = NULL, " + setDueOnRevision, Effect: chargeRevision, Notify: notifyRevisionRequested},
+		{Action: ActionComplete, From: []string{StatusInProgress, StatusDelivered}, To: StatusCompleted,
+			Actors: []string{ActorBuyer}, Effect: release, Notify: notifyCompleted},
+		{Action: ActionRelease, From: []string{StatusInProgress, StatusDelivered}, To: StatusCompleted,
+			Actors: []string{ActorAdmin}, Effect: release, Notify: notifyReleased},
+		{Action: ActionAutoRelease, From: []string{StatusDelivered}, To: StatusCompleted,
+			Actors: []string{ActorSystem}, Effect: release, Notify: notifyAutoReleased},
+		{Action: ActionExpire, From: []string{StatusPendingAcceptance}, To: StatusCanceled,
+			Actors: []string{ActorSystem}, Effect: refund, Notify: notifyExpired},
+		{Action: ActionSettleRefund, From: []string{StatusPendingAcceptance, StatusInProgress, StatusDelivered}, To: StatusCanceled,
+			Actors: settleActors, Set: "refunded_amount = amount", Guard: disputeOpen, Effect: refund},
+		{Action: ActionSettleRelease, From: []string{StatusInProgress, StatusDelivered}, To: StatusCompleted,
+			Actors: settleActors, Set: "refunded_amount = 0", Guard: disputeOpen, Effect: release},
+		{Action: ActionSettleSplit, From: []string{StatusInProgress, StatusDelivered}, To: StatusCompleted,
+			Actors: settleActors, Guard: disputeOpen},
+	} {
+		transitions[t.Action] = t
+	}
+}
+
+// settleActors may settle a dispute: an admin by decision, buyer or seller by
+// accepting the other side's proposal
+var settleActors = []string{ActorBuyer, ActorSeller, ActorAdmin}
+
+// disputeOpen requires an open dispute on the order. Settle transitions carry
+// no notifications; the dispute handlers send the breakdown themselves.
+func disputeOpen(ctx context.Context, tx pgx.Tx, o *Order) error {
+	var open bool
+	err := tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM disputes WHERE order_id = $1 AND status = 'open')`, o.ID).Scan(&open)
+	if err != nil {
+		return err
+	}
+	if !open {
+		return fmt.Errorf("%w: order has no open dispute", ErrPrecondition)
+	}
+	return nil
+}
+
+// Lookup returns the declared transition for an action
+func Lookup(action string) (*Transition, bool) {
+	t, ok := transitions[action]
+	return t, ok
+}
+
+func escrow(ctx context.Context, tx pgx.Tx, o *Order, _ *Result) error {
+	return EscrowFunds(ctx, tx, o.ID, o.BuyerID, o.Amount)
+}
+
+func refund(ctx context.Context, tx pgx.Tx, o *Order, r *Result) error {
+	if err := RefundFunds(ctx, tx, o.ID, o.BuyerID, o.Status, o.Amount); err != nil {
+		return err
+	}
+	r.Refunded = o.Amount
+	return nil
+}
+
+func release(ctx context.Context, tx pgx.Tx, o *Order, r *Result) error {
+	net, err := ReleaseFunds(ctx, tx, o.ID, o.SellerID, o.Amount)
+	if err != nil {
+		return err
+	}
+	r.SellerNet = net
+	r.PlatformFee = o.Amount - net
+	return nil
+}
+
+// Lock reads the order FOR UPDATE. Concurrent transitions on the same order
+// queue behind the lock and then see the status the first one left.
+func Lock(ctx context.Context, tx pgx.Tx, orderID string) (*Order, error) {
+	o := &Order{ID: orderID}
+	err := tx.QueryRow(ctx,
+		`SELECT buyer_id::text, seller_id::text, service_id::text, status, amount, COALESCE(platform_fee, 0), version,
+		        created_at, COALESCE(delivered_at, updated_at, created_at)
+		 FROM orders WHERE id = $1 FOR UPDATE`, orderID,
+	).Scan(&o.BuyerID, &o.SellerID, &o.ServiceID, &o.Status, &o.Amount, &o.PlatformFee, &o.Version, &o.CreatedAt, &o.DeliveredAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return o, err
+}
+
+// SetStatus moves a locked order to status and bumps its version
+func SetStatus(ctx context.Context, tx pgx.Tx, o *Order, status, extraSet string) error {
+	set := "status = $2, version = version + 1, updated_at = NOW()"
+	if extraSet != "" {
+		set += ", " + extraSet
+	}
+	err := tx.QueryRow(ctx,
+		`UPDATE orders SET `+set+` WHERE id = $1 AND version = $3 RETURNING version`,
+		o.ID, status, o.Version,
+	).Scan(&o.Version)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrVersionConflict
+	}
+	if err != nil {
+		return err
+	}
+	o.Status = status
+	return nil
+}
+
+// Options tune a single transition
+type Options struct {
+	// ExpectedVersion, when set, must match the order's version (If-Match)
+	ExpectedVersion *int64
+	// Guard is an extra precondition checked under the row lock
+	Guard func(ctx context.Context, tx pgx.Tx, o *Order) error
+	// Effect runs after the transition's own effect, inside the transaction.
+	// It is for amounts only the caller knows, such as a dispute split.
+	Effect func(ctx context.Context, tx pgx.Tx, o *Order, r *Result) error
+	// Details are added to the order event
+	Details map[string]any
+}
+
+// Apply performs an action on an order in its own transaction and sends
+// the transition's notifications after commit.
+func Apply(ctx context.Context, orderID, action, actorType, actorID string, opts Options) (*Result, error) {
+	tx, err := db.Conn.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	r, err := ApplyTx(ctx, tx, orderID, action, actorType, actorID, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	if t := transitions[action]; t.Notify != nil {
+		t.Notify(ctx, r)
+	}
+	return r, nil
+}
+
+// ApplyTx performs an action inside tx. The caller commits and is
+// responsible for notifications.
+func ApplyTx(ctx context.Context, tx pgx.Tx, orderID, action, actorType, actorID string, opts Options) (*Result, error) {
+	t, ok := transitions[action]
+	if !ok {
+		return nil, ErrUnknownAction
+	}
+	if !contains(t.Actors, actorType) {
+		return nil, ErrForbidden
+	}
+
+	o, err := Lock(ctx, tx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	// Buyers and sellers only see their own orders
+	if (actorType == ActorBuyer && actorID != o.BuyerID) || (actorType == ActorSeller && actorID != o.SellerID) {
+		return nil, ErrNotFound
+	}
+	if opts.ExpectedVersion != nil && *opts.ExpectedVersion != o.Version {
+		return nil, fmt.Errorf("%w: expected version %d, current version %d", ErrVersionConflict, *opts.ExpectedVersion, o.Version)
+	}
+	if !contains(t.From, o.Status) {
+		return nil, fmt.Errorf("%w: order is %s", ErrInvalidTransition, o.Status)
+	}
+	for _, guard := range []func(context.Context, pgx.Tx, *Order) error{t.Guard, opts.Guard} {
+		if guard == nil {
+			continue
+		}
+		if err := guard(ctx, tx, o); err != nil {
+			return nil, err
+		}
+	}
+
+	r := &Result{OrderID: o.ID, Action: action, From: o.Status, Amount: o.Amount, order: o, actorType: actorType, actorID: actorID}
+	for _, effect := range []func(context.Context, pgx.Tx, *Order, *Result) error{t.Effect, opts.Effect} {
+		if effect == nil {
+			continue
+		}
+		if err := effect(ctx, tx, o, r); err != nil {
+			return nil, err
+		}
+	}
+	if err := SetStatus(ctx, tx, o, t.To, t.Set); err != nil {
+		return nil, err
+	}
+	r.Status, r.Version = o.Status, o.Version
+
+	details := map[string]any{"from": r.From, "to": r.Status}
+	if r.Refunded > 0 {
+		details["refunded"] = r.Refunded
+	}
+	if r.Charged > 0 {
+		details["charged"] = r.Charged
+	}
+	if r.Overdue {
+		details["overdue"] = true
+	}
+	if r.SellerNet > 0 || r.PlatformFee > 0 {
+		details["seller_net"] = r.SellerNet
+		details["platform_fee"] = r.PlatformFee
+	}
+	for k, v := range opts.Details {
+		details[k] = v
+	}
+	if err := LogEvent(ctx, tx, o.ID, actorType, actorID, action, details); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Notify sends the notifications of an action applied with ApplyTx
+func Notify(ctx context.Context, r *Result) {
+	if t, ok := transitions[r.Action]; ok && t.Notify != nil {
+		t.Notify(ctx, r)
+	}
+}
+
+func contains(list []string, v string) bool {
+	for _, s := range list {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
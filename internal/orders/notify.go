@@ -0,0 +1,93 @@
+package orders
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sudo-init-do/crafthub/internal/alerts"
+	"github.com/sudo-init-do/crafthub/internal/db"
+)
+
+// Post-commit notifications for each transition. All best-effort.
+
+func userEmail(ctx context.Context, userID string) string {
+	var email string
+	_ = db.Conn.QueryRow(ctx, `SELECT email FROM users WHERE id = $1`, userID).Scan(&email)
+	return email
+}
+
+func notifyAccepted(ctx context.Context, r *Result) {
+	o := r.order
+	if email := userEmail(ctx, o.BuyerID); email != "" {
+		_ = alerts.EnqueueBookingConfirmation(o.ID, o.BuyerID, o.SellerID, email, float64(o.Amount))
+	}
+}
+
+func notifyDeclined(ctx context.Context, r *Result) {
+	o := r.order
+	if email := userEmail(ctx, o.BuyerID); email != "" {
+		_ = alerts.EnqueueOrderDeclined(o.ID, o.BuyerID, o.SellerID, email, float64(o.Amount))
+	}
+}
+
+func notifyCancelled(ctx context.Context, r *Result) {
+	o := r.order
+	if email := userEmail(ctx, o.SellerID); email != "" {
+		_ = alerts.EnqueueOrderCancelled(o.ID, o.BuyerID, o.SellerID, email, float64(o.Amount))
+	}
+}
+
+func notifyDelivered(ctx context.Context, r *Result) {
+	o := r.order
+	if email := userEmail(ctx, o.BuyerID); email != "" {
+		_ = alerts.EnqueueOrderDelivered(o.ID, o.BuyerID, o.SellerID, email, float64(o.Amount))
+	}
+}
+
+func notifyRevisionRequested(ctx context.Context, r *Result) {
+	o := r.order
+	ref := o.ID
+	meta := fmt.Sprintf(`{"charged":%d}`, r.Charged)
+	_ = alerts.CreateNotification(o.SellerID, "order:revision_requested", "Revision requested",
+		"The buyer asked for changes to your delivery. The order is back in progress.", &ref, &meta)
+}
+
+func notifyCompleted(ctx context.Context, r *Result) {
+	o := r.order
+	if email := userEmail(ctx, o.SellerID); email != "" {
+		_ = alerts.EnqueueOrderCompleted(o.ID, o.BuyerID, o.SellerID, email, float64(r.SellerNet))
+	}
+}
+
+func notifyReleased(ctx context.Context, r *Result) {
+	_ = alerts.EnqueueAdminAlert(r.actorID, "info", "Order released: "+r.OrderID)
+	notifyCompleted(ctx, r)
+}
+
+func notifyAutoReleased(ctx context.Context, r *Result) {
+	o := r.order
+	ref := o.ID
+	meta := fmt.Sprintf(`{"amount":%d,"seller_net":%d}`, o.Amount, r.SellerNet)
+	_ = alerts.CreateNotification(o.BuyerID, "order:auto_completed", "Order completed automatically",
+		"The inspection period ended without a dispute, so the order was completed and the seller paid.", &ref, &meta)
+	_ = alerts.CreateNotification(o.SellerID, "order:auto_completed", "Order completed and paid",
+		fmt.Sprintf("The buyer's inspection period ended. %d has been released to your wallet.", r.SellerNet), &ref, &meta)
+	notifyCompleted(ctx, r)
+}
+
+func notifyExpired(ctx context.Context, r *Result) {
+	o := r.order
+	ref := o.ID
+	meta := fmt.Sprintf(`{"amount":%d}`, o.Amount)
+	_ = alerts.CreateNotification(o.BuyerID, "order:expired", "Order expired",
+		"The seller did not accept your order in time. It was cancelled and your funds returned to your wallet.", &ref, &meta)
+	_ = alerts.CreateNotification(o.SellerID, "order:expired", "Order expired",
+		"An order was cancelled because it was not accepted in time.", &ref, &meta)
+
+	if email := userEmail(ctx, o.BuyerID); email != "" {
+		_ = alerts.EnqueueOrderExpired(o.ID, o.BuyerID, o.SellerID, email, float64(o.Amount), true)
+	}
+	if email := userEmail(ctx, o.SellerID); email != "" {
+		_ = alerts.EnqueueOrderExpired(o.ID, o.BuyerID, o.SellerID, email, float64(o.Amount), false)
+	}
+}
@@ -0,0 +1,55 @@
+package orders
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/sudo-init-do/crafthub/internal/ledger"
+)
+
+var ErrNoRevisionsLeft = errors.New("no revisions left on this order")
+
+// chargeRevision uses up one of the order's revisions. Once the included
+// revisions are spent, each extra one is charged from the buyer's wallet into
+// the order escrow and added to the order amount, so release and refunds
+// cover it. The platform fee fixed at order time is unchanged.
+func chargeRevision(ctx context.Context, tx pgx.Tx, o *Order, r *Result) error {
+	var included, used int
+	var price int64
+	if err := tx.QueryRow(ctx,
+		`SELECT revisions_included, revisions_used, COALESCE(extra_revision_price, 0) FROM orders WHERE id = $1`, o.ID,
+	).Scan(&included, &used, &price); err != nil {
+		return err
+	}
+
+	var charge int64
+	if used >= included {
+		if price <= 0 {
+			return ErrNoRevisionsLeft
+		}
+		if _, err := ledger.Transfer(ctx, tx, ledger.EntryOrderRevision, o.ID,
+			ledger.UserAvailable(o.BuyerID), ledger.OrderEscrow(o.ID), price); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx,
+			`INSERT INTO transactions (user_id, amount, type, status, reference, created_at)
+			 VALUES ($1, $2, 'debit', 'debited', $3, $4)`,
+			o.BuyerID, price, o.ID, time.Now(),
+		); err != nil {
+			return err
+		}
+		charge = price
+	}
+
+	if _, err := tx.Exec(ctx,
+		`UPDATE orders SET revisions_used = revisions_used + 1, amount = amount + $2 WHERE id = $1`, o.ID, charge,
+	); err != nil {
+		return err
+	}
+	o.Amount += charge
+	r.Amount = o.Amount
+	r.Charged = charge
+	return nil
+}
@@ -0,0 +1,176 @@
+package orders
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/sudo-init-do/crafthub/internal/db"
+)
+
+// Timeline item kinds
+const (
+	KindEvent           = "event"            // recorded in order_events
+	KindMoney           = "money"            // ledger entry referencing the order
+	KindMessages        = "messages"         // buyer/seller messages, counted per day
+	KindDisputeMessages = "dispute_messages" // dispute thread messages, counted per day
+)
+
+// TimelineItem is one entry of an order's history
+type TimelineItem struct {
+	At        time.Time      `json:"at"`
+	Kind      string         `json:"kind"`
+	Action    string         `json:"action"`
+	ActorType string         `json:"actor_type,omitempty"`
+	ActorID   string         `json:"actor_id,omitempty"`
+	Details   map[string]any `json:"details,omitempty"`
+}
+
+// Timeline merges the order's events, money movements and message activity
+// into one chronological list.
+func Timeline(ctx context.Context, orderID string) ([]TimelineItem, error) {
+	items := []TimelineItem{}
+	for _, load := range []func(context.Context, string) ([]TimelineItem, error){
+		timelineEvents, timelineMoney, timelineMessages, timelineDisputeMessages,
+	} {
+		batch, err := load(ctx, orderID)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, batch...)
+	}
+	sort.SliceStable(items, func(i, j int) bool { return items[i].At.Before(items[j].At) })
+	return items, nil
+}
+
+func timelineEvents(ctx context.Context, orderID string) ([]TimelineItem, error) {
+	rows, err := db.Conn.Query(ctx,
+		`SELECT created_at, actor_type, COALESCE(actor_id::text, ''), action, details
+		 FROM order_events WHERE order_id = $1 ORDER BY created_at, id`, orderID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []TimelineItem
+	created := false
+	for rows.Next() {
+		it := TimelineItem{Kind: KindEvent}
+		var details []byte
+		if err := rows.Scan(&it.At, &it.ActorType, &it.ActorID, &it.Action, &details); err != nil {
+			return nil, err
+		}
+		_ = json.Unmarshal(details, &it.Details)
+		if it.Action == "created" {
+			created = true
+		}
+		items = append(items, it)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Orders placed before events were recorded still get a starting point
+	if !created {
+		it := TimelineItem{Kind: KindEvent, Action: "created", ActorType: ActorBuyer}
+		var amount int64
+		if err := db.Conn.QueryRow(ctx,
+			`SELECT created_at, buyer_id::text, amount FROM orders WHERE id = $1`, orderID,
+		).Scan(&it.At, &it.ActorID, &amount); err != nil {
+			return nil, err
+		}
+		it.Details = map[string]any{"amount": amount}
+		items = append(items, it)
+	}
+	return items, nil
+}
+
+func timelineMoney(ctx context.Context, orderID string) ([]TimelineItem, error) {
+	rows, err := db.Conn.Query(ctx,
+		`SELECT e.id::text, e.kind, e.created_at, COALESCE(e.created_by::text, ''),
+		        COALESCE(SUM(p.amount) FILTER (WHERE p.amount > 0), 0)::bigint,
+		        json_agg(json_build_object('account', a.kind, 'owner_id', a.owner_id, 'amount', p.amount) ORDER BY p.amount)
+		 FROM ledger_entries e
+		 JOIN ledger_postings p ON p.entry_id = e.id
+		 JOIN ledger_accounts a ON a.id = p.account_id
+		 WHERE e.reference = $1
+		 GROUP BY e.id`, orderID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []TimelineItem
+	for rows.Next() {
+		it := TimelineItem{Kind: KindMoney}
+		var entryID string
+		var amount int64
+		var lines []byte
+		if err := rows.Scan(&entryID, &it.Action, &it.At, &it.ActorID, &amount, &lines); err != nil {
+			return nil, err
+		}
+		var postings []map[string]any
+		_ = json.Unmarshal(lines, &postings)
+		it.Details = map[string]any{"entry_id": entryID, "amount": amount, "postings": postings}
+		items = append(items, it)
+	}
+	return items, rows.Err()
+}
+
+func timelineMessages(ctx context.Context, orderID string) ([]TimelineItem, error) {
+	rows, err := db.Conn.Query(ctx,
+		`SELECT MIN(m.created_at), COUNT(*),
+		        COUNT(*) FILTER (WHERE m.sender_id = o.buyer_id),
+		        COUNT(*) FILTER (WHERE m.sender_id = o.seller_id)
+		 FROM messages m JOIN orders o ON o.id = m.order_id
+		 WHERE m.order_id = $1
+		 GROUP BY date_trunc('day', m.created_at)`, orderID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []TimelineItem
+	for rows.Next() {
+		it := TimelineItem{Kind: KindMessages, Action: "messages_exchanged"}
+		var count, fromBuyer, fromSeller int64
+		if err := rows.Scan(&it.At, &count, &fromBuyer, &fromSeller); err != nil {
+			return nil, err
+		}
+		it.Details = map[string]any{"count": count, "from_buyer": fromBuyer, "from_seller": fromSeller}
+		items = append(items, it)
+	}
+	return items, rows.Err()
+}
+
+func timelineDisputeMessages(ctx context.Context, orderID string) ([]TimelineItem, error) {
+	rows, err := db.Conn.Query(ctx,
+		`SELECT d.id::text, MIN(m.created_at), COUNT(*),
+		        COUNT(*) FILTER (WHERE m.author_role = 'admin'),
+		        COUNT(*) FILTER (WHERE m.attachments <> '[]'::jsonb)
+		 FROM dispute_messages m JOIN disputes d ON d.id = m.dispute_id
+		 WHERE d.order_id = $1
+		 GROUP BY d.id, date_trunc('day', m.created_at)`, orderID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []TimelineItem
+	for rows.Next() {
+		it := TimelineItem{Kind: KindDisputeMessages, Action: "dispute_messages_posted"}
+		var disputeID string
+		var count, fromAdmin, withEvidence int64
+		if err := rows.Scan(&disputeID, &it.At, &count, &fromAdmin, &withEvidence); err != nil {
+			return nil, err
+		}
+		it.Details = map[string]any{"dispute_id": disputeID, "count": count, "from_admin": fromAdmin, "with_evidence": withEvidence}
+		items = append(items, it)
+	}
+	return items, rows.Err()
+}
@@ -0,0 +1,166 @@
+package payments
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const MockProviderName = "mock"
+
+// legacyMockSecret was once used when PAYMENT_WEBHOOK_SECRET was unset. It is
+// public, so it is never accepted.
+const legacyMockSecret = "mock_webhook_secret"
+
+// MockProvider is an in-memory provider for local development and tests,
+// available only with PAYMENTS_ENABLE_MOCK=true. Payments live in process
+// memory, so they do not survive a restart or span several instances.
+// Payments stay pending until settled through MockCheckout (or immediately
+// when autoSucceed is set). Settling sends a signed webhook to webhookURL
+// when configured, exactly like a real processor would.
+type MockProvider struct {
+	secret      []byte
+	checkoutURL string
+	webhookURL  string
+	autoSucceed bool
+
+	mu       sync.Mutex
+	payments map[string]*Verification
+}
+
+func NewMockProvider(secret, checkoutURL, webhookURL string, autoSucceed bool) *MockProvider {
+	return &MockProvider{
+		secret:      []byte(secret),
+		checkoutURL: strings.TrimRight(checkoutURL, "/"),
+		webhookURL:  webhookURL,
+		autoSucceed: autoSucceed,
+		payments:    map[string]*Verification{},
+	}
+}
+
+// NewMockProviderFromEnv reads PAYMENT_WEBHOOK_SECRET (required),
+// MOCK_PAYMENT_URL, MOCK_PAYMENT_WEBHOOK_URL and TOPUP_AUTO_CONFIRM
+func NewMockProviderFromEnv() (*MockProvider, error) {
+	secret := os.Getenv("PAYMENT_WEBHOOK_SECRET")
+	if secret == "" || secret == legacyMockSecret {
+		return nil, errors.New("payments: mock provider needs a PAYMENT_WEBHOOK_SECRET")
+	}
+	checkoutURL := os.Getenv("MOCK_PAYMENT_URL")
+	if checkoutURL == "" {
+		checkoutURL = "https://pay.crafthub.dev/mock"
+	}
+	return NewMockProvider(secret, checkoutURL, os.Getenv("MOCK_PAYMENT_WEBHOOK_URL"), os.Getenv("TOPUP_AUTO_CONFIRM") == "true"), nil
+}
+
+func (m *MockProvider) Name() string { return MockProviderName }
+
+func (m *MockProvider) Init(ctx context.Context, req InitRequest) (*InitResult, error) {
+	ref := "mock_" + req.TopupID
+	status := StatusPending
+	if m.autoSucceed {
+		status = StatusSucceeded
+	}
+	m.mu.Lock()
+	m.payments[ref] = &Verification{Reference: ref, Status: status, Amount: req.Amount}
+	m.mu.Unlock()
+	return &InitResult{Reference: ref, PaymentURL: m.checkoutURL + "/" + ref, Status: status}, nil
+}
+
+func (m *MockProvider) Verify(ctx context.Context, reference string) (*Verification, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p, ok := m.payments[reference]
+	if !ok {
+		return nil, ErrUnknownReference
+	}
+	v := *p
+	return &v, nil
+}
+
+func (m *MockProvider) ParseWebhook(header http.Header, body []byte) (*Event, error) {
+	if err := VerifySignature(m.secret, header, body); err != nil {
+		return nil, err
+	}
+	var ev Event
+	if err := json.Unmarshal(body, &ev); err != nil {
+		return nil, err
+	}
+	return &ev, nil
+}
+
+// Settle marks a pending payment as succeeded or failed and delivers the webhook
+func (m *MockProvider) Settle(ctx context.Context, reference string, succeeded bool, reason string) (*Event, error) {
+	m.mu.Lock()
+	p, ok := m.payments[reference]
+	if !ok {
+		m.mu.Unlock()
+		return nil, ErrUnknownReference
+	}
+	if p.Status == StatusPending {
+		if succeeded {
+			p.Status = StatusSucceeded
+		} else {
+			p.Status = StatusFailed
+			p.FailureReason = reason
+		}
+	}
+	ev := &Event{Reference: p.Reference, Status: p.Status, Amount: p.Amount, FailureReason: p.FailureReason}
+	m.mu.Unlock()
+
+	if m.webhookURL != "" {
+		if err := m.deliver(ctx, ev); err != nil {
+			log.Printf("mock payment webhook delivery failed: %v", err)
+		}
+	}
+	return ev, nil
+}
+
+func (m *MockProvider) deliver(ctx context.Context, ev *Event) error {
+	body, _ := json.Marshal(ev)
+	ts := time.Now().Unix()
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(TimestampHeader, strconv.FormatInt(ts, 10))
+	req.Header.Set(SignatureHeader, Sign(m.secret, ts, body))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// MockCheckout stands in for the processor's hosted payment page.
+// POST /payments/mock/:reference/:outcome  (outcome: succeed | fail)
+func MockCheckout(c echo.Context) error {
+	p, err := Get(MockProviderName)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, echo.Map{"error": "mock provider not available"})
+	}
+	mock := p.(*MockProvider)
+
+	outcome := c.Param("outcome")
+	if outcome != "succeed" && outcome != "fail" {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "outcome must be succeed or fail"})
+	}
+	ev, err := mock.Settle(context.Background(), c.Param("reference"), outcome == "succeed", "declined by mock checkout")
+	if err != nil {
+		return c.JSON(http.StatusNotFound, echo.Map{"error": "payment not found"})
+	}
+	return c.JSON(http.StatusOK, echo.Map{"reference": ev.Reference, "status": ev.Status})
+}
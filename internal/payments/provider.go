@@ -0,0 +1,184 @@
+package payments
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Payment statuses reported by providers
+const (
+	StatusPending   = "pending"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+)
+
+// Webhook signature headers. The signature is a hex HMAC-SHA256 of
+// "<timestamp>.<body>" using the provider's webhook secret.
+const (
+	SignatureHeader = "X-Crafthub-Signature"
+	TimestampHeader = "X-Crafthub-Timestamp"
+	// signatures older than this are rejected to limit replays
+	signatureTolerance = 5 * time.Minute
+)
+
+var (
+	ErrInvalidSignature = errors.New("payments: invalid webhook signature")
+	ErrUnknownReference = errors.New("payments: unknown payment reference")
+	ErrUnknownProvider  = errors.New("payments: unknown provider")
+	ErrNotConfigured    = errors.New("payments: PAYMENT_PROVIDER and PAYMENT_WEBHOOK_SECRET must be set")
+)
+
+// InitRequest describes a topup to be paid
+type InitRequest struct {
+	TopupID   string
+	UserID    string
+	Amount    int64
+	ExpiresAt time.Time
+}
+
+// InitResult is returned by a provider after a payment is created.
+// Status is normally pending; providers may report succeeded for payments
+// settled immediately.
+type InitResult struct {
+	Reference  string
+	PaymentURL string
+	Status     string
+}
+
+// Verification is the provider's view of a payment
+type Verification struct {
+	Reference     string
+	Status        string
+	Amount        int64
+	FailureReason string
+}
+
+// Event is a payment status change delivered by webhook
+type Event struct {
+	Reference     string `json:"reference"`
+	Status        string `json:"status"`
+	Amount        int64  `json:"amount"`
+	FailureReason string `json:"failure_reason,omitempty"`
+}
+
+// PaymentProvider is implemented by every payment processor
+type PaymentProvider interface {
+	Name() string
+	// Init creates a payment for the topup and returns where the user pays
+	Init(ctx context.Context, req InitRequest) (*InitResult, error)
+	// Verify asks the provider for the current state of a payment
+	Verify(ctx context.Context, reference string) (*Verification, error)
+	// ParseWebhook authenticates and decodes a webhook request body
+	ParseWebhook(header http.Header, body []byte) (*Event, error)
+}
+
+var (
+	mu        sync.RWMutex
+	providers = map[string]PaymentProvider{}
+	mockOnce  sync.Once
+	mockErr   error
+)
+
+// Register makes a provider available by name
+func Register(p PaymentProvider) {
+	mu.Lock()
+	defer mu.Unlock()
+	providers[p.Name()] = p
+}
+
+// MockEnabled reports whether the dev-only mock provider and its checkout
+// route are switched on with PAYMENTS_ENABLE_MOCK=true
+func MockEnabled() bool {
+	return os.Getenv("PAYMENTS_ENABLE_MOCK") == "true"
+}
+
+// Get returns a registered provider. The mock provider is created on first
+// use, and only when MockEnabled.
+func Get(name string) (PaymentProvider, error) {
+	if name == MockProviderName {
+		if !MockEnabled() {
+			return nil, ErrUnknownProvider
+		}
+		mockOnce.Do(func() {
+			var m *MockProvider
+			if m, mockErr = NewMockProviderFromEnv(); mockErr == nil {
+				Register(m)
+			}
+		})
+		if mockErr != nil {
+			return nil, mockErr
+		}
+	}
+	mu.RLock()
+	defer mu.RUnlock()
+	p, ok := providers[name]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+	return p, nil
+}
+
+// Default returns the provider selected by PAYMENT_PROVIDER. There is no
+// fallback: an unset provider is an error.
+func Default() (PaymentProvider, error) {
+	name := os.Getenv("PAYMENT_PROVIDER")
+	if name == "" {
+		return nil, ErrNotConfigured
+	}
+	return Get(name)
+}
+
+// CheckConfig fails unless a provider and webhook secret are configured and
+// the provider is available. Servers call it at startup and refuse to run
+// without payments set up.
+func CheckConfig() error {
+	name := os.Getenv("PAYMENT_PROVIDER")
+	if name == "" || os.Getenv("PAYMENT_WEBHOOK_SECRET") == "" {
+		return ErrNotConfigured
+	}
+	if os.Getenv("PAYMENT_WEBHOOK_SECRET") == legacyMockSecret {
+		return fmt.Errorf("payments: PAYMENT_WEBHOOK_SECRET must not be the old built-in default")
+	}
+	if name == MockProviderName && !MockEnabled() {
+		return fmt.Errorf("payments: the mock provider is for development only; set PAYMENTS_ENABLE_MOCK=true to use it")
+	}
+	_, err := Default()
+	return err
+}
+
+// Sign computes the webhook signature for body at the given unix timestamp
+func Sign(secret []byte, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature checks the signature headers against body
+func VerifySignature(secret []byte, header http.Header, body []byte) error {
+	if len(secret) == 0 {
+		return ErrInvalidSignature
+	}
+	ts, err := strconv.ParseInt(header.Get(TimestampHeader), 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	age := time.Since(time.Unix(ts, 0))
+	if age > signatureTolerance || age < -signatureTolerance {
+		return ErrInvalidSignature
+	}
+	expected := Sign(secret, ts, body)
+	if !hmac.Equal([]byte(expected), []byte(header.Get(SignatureHeader))) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
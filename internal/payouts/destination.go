@@ -0,0 +1,76 @@
+package payouts
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+)
+
+// Validate normalises and checks the fields required for the destination type
+func (d *Destination) Validate() error {
+	d.AccountName = strings.TrimSpace(d.AccountName)
+	if d.AccountName == "" {
+		return errors.New("account_name is required")
+	}
+	switch d.Type {
+	case TypeBankAccount:
+		d.BankName = strings.TrimSpace(d.BankName)
+		d.AccountNumber = strings.ReplaceAll(d.AccountNumber, " ", "")
+		if d.BankName == "" && d.BankCode == "" {
+			return errors.New("bank_name or bank_code is required")
+		}
+		if len(d.AccountNumber) < 6 || len(d.AccountNumber) > 20 || !digits(d.AccountNumber) {
+			return errors.New("account_number must be 6-20 digits")
+		}
+		d.Network, d.PhoneNumber = "", ""
+	case TypeMobileMoney:
+		d.Network = strings.TrimSpace(d.Network)
+		d.PhoneNumber = strings.ReplaceAll(d.PhoneNumber, " ", "")
+		if d.Network == "" {
+			return errors.New("network is required")
+		}
+		if len(strings.TrimPrefix(d.PhoneNumber, "+")) < 8 || len(d.PhoneNumber) > 16 || !digits(strings.TrimPrefix(d.PhoneNumber, "+")) {
+			return errors.New("phone_number must be 8-15 digits")
+		}
+		d.BankName, d.BankCode, d.AccountNumber = "", "", ""
+	default:
+		return errors.New("type must be bank_account or mobile_money")
+	}
+	return nil
+}
+
+// Display is the masked, human readable form shown to users and admins
+// (e.g. "GTBank ••••6789"). Full account numbers are never returned by the API.
+func (d Destination) Display() string {
+	switch d.Type {
+	case TypeBankAccount:
+		name := d.BankName
+		if name == "" {
+			name = d.BankCode
+		}
+		return name + " " + Mask(d.AccountNumber)
+	case TypeMobileMoney:
+		return d.Network + " " + Mask(d.PhoneNumber)
+	}
+	return ""
+}
+
+// Mask hides all but the last four characters
+func Mask(s string) string {
+	if len(s) <= 4 {
+		return "••••"
+	}
+	return "••••" + s[len(s)-4:]
+}
+
+func digits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if !unicode.IsDigit(r) {
+			return false
+		}
+	}
+	return true
+}
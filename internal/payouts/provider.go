@@ -0,0 +1,140 @@
+package payouts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+)
+
+// Payout statuses reported by providers
+const (
+	StatusProcessing = "processing"
+	StatusPaid       = "paid"
+	StatusFailed     = "failed"
+)
+
+// Destination types a user can register
+const (
+	TypeBankAccount = "bank_account"
+	TypeMobileMoney = "mobile_money"
+)
+
+var (
+	ErrUnknownProvider = errors.New("payouts: unknown provider")
+	ErrNotConfigured   = errors.New("payouts: PAYOUT_PROVIDER and PAYOUT_WEBHOOK_SECRET must be set")
+	// ErrRejected is returned by Submit when the provider refuses the payout
+	// outright; retrying will not help.
+	ErrRejected = errors.New("payouts: payout rejected by provider")
+)
+
+// Destination is where a payout is sent. Only the fields for Type are set.
+type Destination struct {
+	Type          string `json:"type"`
+	AccountName   string `json:"account_name"`
+	BankName      string `json:"bank_name,omitempty"`
+	BankCode      string `json:"bank_code,omitempty"`
+	AccountNumber string `json:"account_number,omitempty"`
+	Network       string `json:"network,omitempty"`
+	PhoneNumber   string `json:"phone_number,omitempty"`
+}
+
+// PayoutRequest is a withdrawal handed to a provider
+type PayoutRequest struct {
+	WithdrawalID string
+	UserID       string
+	Amount       int64
+	Destination  Destination
+}
+
+// Result is the provider's view of a payout
+type Result struct {
+	Reference string `json:"reference"`
+	Status    string `json:"status"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// PayoutProvider is implemented by every payout processor
+type PayoutProvider interface {
+	Name() string
+	// Submit sends the payout. It must be safe to call again for the same
+	// withdrawal (providers should dedupe on WithdrawalID).
+	Submit(ctx context.Context, req PayoutRequest) (*Result, error)
+	// ParseCallback authenticates and decodes a status callback
+	ParseCallback(header http.Header, body []byte) (*Result, error)
+}
+
+var (
+	mu        sync.RWMutex
+	providers = map[string]PayoutProvider{}
+	simOnce   sync.Once
+	simErr    error
+)
+
+// Register makes a provider available by name
+func Register(p PayoutProvider) {
+	mu.Lock()
+	defer mu.Unlock()
+	providers[p.Name()] = p
+}
+
+// SimulatedEnabled reports whether the dev-only simulated provider is
+// switched on with PAYOUTS_ENABLE_SIMULATED=true
+func SimulatedEnabled() bool {
+	return os.Getenv("PAYOUTS_ENABLE_SIMULATED") == "true"
+}
+
+// Get returns a registered provider. The simulated provider is created on
+// first use, and only when SimulatedEnabled.
+func Get(name string) (PayoutProvider, error) {
+	if name == SimulatedProviderName {
+		if !SimulatedEnabled() {
+			return nil, ErrUnknownProvider
+		}
+		simOnce.Do(func() {
+			var s *SimulatedProvider
+			if s, simErr = NewSimulatedProviderFromEnv(); simErr == nil {
+				Register(s)
+			}
+		})
+		if simErr != nil {
+			return nil, simErr
+		}
+	}
+	mu.RLock()
+	defer mu.RUnlock()
+	p, ok := providers[name]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+	return p, nil
+}
+
+// Default returns the provider selected by PAYOUT_PROVIDER. There is no
+// fallback: an unset provider is an error.
+func Default() (PayoutProvider, error) {
+	name := os.Getenv("PAYOUT_PROVIDER")
+	if name == "" {
+		return nil, ErrNotConfigured
+	}
+	return Get(name)
+}
+
+// CheckConfig fails unless a provider and a callback secret are configured
+// and the provider is available. Servers call it at startup.
+func CheckConfig() error {
+	name := os.Getenv("PAYOUT_PROVIDER")
+	if name == "" || os.Getenv("PAYOUT_WEBHOOK_SECRET") == "" {
+		return ErrNotConfigured
+	}
+	if os.Getenv("PAYOUT_WEBHOOK_SECRET") == legacySimulatedSecret {
+		return fmt.Errorf("payouts: PAYOUT_WEBHOOK_SECRET must not be the old built-in default")
+	}
+	if name == SimulatedProviderName && !SimulatedEnabled() {
+		return fmt.Errorf("payouts: the simulated provider is for development only; set PAYOUTS_ENABLE_SIMULATED=true to use it")
+	}
+	_, err := Default()
+	return err
+}
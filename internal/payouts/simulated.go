@@ -0,0 +1,117 @@
+package payouts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sudo-init-do/crafthub/internal/payments"
+)
+
+const SimulatedProviderName = "simulated"
+
+// legacySimulatedSecret was once used when PAYOUT_WEBHOOK_SECRET was unset.
+// It is public, so it is never accepted.
+const legacySimulatedSecret = "simulated_payout_secret"
+
+// SimulatedProvider exercises the payout lifecycle offline and is only
+// available with PAYOUTS_ENABLE_SIMULATED=true. Submissions are
+// accepted as processing and settled after delay with a signed callback to
+// callbackURL. Destinations ending in 0000 fail at the provider; destinations
+// ending in 9999 return a transient error so retries can be observed.
+type SimulatedProvider struct {
+	secret      []byte
+	callbackURL string
+	delay       time.Duration
+}
+
+func NewSimulatedProvider(secret, callbackURL string, delay time.Duration) *SimulatedProvider {
+	return &SimulatedProvider{secret: []byte(secret), callbackURL: callbackURL, delay: delay}
+}
+
+// NewSimulatedProviderFromEnv reads PAYOUT_WEBHOOK_SECRET (required),
+// PAYOUT_CALLBACK_URL and PAYOUT_SIM_DELAY_SECONDS
+func NewSimulatedProviderFromEnv() (*SimulatedProvider, error) {
+	secret := os.Getenv("PAYOUT_WEBHOOK_SECRET")
+	if secret == "" || secret == legacySimulatedSecret {
+		return nil, errors.New("payouts: simulated provider needs a PAYOUT_WEBHOOK_SECRET")
+	}
+	callbackURL := os.Getenv("PAYOUT_CALLBACK_URL")
+	if callbackURL == "" {
+		port := os.Getenv("PORT")
+		if port == "" {
+			port = "8080"
+		}
+		callbackURL = "http://localhost:" + port + "/payouts/callback/" + SimulatedProviderName
+	}
+	delay := 5 * time.Second
+	if v, err := strconv.Atoi(os.Getenv("PAYOUT_SIM_DELAY_SECONDS")); err == nil && v >= 0 {
+		delay = time.Duration(v) * time.Second
+	}
+	return NewSimulatedProvider(secret, callbackURL, delay), nil
+}
+
+func (s *SimulatedProvider) Name() string { return SimulatedProviderName }
+
+func (s *SimulatedProvider) Submit(ctx context.Context, req PayoutRequest) (*Result, error) {
+	account := req.Destination.AccountNumber
+	if req.Destination.Type == TypeMobileMoney {
+		account = req.Destination.PhoneNumber
+	}
+	if strings.HasSuffix(account, "9999") {
+		return nil, errTransient
+	}
+
+	res := &Result{Reference: "simpay_" + req.WithdrawalID, Status: StatusProcessing}
+	final := Result{Reference: res.Reference, Status: StatusPaid}
+	if strings.HasSuffix(account, "0000") {
+		final.Status = StatusFailed
+		final.Reason = "destination account rejected by simulated bank"
+	}
+	time.AfterFunc(s.delay, func() {
+		if err := s.callback(final); err != nil {
+			log.Printf("simulated payout callback failed: ref=%s err=%v", final.Reference, err)
+		}
+	})
+	return res, nil
+}
+
+func (s *SimulatedProvider) ParseCallback(header http.Header, body []byte) (*Result, error) {
+	if err := payments.VerifySignature(s.secret, header, body); err != nil {
+		return nil, err
+	}
+	var res Result
+	if err := json.Unmarshal(body, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (s *SimulatedProvider) callback(res Result) error {
+	body, _ := json.Marshal(res)
+	ts := time.Now().Unix()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.callbackURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(payments.TimestampHeader, strconv.FormatInt(ts, 10))
+	req.Header.Set(payments.SignatureHeader, payments.Sign(s.secret, ts, body))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+var errTransient = errors.New("payouts: simulated provider temporarily unavailable")
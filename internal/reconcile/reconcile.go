@@ -0,0 +1,251 @@
+package reconcile
+
+import (
+	"context"
+	"time"
+
+	"github.com/sudo-init-do/crafthub/internal/db"
+)
+
+// WalletDrift describes a wallet whose cached columns disagree with the
+// values recomputed from topups, withdrawals and orders, or with the ledger.
+type WalletDrift struct {
+	UserID          string   `json:"user_id"`
+	Balance         int64    `json:"balance"`
+	ExpectedBalance int64    `json:"expected_balance"`
+	Locked          int64    `json:"locked_amount"`
+	ExpectedLocked  int64    `json:"expected_locked_amount"`
+	Escrow          int64    `json:"escrow"`
+	ExpectedEscrow  int64    `json:"expected_escrow"`
+	LedgerBalance   *int64   `json:"ledger_balance,omitempty"`
+	LedgerLocked    *int64   `json:"ledger_locked_amount,omitempty"`
+	LedgerEscrow    *int64   `json:"ledger_escrow,omitempty"`
+	Issues          []string `json:"issues"`
+}
+
+// OrderIssue is an active order whose escrow does not match its amount
+type OrderIssue struct {
+	OrderID string `json:"order_id"`
+	BuyerID string `json:"buyer_id"`
+	Status  string `json:"status"`
+	Amount  int64  `json:"amount"`
+	Escrow  int64  `json:"escrow"`
+	Issue   string `json:"issue"`
+}
+
+// HoldIssue is a pending_hold transaction left behind by a closed order
+type HoldIssue struct {
+	TransactionID string `json:"transaction_id"`
+	UserID        string `json:"user_id"`
+	OrderID       string `json:"order_id"`
+	OrderStatus   string `json:"order_status"`
+	Amount        int64  `json:"amount"`
+}
+
+// Report is the outcome of a reconciliation run
+type Report struct {
+	GeneratedAt       time.Time     `json:"generated_at"`
+	WalletsChecked    int           `json:"wallets_checked"`
+	WalletDrifts      []WalletDrift `json:"wallet_drifts"`
+	StuckOrders       []OrderIssue  `json:"stuck_orders"`
+	OrphanHolds       []HoldIssue   `json:"orphan_holds"`
+	UnbalancedEntries []string      `json:"unbalanced_entries"`
+}
+
+// Clean reports whether the run found no problems
+func (r *Report) Clean() bool {
+	return len(r.WalletDrifts) == 0 && len(r.StuckOrders) == 0 && len(r.OrphanHolds) == 0 && len(r.UnbalancedEntries) == 0
+}
+
+// Run recomputes every wallet and checks the order and ledger invariants.
+func Run(ctx context.Context) (*Report, error) {
+	r := &Report{GeneratedAt: time.Now().UTC()}
+	if err := checkWallets(ctx, r); err != nil {
+		return nil, err
+	}
+	if err := checkOrders(ctx, r); err != nil {
+		return nil, err
+	}
+	if err := checkHolds(ctx, r); err != nil {
+		return nil, err
+	}
+	if err := checkEntries(ctx, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Expected wallet values:
+//
+//	balance = completed topups - completed withdrawals
+//	          - orders bought and funded (in_progress, delivered, completed), less partial refunds
+//	          + orders sold and completed, less partial refunds and platform fees
+//	          + tips received - tips sent
+//	locked_amount = orders bought awaiting acceptance + withdrawals not yet paid out
+//	escrow = orders bought and funded but not yet settled
+const walletsQuery = `
+WITH expected AS (
+    SELECT w.user_id,
+           COALESCE(w.balance, 0) AS balance,
+           COALESCE(w.locked_amount, 0) AS locked_amount,
+           COALESCE(w.escrow, 0) AS escrow,
+           COALESCE((SELECT SUM(t.amount) FROM topups t WHERE t.user_id = w.user_id AND t.status = 'completed'), 0)
+           - COALESCE((SELECT SUM(x.amount) FROM withdrawals x WHERE x.user_id = w.user_id AND x.status = 'completed'), 0)::bigint
+           - COALESCE((SELECT SUM(o.amount - o.refunded_amount) FROM orders o WHERE o.buyer_id = w.user_id AND o.status IN ('in_progress','delivered','completed')), 0)
+           + COALESCE((SELECT SUM(o.amount - o.refunded_amount - o.platform_fee) FROM orders o WHERE o.seller_id = w.user_id AND o.status = 'completed'), 0)
+           + COALESCE((SELECT SUM(tp.amount) FROM tips tp WHERE tp.recipient_id = w.user_id), 0)
+           - COALESCE((SELECT SUM(tp.amount) FROM tips tp WHERE tp.sender_id = w.user_id), 0)
+             AS expected_balance,
+           COALESCE((SELECT SUM(o.amount) FROM orders o WHERE o.buyer_id = w.user_id AND o.status = 'pending_acceptance'), 0)
+           + COALESCE((SELECT SUM(x.amount) FROM withdrawals x WHERE x.user_id = w.user_id AND x.status IN ('pending','approved')), 0)::bigint
+             AS expected_locked,
+           COALESCE((SELECT SUM(o.amount) FROM orders o WHERE o.buyer_id = w.user_id AND o.status IN ('in_progress','delivered')), 0)
+             AS expected_escrow
+    FROM wallets w
+    WHERE w.user_id IS NOT NULL
+),
+ledger AS (
+    SELECT a.owner_id AS user_id,
+           SUM(p.amount) FILTER (WHERE a.kind = 'user_available') AS available,
+           SUM(p.amount) FILTER (WHERE a.kind = 'user_held') AS held
+    FROM ledger_accounts a
+    JOIN ledger_postings p ON p.account_id = a.id
+    WHERE a.kind IN ('user_available','user_held')
+    GROUP BY a.owner_id
+),
+ledger_escrow AS (
+    SELECT o.buyer_id AS user_id, SUM(p.amount) AS escrow
+    FROM ledger_accounts a
+    JOIN ledger_postings p ON p.account_id = a.id
+    JOIN orders o ON o.id = a.owner_id
+    WHERE a.kind = 'order_escrow'
+    GROUP BY o.buyer_id
+)
+SELECT e.user_id::text, e.balance, e.expected_balance::bigint, e.locked_amount, e.expected_locked::bigint,
+       e.escrow, e.expected_escrow::bigint,
+       CASE WHEN l.user_id IS NULL THEN NULL ELSE (COALESCE(l.available, 0) + COALESCE(l.held, 0))::bigint END,
+       CASE WHEN l.user_id IS NULL THEN NULL ELSE COALESCE(l.held, 0)::bigint END,
+       le.escrow::bigint
+FROM expected e
+LEFT JOIN ledger l ON l.user_id = e.user_id
+LEFT JOIN ledger_escrow le ON le.user_id = e.user_id
+ORDER BY e.user_id`
+
+func checkWallets(ctx context.Context, r *Report) error {
+	rows, err := db.Conn.Query(ctx, walletsQuery)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var d WalletDrift
+		if err := rows.Scan(&d.UserID, &d.Balance, &d.ExpectedBalance, &d.Locked, &d.ExpectedLocked,
+			&d.Escrow, &d.ExpectedEscrow, &d.LedgerBalance, &d.LedgerLocked, &d.LedgerEscrow); err != nil {
+			return err
+		}
+		r.WalletsChecked++
+
+		if d.Balance != d.ExpectedBalance {
+			d.Issues = append(d.Issues, "balance does not match topups, withdrawals and orders")
+		}
+		if d.Locked != d.ExpectedLocked {
+			d.Issues = append(d.Issues, "locked_amount does not match pending orders and withdrawals")
+		}
+		if d.Escrow != d.ExpectedEscrow {
+			d.Issues = append(d.Issues, "escrow does not match funded orders")
+		}
+		if d.LedgerBalance != nil && *d.LedgerBalance != d.Balance {
+			d.Issues = append(d.Issues, "balance does not match ledger")
+		}
+		if d.LedgerLocked != nil && *d.LedgerLocked != d.Locked {
+			d.Issues = append(d.Issues, "locked_amount does not match ledger")
+		}
+		if d.LedgerEscrow != nil && *d.LedgerEscrow != d.Escrow {
+			d.Issues = append(d.Issues, "escrow does not match ledger")
+		}
+		if len(d.Issues) > 0 {
+			r.WalletDrifts = append(r.WalletDrifts, d)
+		}
+	}
+	return rows.Err()
+}
+
+// checkOrders finds funded orders whose escrow is missing or short. Orders
+// with a ledger escrow account are checked against it; older orders fall back
+// to the buyer's wallet escrow.
+func checkOrders(ctx context.Context, r *Report) error {
+	rows, err := db.Conn.Query(ctx, `
+        SELECT o.id::text, o.buyer_id::text, o.status, o.amount,
+               COALESCE((SELECT SUM(p.amount) FROM ledger_accounts a JOIN ledger_postings p ON p.account_id = a.id
+                         WHERE a.kind = 'order_escrow' AND a.owner_id = o.id), -1)::bigint AS ledger_escrow,
+               COALESCE(w.escrow, 0)
+        FROM orders o
+        LEFT JOIN wallets w ON w.user_id = o.buyer_id
+        WHERE o.status IN ('in_progress','delivered')
+        ORDER BY o.created_at`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var o OrderIssue
+		var ledgerEscrow, walletEscrow int64
+		if err := rows.Scan(&o.OrderID, &o.BuyerID, &o.Status, &o.Amount, &ledgerEscrow, &walletEscrow); err != nil {
+			return err
+		}
+		switch {
+		case ledgerEscrow >= 0 && ledgerEscrow != o.Amount:
+			o.Escrow = ledgerEscrow
+			o.Issue = "order escrow account does not hold the order amount"
+		case ledgerEscrow < 0 && walletEscrow < o.Amount:
+			o.Escrow = walletEscrow
+			o.Issue = "buyer wallet escrow is smaller than the order amount"
+		default:
+			continue
+		}
+		r.StuckOrders = append(r.StuckOrders, o)
+	}
+	return rows.Err()
+}
+
+func checkHolds(ctx context.Context, r *Report) error {
+	rows, err := db.Conn.Query(ctx, `
+        SELECT t.id::text, t.user_id::text, o.id::text, o.status, t.amount::bigint
+        FROM transactions t
+        JOIN orders o ON o.id = t.reference
+        WHERE t.status = 'pending_hold' AND o.status IN ('canceled','declined')
+        ORDER BY t.created_at`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var h HoldIssue
+		if err := rows.Scan(&h.TransactionID, &h.UserID, &h.OrderID, &h.OrderStatus, &h.Amount); err != nil {
+			return err
+		}
+		r.OrphanHolds = append(r.OrphanHolds, h)
+	}
+	return rows.Err()
+}
+
+func checkEntries(ctx context.Context, r *Report) error {
+	rows, err := db.Conn.Query(ctx,
+		`SELECT entry_id::text FROM ledger_postings GROUP BY entry_id HAVING SUM(amount) <> 0`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return err
+		}
+		r.UnbalancedEntries = append(r.UnbalancedEntries, id)
+	}
+	return rows.Err()
+}
@@ -0,0 +1,228 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/sudo-init-do/crafthub/internal/db"
+)
+
+// File purposes, each with its own size and type limits
+const (
+	PurposeAvatar     = "avatar"
+	PurposeAttachment = "attachment" // shared in an order's conversation
+	PurposeDelivery   = "delivery"   // deliverables attached to an order delivery
+)
+
+const filenameMaxLen = 255
+
+var (
+	ErrUnknownPurpose = errors.New("unknown file purpose")
+	ErrTooLarge       = errors.New("file is too large")
+	ErrTypeNotAllowed = errors.New("file type is not allowed")
+)
+
+var imageTypes = []string{"image/jpeg", "image/png", "image/gif", "image/webp"}
+
+// allowedTypes lists the sniffed MIME types accepted per purpose
+var allowedTypes = map[string][]string{
+	PurposeAvatar: imageTypes,
+	PurposeAttachment: append([]string{
+		"application/pdf", "text/plain", "application/zip",
+	}, imageTypes...),
+	PurposeDelivery: append([]string{
+		"application/pdf", "text/plain", "application/zip", "application/x-gzip", "application/x-rar-compressed",
+		"application/octet-stream", "audio/mpeg", "audio/wave", "audio/ogg", "video/mp4", "video/webm", "video/avi",
+	}, imageTypes...),
+}
+
+// MaxSize is the upload limit for a purpose in bytes
+// (STORAGE_MAX_AVATAR_MB 5, STORAGE_MAX_ATTACHMENT_MB 25, STORAGE_MAX_DELIVERY_MB 250)
+func MaxSize(purpose string) int64 {
+	defaults := map[string]int64{PurposeAvatar: 5, PurposeAttachment: 25, PurposeDelivery: 250}
+	mb, ok := defaults[purpose]
+	if !ok {
+		return 0
+	}
+	if v, err := strconv.ParseInt(os.Getenv("STORAGE_MAX_"+strings.ToUpper(purpose)+"_MB"), 10, 64); err == nil && v > 0 {
+		mb = v
+	}
+	return mb << 20
+}
+
+// MaxUploadSize is the largest limit of any purpose, used to cap request bodies
+func MaxUploadSize() int64 {
+	var max int64
+	for purpose := range allowedTypes {
+		if n := MaxSize(purpose); n > max {
+			max = n
+		}
+	}
+	return max
+}
+
+// File is an uploaded blob and who may see it
+type File struct {
+	ID          string    `json:"id"`
+	OwnerID     string    `json:"owner_id"`
+	Purpose     string    `json:"purpose"`
+	Filename    string    `json:"filename"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	SHA256      string    `json:"sha256"`
+	OrderID     *string   `json:"order_id,omitempty"`
+	DeliveryID  *string   `json:"delivery_id,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	key         string
+}
+
+// fileColumns is the select list scanned by scanFile
+const fileColumns = `id::text, owner_id::text, purpose, filename, content_type, size_bytes, sha256,
+	order_id::text, delivery_id::text, created_at, storage_key`
+
+func scanFile(row pgx.Row) (*File, error) {
+	var f File
+	err := row.Scan(&f.ID, &f.OwnerID, &f.Purpose, &f.Filename, &f.ContentType, &f.Size, &f.SHA256,
+		&f.OrderID, &f.DeliveryID, &f.CreatedAt, &f.key)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+// GetFile loads a file record by id
+func GetFile(ctx context.Context, id string) (*File, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrNotFound
+	}
+	return scanFile(db.Conn.QueryRow(ctx, `SELECT `+fileColumns+` FROM files WHERE id = $1`, id))
+}
+
+// DeliveryFiles returns the files linked to the given deliveries, by delivery id
+func DeliveryFiles(ctx context.Context, deliveryIDs []string) (map[string][]File, error) {
+	out := map[string][]File{}
+	if len(deliveryIDs) == 0 {
+		return out, nil
+	}
+	rows, err := db.Conn.Query(ctx,
+		`SELECT `+fileColumns+` FROM files WHERE delivery_id = ANY($1::uuid[]) ORDER BY created_at, id`, deliveryIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		f, err := scanFile(rows)
+		if err != nil {
+			return nil, err
+		}
+		out[*f.DeliveryID] = append(out[*f.DeliveryID], *f)
+	}
+	return out, rows.Err()
+}
+
+// Upload is a file to store on behalf of a user
+type Upload struct {
+	OwnerID  string
+	Purpose  string
+	OrderID  *string
+	Filename string
+	Size     int64
+	Body     io.Reader
+}
+
+// Save checks the upload against its purpose's limits, sniffs its type,
+// stores the blob and records it. The blob is removed if recording fails.
+func Save(ctx context.Context, store BlobStore, up Upload) (*File, error) {
+	allowed, ok := allowedTypes[up.Purpose]
+	if !ok {
+		return nil, ErrUnknownPurpose
+	}
+	if up.Size <= 0 || up.Size > MaxSize(up.Purpose) {
+		return nil, ErrTooLarge
+	}
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(up.Body, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	head = head[:n]
+	contentType, _, _ := mime.ParseMediaType(http.DetectContentType(head))
+	permitted := false
+	for _, t := range allowed {
+		permitted = permitted || t == contentType
+	}
+	if !permitted {
+		return nil, fmt.Errorf("%w: %s", ErrTypeNotAllowed, contentType)
+	}
+
+	f := &File{
+		ID: uuid.New().String(), OwnerID: up.OwnerID, Purpose: up.Purpose, OrderID: up.OrderID,
+		Filename: cleanFilename(up.Filename), ContentType: contentType, Size: up.Size,
+	}
+	f.key = up.Purpose + "/" + time.Now().UTC().Format("2006/01") + "/" + f.ID
+	hash := sha256.New()
+	body := io.TeeReader(io.MultiReader(bytes.NewReader(head), up.Body), hash)
+	if err := store.Put(ctx, f.key, body, up.Size, contentType); err != nil {
+		return nil, err
+	}
+	f.SHA256 = hex.EncodeToString(hash.Sum(nil))
+
+	err = db.Conn.QueryRow(ctx,
+		`INSERT INTO files (id, owner_id, purpose, storage_driver, storage_key, filename, content_type, size_bytes, sha256, order_id)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING created_at`,
+		f.ID, f.OwnerID, f.Purpose, store.Name(), f.key, f.Filename, f.ContentType, f.Size, f.SHA256, f.OrderID,
+	).Scan(&f.CreatedAt)
+	if err != nil {
+		_ = store.Delete(ctx, f.key)
+		return nil, err
+	}
+	return f, nil
+}
+
+// DownloadURL signs an expiring URL for the file
+func DownloadURL(ctx context.Context, store BlobStore, f *File) (string, time.Time, error) {
+	ttl := URLTTL()
+	u, err := store.SignedURL(ctx, f.key, f.Filename, ttl)
+	return u, time.Now().Add(ttl), err
+}
+
+// AvatarURL is the stable public URL stored on a profile for an avatar file
+func AvatarURL(fileID string) string {
+	return strings.TrimRight(os.Getenv("STORAGE_PUBLIC_URL"), "/") + "/files/avatars/" + fileID
+}
+
+// cleanFilename keeps the base name and drops control characters
+func cleanFilename(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f || r == '"' {
+			return -1
+		}
+		return r
+	}, name)
+	if name == "" || name == "." || name == "/" {
+		name = "file"
+	}
+	if len(name) > filenameMaxLen {
+		name = name[len(name)-filenameMaxLen:]
+	}
+	return name
+}
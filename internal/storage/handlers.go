@@ -0,0 +1,198 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sudo-init-do/crafthub/internal/db"
+	"github.com/sudo-init-do/crafthub/internal/orders"
+)
+
+// POST /files
+// Multipart upload with fields file, purpose and, for attachments and
+// deliverables, order_id.
+func UploadFile(c echo.Context) error {
+	uid, ok := c.Get("user_id").(string)
+	if !ok || uid == "" {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "unauthorized"})
+	}
+	// Leave room for the multipart envelope around the largest allowed file
+	c.Request().Body = http.MaxBytesReader(c.Response(), c.Request().Body, MaxUploadSize()+1<<20)
+
+	purpose := c.FormValue("purpose")
+	if _, ok := allowedTypes[purpose]; !ok {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "purpose must be avatar, attachment or delivery"})
+	}
+	var orderID *string
+	if purpose == PurposeAvatar {
+		if c.FormValue("order_id") != "" {
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": "avatars are not linked to orders"})
+		}
+	} else {
+		id := c.FormValue("order_id")
+		if id == "" {
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": "order_id is required"})
+		}
+		if msg, status := checkOrderUpload(c.Request().Context(), uid, id, purpose); msg != "" {
+			return c.JSON(status, echo.Map{"error": msg})
+		}
+		orderID = &id
+	}
+
+	fh, err := c.FormFile("file")
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			return c.JSON(http.StatusRequestEntityTooLarge, echo.Map{"error": ErrTooLarge.Error(), "max_bytes": MaxSize(purpose)})
+		}
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "file is required"})
+	}
+	src, err := fh.Open()
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "could not read file"})
+	}
+	defer src.Close()
+
+	store, err := Default()
+	if err != nil {
+		log.Printf("storage unavailable: %v", err)
+		return c.JSON(http.StatusServiceUnavailable, echo.Map{"error": "file storage is not configured"})
+	}
+	f, err := Save(c.Request().Context(), store, Upload{
+		OwnerID: uid, Purpose: purpose, OrderID: orderID, Filename: fh.Filename, Size: fh.Size, Body: src,
+	})
+	switch {
+	case errors.Is(err, ErrTooLarge):
+		return c.JSON(http.StatusRequestEntityTooLarge, echo.Map{"error": err.Error(), "max_bytes": MaxSize(purpose)})
+	case errors.Is(err, ErrTypeNotAllowed):
+		return c.JSON(http.StatusUnsupportedMediaType, echo.Map{"error": err.Error()})
+	case err != nil:
+		log.Printf("file upload failed: %v", err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to store file"})
+	}
+	return c.JSON(http.StatusCreated, echo.Map{"file": f})
+}
+
+// checkOrderUpload allows attachments from either party and deliverables from
+// the seller while the order is being worked on
+func checkOrderUpload(ctx context.Context, uid, orderID, purpose string) (string, int) {
+	var buyerID, sellerID, status string
+	err := db.Conn.QueryRow(ctx,
+		`SELECT buyer_id::text, seller_id::text, status FROM orders WHERE id::text = $1`, orderID,
+	).Scan(&buyerID, &sellerID, &status)
+	if err != nil || (uid != buyerID && uid != sellerID) {
+		return "order not found", http.StatusNotFound
+	}
+	if purpose == PurposeDelivery {
+		if uid != sellerID {
+			return "only the seller can upload deliverables", http.StatusForbidden
+		}
+		if status != orders.StatusInProgress {
+			return "deliverables can only be uploaded while the order is in progress", http.StatusConflict
+		}
+	}
+	return "", 0
+}
+
+// canView reports whether uid may download f. Order files are restricted to
+// the order's buyer and seller; avatars are visible to any signed-in user.
+func canView(ctx context.Context, uid, role string, f *File) bool {
+	if uid == f.OwnerID || role == "admin" || f.Purpose == PurposeAvatar {
+		return true
+	}
+	if f.OrderID == nil {
+		return false
+	}
+	var participant bool
+	_ = db.Conn.QueryRow(ctx,
+		`SELECT $2::uuid IN (buyer_id, seller_id) FROM orders WHERE id = $1`, *f.OrderID, uid,
+	).Scan(&participant)
+	return participant
+}
+
+// GET /files/:id/url
+// Returns a signed download URL that expires after STORAGE_URL_TTL_MINUTES.
+func GetFileURL(c echo.Context) error {
+	uid, ok := c.Get("user_id").(string)
+	if !ok || uid == "" {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "unauthorized"})
+	}
+	role, _ := c.Get("role").(string)
+	ctx := c.Request().Context()
+
+	f, err := GetFile(ctx, c.Param("id"))
+	if err == nil && !canView(ctx, uid, role, f) {
+		err = ErrNotFound
+	}
+	if errors.Is(err, ErrNotFound) {
+		return c.JSON(http.StatusNotFound, echo.Map{"error": "file not found"})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to fetch file"})
+	}
+	store, err := Default()
+	if err != nil {
+		return c.JSON(http.StatusServiceUnavailable, echo.Map{"error": "file storage is not configured"})
+	}
+	u, expiresAt, err := DownloadURL(ctx, store, f)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to sign download url"})
+	}
+	return c.JSON(http.StatusOK, echo.Map{"file": f, "url": u, "expires_at": expiresAt})
+}
+
+// GET /files/avatars/:id
+// Stable public address for a profile picture; redirects to a signed URL.
+func AvatarRedirect(c echo.Context) error {
+	ctx := c.Request().Context()
+	f, err := GetFile(ctx, c.Param("id"))
+	if err != nil || f.Purpose != PurposeAvatar {
+		return c.JSON(http.StatusNotFound, echo.Map{"error": "avatar not found"})
+	}
+	store, err := Default()
+	if err != nil {
+		return c.JSON(http.StatusServiceUnavailable, echo.Map{"error": "file storage is not configured"})
+	}
+	u, _, err := DownloadURL(ctx, store, f)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to sign download url"})
+	}
+	c.Response().Header().Set("Cache-Control", fmt.Sprintf("private, max-age=%d", int(URLTTL().Seconds())/2))
+	return c.Redirect(http.StatusFound, u)
+}
+
+// GET /files/blob
+// Serves local-disk blobs for URLs signed by LocalStore.
+func ServeBlob(c echo.Context) error {
+	store, err := Default()
+	local, ok := store.(*LocalStore)
+	if err != nil || !ok {
+		return c.JSON(http.StatusNotFound, echo.Map{"error": "not found"})
+	}
+	key, filename, err := local.Verify(c.QueryParams())
+	if err != nil {
+		return c.JSON(http.StatusForbidden, echo.Map{"error": "link is invalid or has expired"})
+	}
+	ctx := c.Request().Context()
+	var contentType string
+	if err := db.Conn.QueryRow(ctx, `SELECT content_type FROM files WHERE storage_key = $1`, key).Scan(&contentType); err != nil {
+		return c.JSON(http.StatusNotFound, echo.Map{"error": "file not found"})
+	}
+	body, obj, err := local.Get(ctx, key)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, echo.Map{"error": "file not found"})
+	}
+	defer body.Close()
+
+	h := c.Response().Header()
+	h.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	h.Set("Content-Length", fmt.Sprint(obj.Size))
+	h.Set("X-Content-Type-Options", "nosniff")
+	return c.Stream(http.StatusOK, contentType, io.Reader(body))
+}
@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Storage drivers selectable with STORAGE_DRIVER
+const (
+	DriverLocal = "local"
+	DriverS3    = "s3"
+)
+
+var (
+	ErrNotFound         = errors.New("storage: object not found")
+	ErrInvalidKey       = errors.New("storage: invalid object key")
+	ErrInvalidSignature = errors.New("storage: invalid or expired signature")
+	ErrUnknownDriver    = errors.New("storage: unknown driver")
+)
+
+// Object describes a stored blob
+type Object struct {
+	Key         string
+	ContentType string
+	Size        int64
+}
+
+// BlobStore is implemented by every storage backend
+type BlobStore interface {
+	Name() string
+	// Put stores size bytes read from body under key
+	Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error
+	// Get opens the object for reading; the caller closes it
+	Get(ctx context.Context, key string) (io.ReadCloser, *Object, error)
+	Delete(ctx context.Context, key string) error
+	// SignedURL returns a URL that downloads key as filename until ttl elapses
+	SignedURL(ctx context.Context, key, filename string, ttl time.Duration) (string, error)
+}
+
+var (
+	defaultOnce  sync.Once
+	defaultStore BlobStore
+	defaultErr   error
+)
+
+// Default returns the store selected by STORAGE_DRIVER (local if unset)
+func Default() (BlobStore, error) {
+	defaultOnce.Do(func() {
+		switch os.Getenv("STORAGE_DRIVER") {
+		case "", DriverLocal:
+			defaultStore, defaultErr = NewLocalStoreFromEnv()
+		case DriverS3:
+			defaultStore, defaultErr = NewS3StoreFromEnv()
+		default:
+			defaultErr = ErrUnknownDriver
+		}
+	})
+	return defaultStore, defaultErr
+}
+
+// URLTTL is how long signed download URLs stay valid
+// (STORAGE_URL_TTL_MINUTES, default 15)
+func URLTTL() time.Duration {
+	if v, err := strconv.Atoi(os.Getenv("STORAGE_URL_TTL_MINUTES")); err == nil && v > 0 {
+		return time.Duration(v) * time.Minute
+	}
+	return 15 * time.Minute
+}
+
+// cleanKey rejects keys that are empty or would escape the store's root
+func cleanKey(key string) (string, error) {
+	k := path.Clean("/" + key)[1:]
+	if k == "" || k != key || strings.Contains(key, "\\") {
+		return "", ErrInvalidKey
+	}
+	return k, nil
+}
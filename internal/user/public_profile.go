@@ -8,6 +8,8 @@ import (
 
 	"github.com/labstack/echo/v4"
 	"github.com/sudo-init-do/crafthub/internal/db"
+	"github.com/sudo-init-do/crafthub/internal/orders"
+	"github.com/sudo-init-do/crafthub/internal/wallet"
 )
 
 // GET /user/:id/profile
@@ -62,5 +64,17 @@ func GetPublicProfile(c echo.Context) error {
 		"created_at": createdAt.Format(time.RFC3339),
 	}
 
+	// Sellers show how reliably they deliver on time
+	if stats, err := orders.SellerOnTimeStats(context.Background(), id); err == nil && stats.Delivered > 0 {
+		profile["delivery_stats"] = stats
+	}
+
+	// Creators show their most recent supporters
+	if role == "creator" {
+		if supporters, err := wallet.RecentSupporters(context.Background(), id, 10); err == nil {
+			profile["recent_supporters"] = supporters
+		}
+	}
+
 	return c.JSON(http.StatusOK, profile)
 }
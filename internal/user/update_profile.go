@@ -5,12 +5,14 @@ import (
 
     "github.com/labstack/echo/v4"
     "github.com/sudo-init-do/crafthub/internal/db"
+    "github.com/sudo-init-do/crafthub/internal/storage"
 )
 
 type UpdateProfileRequest struct {
 	Name      string `json:"name"`
 	Bio       string `json:"bio"`
 	AvatarURL string `json:"avatar_url"`
+	AvatarFileID string `json:"avatar_file_id"` // an uploaded avatar; takes precedence over avatar_url
 }
 
 // PATCH /user/profile
@@ -25,6 +27,13 @@ func UpdateProfile(c echo.Context) error {
 	if err := c.Bind(&req); err != nil {
 		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid request"})
 	}
+	if req.AvatarFileID != "" {
+		f, err := storage.GetFile(c.Request().Context(), req.AvatarFileID)
+		if err != nil || f.OwnerID != userID || f.Purpose != storage.PurposeAvatar {
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": "avatar_file_id must be an avatar you uploaded"})
+		}
+		req.AvatarURL = storage.AvatarURL(f.ID)
+	}
 
 	query := `
 		UPDATE users 
@@ -0,0 +1,130 @@
+package wallet
+
+import (
+    "context"
+    "errors"
+    "log"
+    "net/http"
+    "time"
+
+    "github.com/jackc/pgx/v5"
+    "github.com/labstack/echo/v4"
+    "github.com/sudo-init-do/crafthub/internal/db"
+    "github.com/sudo-init-do/crafthub/internal/payouts"
+)
+
+type ReviewWithdrawalRequest struct {
+    Reason string `json:"reason"`
+}
+
+// AdminListWithdrawals returns withdrawals for review
+// GET /admin/withdrawals?status=pending&user_id=
+func AdminListWithdrawals(c echo.Context) error {
+    status := c.QueryParam("status")
+    if status == "" {
+        status = WithdrawalPending
+    }
+    if status == "all" {
+        status = ""
+    }
+    items, err := queryWithdrawals(context.Background(), c.QueryParam("user_id"), status)
+    if err != nil {
+        return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not fetch withdrawals"})
+    }
+    return c.JSON(http.StatusOK, echo.Map{"withdrawals": items})
+}
+
+// ApproveWithdrawal approves a pending withdrawal and queues its payout.
+// Funds stay reserved until the payout provider confirms or fails the payout.
+// POST /admin/withdrawals/:id/approve
+func ApproveWithdrawal(c echo.Context) error {
+    adminID, _ := c.Get("user_id").(string)
+    id := c.Param("id")
+    var req ReviewWithdrawalRequest
+    _ = c.Bind(&req)
+
+    provider, err := payouts.Default()
+    if err != nil {
+        return c.JSON(http.StatusInternalServerError, echo.Map{"error": "payout provider not configured"})
+    }
+
+    ctx := context.Background()
+    tx, err := db.Conn.Begin(ctx)
+    if err != nil {
+        return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not start transaction"})
+    }
+    defer tx.Rollback(ctx)
+
+    userID, amount, err := lockWithdrawal(ctx, tx, id, WithdrawalPending)
+    if errors.Is(err, pgx.ErrNoRows) {
+        return c.JSON(http.StatusNotFound, echo.Map{"error": "withdrawal not found"})
+    }
+    if errors.Is(err, errWithdrawalStatus) {
+        return c.JSON(http.StatusBadRequest, echo.Map{"error": "only pending withdrawals can be approved"})
+    }
+    if err != nil {
+        return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not load withdrawal"})
+    }
+
+    if _, err = tx.Exec(ctx,
+        `UPDATE withdrawals
+         SET status = 'approved', reason = NULLIF($2, ''), approved_by = $3, approved_at = $4, updated_at = $4,
+             payout_provider = $5, payout_status = 'queued'
+         WHERE id = $1`,
+        id, req.Reason, adminID, time.Now(), provider.Name(),
+    ); err != nil {
+        return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not update withdrawal"})
+    }
+    if err = tx.Commit(ctx); err != nil {
+        return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not approve withdrawal"})
+    }
+
+    // If this fails the payout sweep picks the withdrawal up again
+    queued := true
+    if err := enqueuePayout(id); err != nil {
+        log.Printf("failed to enqueue payout for withdrawal %s: %v", id, err)
+        queued = false
+    }
+
+    notifyWithdrawal(id, userID, WithdrawalApproved, req.Reason, amount)
+    return c.JSON(http.StatusOK, echo.Map{"message": "withdrawal approved", "withdrawal_id": id, "status": WithdrawalApproved, "payout_queued": queued})
+}
+
+// RejectWithdrawal declines a pending withdrawal and releases the reservation
+// POST /admin/withdrawals/:id/reject
+func RejectWithdrawal(c echo.Context) error {
+    adminID, _ := c.Get("user_id").(string)
+    id := c.Param("id")
+    var req ReviewWithdrawalRequest
+    if err := c.Bind(&req); err != nil || req.Reason == "" {
+        return c.JSON(http.StatusBadRequest, echo.Map{"error": "reason is required"})
+    }
+
+    ctx := context.Background()
+    tx, err := db.Conn.Begin(ctx)
+    if err != nil {
+        return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not start transaction"})
+    }
+    defer tx.Rollback(ctx)
+
+    userID, amount, err := lockWithdrawal(ctx, tx, id, WithdrawalPending)
+    if errors.Is(err, pgx.ErrNoRows) {
+        return c.JSON(http.StatusNotFound, echo.Map{"error": "withdrawal not found"})
+    }
+    if errors.Is(err, errWithdrawalStatus) {
+        return c.JSON(http.StatusBadRequest, echo.Map{"error": "only pending withdrawals can be rejected"})
+    }
+    if err != nil {
+        return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not load withdrawal"})
+    }
+
+    if err = releaseWithdrawal(ctx, tx, id, userID, amount, WithdrawalRejected, req.Reason, adminID); err != nil {
+        return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not release funds"})
+    }
+    if err = tx.Commit(ctx); err != nil {
+        return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not reject withdrawal"})
+    }
+
+    notifyWithdrawal(id, userID, WithdrawalRejected, req.Reason, amount)
+    return c.JSON(http.StatusOK, echo.Map{"message": "withdrawal rejected", "withdrawal_id": id, "status": WithdrawalRejected})
+}
@@ -0,0 +1,171 @@
+package wallet
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "net/http"
+    "time"
+
+    "github.com/google/uuid"
+    "github.com/jackc/pgx/v5"
+    "github.com/labstack/echo/v4"
+    "github.com/sudo-init-do/crafthub/internal/db"
+    "github.com/sudo-init-do/crafthub/internal/payouts"
+)
+
+// PayoutMethodResponse only ever carries masked destination data
+type PayoutMethodResponse struct {
+    ID        string    `json:"id"`
+    Type      string    `json:"type"`
+    Display   string    `json:"display"`
+    IsDefault bool      `json:"is_default"`
+    CreatedAt time.Time `json:"created_at"`
+}
+
+var errNoPayoutMethod = errors.New("no payout method")
+
+// AddPayoutMethod registers a bank account or mobile money destination
+// POST /wallet/payout-methods
+func AddPayoutMethod(c echo.Context) error {
+    uid, ok := c.Get("user_id").(string)
+    if !ok || uid == "" {
+        return c.JSON(http.StatusUnauthorized, echo.Map{"error": "unauthorized"})
+    }
+    var req struct {
+        payouts.Destination
+        MakeDefault bool `json:"make_default"`
+    }
+    if err := c.Bind(&req); err != nil {
+        return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid request"})
+    }
+    dest := req.Destination
+    if err := dest.Validate(); err != nil {
+        return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+    }
+    details, _ := json.Marshal(dest)
+
+    ctx := context.Background()
+    tx, err := db.Conn.Begin(ctx)
+    if err != nil {
+        return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not start transaction"})
+    }
+    defer tx.Rollback(ctx)
+
+    // The first method becomes the default
+    var active int
+    _ = tx.QueryRow(ctx, `SELECT COUNT(*) FROM payout_methods WHERE user_id = $1 AND deleted_at IS NULL`, uid).Scan(&active)
+    makeDefault := req.MakeDefault || active == 0
+    if makeDefault {
+        if _, err = tx.Exec(ctx, `UPDATE payout_methods SET is_default = FALSE WHERE user_id = $1 AND is_default`, uid); err != nil {
+            return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not update payout methods"})
+        }
+    }
+
+    m := PayoutMethodResponse{ID: uuid.New().String(), Type: dest.Type, Display: dest.Display(), IsDefault: makeDefault, CreatedAt: time.Now()}
+    if _, err = tx.Exec(ctx,
+        `INSERT INTO payout_methods (id, user_id, type, display, details, is_default, created_at)
+         VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+        m.ID, uid, m.Type, m.Display, details, m.IsDefault, m.CreatedAt,
+    ); err != nil {
+        return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not save payout method"})
+    }
+    if err = tx.Commit(ctx); err != nil {
+        return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not save payout method"})
+    }
+    return c.JSON(http.StatusCreated, m)
+}
+
+// ListPayoutMethods returns the user's active payout methods
+// GET /wallet/payout-methods
+func ListPayoutMethods(c echo.Context) error {
+    uid, ok := c.Get("user_id").(string)
+    if !ok || uid == "" {
+        return c.JSON(http.StatusUnauthorized, echo.Map{"error": "unauthorized"})
+    }
+    rows, err := db.Conn.Query(context.Background(),
+        `SELECT id::text, type, display, is_default, created_at
+         FROM payout_methods WHERE user_id = $1 AND deleted_at IS NULL
+         ORDER BY is_default DESC, created_at DESC`, uid,
+    )
+    if err != nil {
+        return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not fetch payout methods"})
+    }
+    defer rows.Close()
+
+    var items []PayoutMethodResponse
+    for rows.Next() {
+        var m PayoutMethodResponse
+        if err := rows.Scan(&m.ID, &m.Type, &m.Display, &m.IsDefault, &m.CreatedAt); err != nil {
+            return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to read payout method"})
+        }
+        items = append(items, m)
+    }
+    return c.JSON(http.StatusOK, echo.Map{"payout_methods": items})
+}
+
+// SetDefaultPayoutMethod makes a method the default for new withdrawals
+// POST /wallet/payout-methods/:id/default
+func SetDefaultPayoutMethod(c echo.Context) error {
+    uid, ok := c.Get("user_id").(string)
+    if !ok || uid == "" {
+        return c.JSON(http.StatusUnauthorized, echo.Map{"error": "unauthorized"})
+    }
+    id := c.Param("id")
+    ctx := context.Background()
+    tx, err := db.Conn.Begin(ctx)
+    if err != nil {
+        return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not start transaction"})
+    }
+    defer tx.Rollback(ctx)
+
+    if _, err = tx.Exec(ctx, `UPDATE payout_methods SET is_default = FALSE WHERE user_id = $1 AND is_default`, uid); err != nil {
+        return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not update payout methods"})
+    }
+    ct, err := tx.Exec(ctx,
+        `UPDATE payout_methods SET is_default = TRUE WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL`, id, uid)
+    if err != nil {
+        return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not update payout method"})
+    }
+    if ct.RowsAffected() == 0 {
+        return c.JSON(http.StatusNotFound, echo.Map{"error": "payout method not found"})
+    }
+    if err = tx.Commit(ctx); err != nil {
+        return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not update payout method"})
+    }
+    return c.JSON(http.StatusOK, echo.Map{"message": "default payout method updated"})
+}
+
+// DeletePayoutMethod removes a method. It is soft-deleted so past withdrawals
+// keep their destination.
+// DELETE /wallet/payout-methods/:id
+func DeletePayoutMethod(c echo.Context) error {
+    uid, ok := c.Get("user_id").(string)
+    if !ok || uid == "" {
+        return c.JSON(http.StatusUnauthorized, echo.Map{"error": "unauthorized"})
+    }
+    ct, err := db.Conn.Exec(context.Background(),
+        `UPDATE payout_methods SET deleted_at = NOW(), is_default = FALSE
+         WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL`, c.Param("id"), uid)
+    if err != nil {
+        return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not delete payout method"})
+    }
+    if ct.RowsAffected() == 0 {
+        return c.JSON(http.StatusNotFound, echo.Map{"error": "payout method not found"})
+    }
+    return c.JSON(http.StatusOK, echo.Map{"message": "payout method removed"})
+}
+
+// resolvePayoutMethod returns the requested method, or the user's default when id is empty
+func resolvePayoutMethod(ctx context.Context, q pgx.Tx, userID, id string) (string, error) {
+    var methodID string
+    err := q.QueryRow(ctx,
+        `SELECT id::text FROM payout_methods
+         WHERE user_id = $1 AND deleted_at IS NULL AND ($2 = '' OR id::text = $2) AND ($2 <> '' OR is_default)
+         LIMIT 1`, userID, id,
+    ).Scan(&methodID)
+    if errors.Is(err, pgx.ErrNoRows) {
+        return "", errNoPayoutMethod
+    }
+    return methodID, err
+}
@@ -0,0 +1,276 @@
+package wallet
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "io"
+    "log"
+    "net/http"
+    "time"
+
+    "github.com/hibiken/asynq"
+    "github.com/labstack/echo/v4"
+    "github.com/sudo-init-do/crafthub/internal/alerts"
+    "github.com/sudo-init-do/crafthub/internal/db"
+    "github.com/sudo-init-do/crafthub/internal/ledger"
+    "github.com/sudo-init-do/crafthub/internal/payments"
+    "github.com/sudo-init-do/crafthub/internal/payouts"
+)
+
+// Approved withdrawals are paid out asynchronously:
+//   approve -> payout_status queued -> task submits to provider (retried)
+//   -> processing -> provider callback -> paid (withdrawal completed)
+//                                      -> failed (funds released)
+const TaskPayoutSubmit = "payout:submit"
+
+// TaskPayoutSweep re-enqueues approved payouts that have no live submit task,
+// e.g. because enqueuing failed after approval
+const TaskPayoutSweep = "payout:sweep"
+
+// payoutSweepGrace leaves freshly approved withdrawals to their own task
+const payoutSweepGrace = 2 * time.Minute
+
+const payoutMaxRetry = 5
+
+// Payout statuses stored on withdrawals.payout_status
+const (
+    PayoutQueued     = "queued"
+    PayoutRetrying   = "retrying"
+    PayoutProcessing = payouts.StatusProcessing
+    PayoutPaid       = payouts.StatusPaid
+    PayoutFailed     = payouts.StatusFailed
+)
+
+type PayoutSubmitPayload struct {
+    WithdrawalID string `json:"withdrawal_id"`
+}
+
+func init() {
+    alerts.HandleFunc(TaskPayoutSubmit, handlePayoutSubmit)
+    alerts.HandleFunc(TaskPayoutSweep, handlePayoutSweep)
+    alerts.Schedule(5*time.Minute, TaskPayoutSweep, asynq.Queue("payouts"))
+}
+
+// enqueuePayout schedules submission of an approved withdrawal
+func enqueuePayout(withdrawalID string) error {
+    return alerts.EnqueueTask(TaskPayoutSubmit, PayoutSubmitPayload{WithdrawalID: withdrawalID},
+        asynq.Queue("payouts"), asynq.MaxRetry(payoutMaxRetry), asynq.TaskID(TaskPayoutSubmit+":"+withdrawalID))
+}
+
+// handlePayoutSweep enqueues a submit task for every queued or retrying
+// payout. The task id is per withdrawal, so payouts that still have a
+// pending or retrying task are skipped.
+func handlePayoutSweep(ctx context.Context, _ *asynq.Task) error {
+    rows, err := db.Conn.Query(ctx,
+        `SELECT id::text FROM withdrawals
+         WHERE status = 'approved' AND payout_status IN ('queued', 'retrying') AND updated_at < $1`,
+        time.Now().Add(-payoutSweepGrace))
+    if err != nil {
+        return err
+    }
+    var ids []string
+    for rows.Next() {
+        var id string
+        if err := rows.Scan(&id); err != nil {
+            rows.Close()
+            return err
+        }
+        ids = append(ids, id)
+    }
+    rows.Close()
+    if err := rows.Err(); err != nil {
+        return err
+    }
+
+    requeued := 0
+    for _, id := range ids {
+        err := enqueuePayout(id)
+        if errors.Is(err, asynq.ErrTaskIDConflict) {
+            continue
+        }
+        if err != nil {
+            log.Printf("[payouts] re-enqueue of withdrawal %s failed: %v", id, err)
+            continue
+        }
+        requeued++
+    }
+    if requeued > 0 {
+        log.Printf("[payouts] re-enqueued %d stranded payouts", requeued)
+    }
+    return nil
+}
+
+func handlePayoutSubmit(ctx context.Context, t *asynq.Task) error {
+    var p PayoutSubmitPayload
+    if err := json.Unmarshal(t.Payload(), &p); err != nil {
+        return err
+    }
+
+    var userID, status, payoutStatus, providerName string
+    var amount int64
+    var details []byte
+    err := db.Conn.QueryRow(ctx,
+        `SELECT w.user_id::text, w.amount, w.status, COALESCE(w.payout_status, ''), COALESCE(w.payout_provider, ''), pm.details
+         FROM withdrawals w JOIN payout_methods pm ON pm.id = w.payout_method_id
+         WHERE w.id = $1`, p.WithdrawalID,
+    ).Scan(&userID, &amount, &status, &payoutStatus, &providerName, &details)
+    if err != nil {
+        return err
+    }
+    // Already submitted or settled
+    if status != WithdrawalApproved || (payoutStatus != PayoutQueued && payoutStatus != PayoutRetrying) {
+        return nil
+    }
+
+    var dest payouts.Destination
+    if err := json.Unmarshal(details, &dest); err != nil {
+        return failPayout(ctx, p.WithdrawalID, "invalid payout destination")
+    }
+    provider, err := payouts.Get(providerName)
+    if err != nil {
+        return failPayout(ctx, p.WithdrawalID, "payout provider not available")
+    }
+
+    _, _ = db.Conn.Exec(ctx, `UPDATE withdrawals SET payout_attempts = payout_attempts + 1, updated_at = NOW() WHERE id = $1`, p.WithdrawalID)
+    res, err := provider.Submit(ctx, payouts.PayoutRequest{WithdrawalID: p.WithdrawalID, UserID: userID, Amount: amount, Destination: dest})
+    if err != nil {
+        retried, _ := asynq.GetRetryCount(ctx)
+        maxRetry, _ := asynq.GetMaxRetry(ctx)
+        if errors.Is(err, payouts.ErrRejected) || retried >= maxRetry {
+            return failPayout(ctx, p.WithdrawalID, err.Error())
+        }
+        _, _ = db.Conn.Exec(ctx,
+            `UPDATE withdrawals SET payout_status = 'retrying', payout_error = $2, updated_at = NOW() WHERE id = $1`,
+            p.WithdrawalID, err.Error())
+        return err
+    }
+
+    if _, err := db.Conn.Exec(ctx,
+        `UPDATE withdrawals SET payout_status = $2, payout_reference = $3, payout_error = NULL, updated_at = NOW() WHERE id = $1`,
+        p.WithdrawalID, PayoutProcessing, res.Reference,
+    ); err != nil {
+        return err
+    }
+    return applyPayoutResult(ctx, p.WithdrawalID, res)
+}
+
+// PayoutCallback receives payout status updates from a provider
+// POST /payouts/callback/:provider
+func PayoutCallback(c echo.Context) error {
+    provider, err := payouts.Get(c.Param("provider"))
+    if err != nil {
+        return c.JSON(http.StatusNotFound, echo.Map{"error": "unknown payout provider"})
+    }
+    body, err := io.ReadAll(io.LimitReader(c.Request().Body, 1<<20))
+    if err != nil {
+        return c.JSON(http.StatusBadRequest, echo.Map{"error": "could not read body"})
+    }
+    res, err := provider.ParseCallback(c.Request().Header, body)
+    if errors.Is(err, payments.ErrInvalidSignature) {
+        return c.JSON(http.StatusUnauthorized, echo.Map{"error": "invalid signature"})
+    }
+    if err != nil {
+        return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid payload"})
+    }
+
+    ctx := context.Background()
+    var withdrawalID string
+    err = db.Conn.QueryRow(ctx,
+        `SELECT id::text FROM withdrawals WHERE payout_provider = $1 AND payout_reference = $2`,
+        provider.Name(), res.Reference,
+    ).Scan(&withdrawalID)
+    if err != nil {
+        return c.JSON(http.StatusNotFound, echo.Map{"error": "withdrawal not found"})
+    }
+    if err := applyPayoutResult(ctx, withdrawalID, res); err != nil {
+        return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not update withdrawal"})
+    }
+    return c.JSON(http.StatusOK, echo.Map{"received": true, "withdrawal_id": withdrawalID})
+}
+
+func applyPayoutResult(ctx context.Context, withdrawalID string, res *payouts.Result) error {
+    switch res.Status {
+    case payouts.StatusPaid:
+        return completePayout(ctx, withdrawalID)
+    case payouts.StatusFailed:
+        reason := res.Reason
+        if reason == "" {
+            reason = "payout failed"
+        }
+        return failPayout(ctx, withdrawalID, reason)
+    }
+    return nil
+}
+
+// completePayout debits the reserved funds once the provider confirms payment
+func completePayout(ctx context.Context, withdrawalID string) error {
+    tx, err := db.Conn.Begin(ctx)
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback(ctx)
+
+    userID, amount, err := lockWithdrawal(ctx, tx, withdrawalID, WithdrawalApproved)
+    if errors.Is(err, errWithdrawalStatus) {
+        return nil // already settled
+    }
+    if err != nil {
+        return err
+    }
+
+    // Reserved funds leave the platform
+    if _, err = ledger.Transfer(ctx, tx, ledger.EntryWithdrawal, withdrawalID,
+        ledger.UserHeld(userID), ledger.ExternalClearing(), amount); err != nil {
+        return err
+    }
+    if _, err = tx.Exec(ctx,
+        `UPDATE withdrawals SET status = 'completed', payout_status = 'paid', paid_at = $2, updated_at = $2 WHERE id = $1`,
+        withdrawalID, time.Now(),
+    ); err != nil {
+        return err
+    }
+    if _, err = tx.Exec(ctx,
+        `UPDATE transactions SET status = 'completed' WHERE reference = $1 AND type = 'withdrawal' AND status = 'pending'`, withdrawalID,
+    ); err != nil {
+        return err
+    }
+    if err = tx.Commit(ctx); err != nil {
+        return err
+    }
+
+    notifyWithdrawal(withdrawalID, userID, WithdrawalCompleted, "", amount)
+    return nil
+}
+
+// failPayout gives the reserved funds back when a payout cannot be made
+func failPayout(ctx context.Context, withdrawalID, reason string) error {
+    tx, err := db.Conn.Begin(ctx)
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback(ctx)
+
+    userID, amount, err := lockWithdrawal(ctx, tx, withdrawalID, WithdrawalApproved)
+    if errors.Is(err, errWithdrawalStatus) {
+        return nil // already settled
+    }
+    if err != nil {
+        return err
+    }
+    if err = releaseWithdrawal(ctx, tx, withdrawalID, userID, amount, WithdrawalFailed, reason, ""); err != nil {
+        return err
+    }
+    if _, err = tx.Exec(ctx,
+        `UPDATE withdrawals SET payout_status = 'failed', payout_error = $2 WHERE id = $1`, withdrawalID, reason,
+    ); err != nil {
+        return err
+    }
+    if err = tx.Commit(ctx); err != nil {
+        return err
+    }
+
+    log.Printf("payout failed: withdrawal=%s reason=%s", withdrawalID, reason)
+    notifyWithdrawal(withdrawalID, userID, WithdrawalFailed, reason, amount)
+    return nil
+}
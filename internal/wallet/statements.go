@@ -0,0 +1,315 @@
+package wallet
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"github.com/labstack/echo/v4"
+	"github.com/sudo-init-do/crafthub/internal/alerts"
+	"github.com/sudo-init-do/crafthub/internal/db"
+	"github.com/sudo-init-do/crafthub/internal/ledger"
+)
+
+// Statements are built from the ledger. The balance shown is the wallet
+// balance (available + held), so moving funds into a hold is not a movement
+// but paying an order out of escrow or withdrawing is.
+
+const (
+	TaskMonthlyStatements = "wallet:monthly_statements"
+	TaskSendStatement     = "wallet:send_statement"
+)
+
+const statementDateLayout = "2006-01-02"
+
+func init() {
+	alerts.HandleFunc(TaskMonthlyStatements, handleMonthlyStatements)
+	alerts.HandleFunc(TaskSendStatement, handleSendStatement)
+	// 02:00 on the 1st, for the month that just ended
+	alerts.ScheduleCron("0 2 1 * *", TaskMonthlyStatements, asynq.Queue("emails"), asynq.Unique(time.Hour))
+}
+
+type StatementLine struct {
+	EntryID      string    `json:"entry_id"`
+	Date         time.Time `json:"date"`
+	Kind         string    `json:"kind"`
+	Description  string    `json:"description"`
+	Reference    string    `json:"reference,omitempty"`
+	OrderID      string    `json:"order_id,omitempty"`
+	ServiceID    string    `json:"service_id,omitempty"`
+	ServiceTitle string    `json:"service_title,omitempty"`
+	Amount       int64     `json:"amount"`
+	Balance      int64     `json:"balance"`
+}
+
+type Statement struct {
+	UserID         string          `json:"user_id"`
+	From           string          `json:"from"`
+	To             string          `json:"to"`
+	OpeningBalance int64           `json:"opening_balance"`
+	TotalIn        int64           `json:"total_in"`
+	TotalOut       int64           `json:"total_out"`
+	ClosingBalance int64           `json:"closing_balance"`
+	Lines          []StatementLine `json:"lines"`
+}
+
+var entryDescriptions = map[string]string{
+	ledger.EntryOpeningBalance:    "Balance carried over",
+	ledger.EntryTopup:             "Wallet top-up",
+	ledger.EntryWithdrawal:        "Withdrawal",
+	ledger.EntryWithdrawalRelease: "Withdrawal returned",
+	ledger.EntryOrderEscrow:       "Order payment",
+	ledger.EntryOrderRefund:       "Order refund",
+	ledger.EntryOrderHoldRelease:  "Order hold released",
+	ledger.EntryOrderRelease:      "Order earnings",
+	ledger.EntryOrderSettlement:   "Dispute settlement",
+	ledger.EntryOrderRevision:     "Extra revision",
+	ledger.EntryTip:               "Tip",
+}
+
+func describeEntry(kind, serviceTitle string) string {
+	d, ok := entryDescriptions[kind]
+	if !ok {
+		d = strings.ReplaceAll(kind, "_", " ")
+	}
+	if serviceTitle != "" {
+		d += " - " + serviceTitle
+	}
+	return d
+}
+
+// BuildStatement returns the user's wallet movements in [from, to)
+func BuildStatement(ctx context.Context, userID string, from, to time.Time) (*Statement, error) {
+	available := ledger.UserAvailable(userID).Code()
+	held := ledger.UserHeld(userID).Code()
+
+	st := &Statement{
+		UserID: userID,
+		From:   from.Format(statementDateLayout),
+		To:     to.AddDate(0, 0, -1).Format(statementDateLayout),
+		Lines:  []StatementLine{},
+	}
+	err := db.Conn.QueryRow(ctx,
+		`SELECT COALESCE(SUM(p.amount), 0)
+		 FROM ledger_postings p
+		 JOIN ledger_accounts a ON a.id = p.account_id
+		 JOIN ledger_entries e ON e.id = p.entry_id
+		 WHERE a.code IN ($1, $2) AND e.created_at < $3`,
+		available, held, from,
+	).Scan(&st.OpeningBalance)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Conn.Query(ctx,
+		`SELECT e.id::text, e.kind, COALESCE(e.reference::text, ''), e.created_at, SUM(p.amount),
+		        COALESCE(o.id::text, ''), COALESCE(s.id::text, ''), COALESCE(o.service_title, s.title, '')
+		 FROM ledger_entries e
+		 JOIN ledger_postings p ON p.entry_id = e.id
+		 JOIN ledger_accounts a ON a.id = p.account_id
+		 LEFT JOIN orders o ON o.id = e.reference
+		 LEFT JOIN services s ON s.id = o.service_id
+		 WHERE a.code IN ($1, $2) AND e.created_at >= $3 AND e.created_at < $4
+		 GROUP BY e.id, o.id, s.id
+		 HAVING SUM(p.amount) <> 0
+		 ORDER BY e.created_at, e.id`,
+		available, held, from, to,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	running := st.OpeningBalance
+	for rows.Next() {
+		var l StatementLine
+		if err := rows.Scan(&l.EntryID, &l.Kind, &l.Reference, &l.Date, &l.Amount, &l.OrderID, &l.ServiceID, &l.ServiceTitle); err != nil {
+			return nil, err
+		}
+		running += l.Amount
+		l.Balance = running
+		l.Date = l.Date.UTC()
+		l.Description = describeEntry(l.Kind, l.ServiceTitle)
+		if l.Amount > 0 {
+			st.TotalIn += l.Amount
+		} else {
+			st.TotalOut -= l.Amount
+		}
+		st.Lines = append(st.Lines, l)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	st.ClosingBalance = running
+	return st, nil
+}
+
+// WriteCSV writes the statement as CSV, with opening and closing rows around the movements
+func (s *Statement) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{"date", "description", "kind", "reference", "order_id", "service_id", "service_title", "amount", "balance"})
+	_ = cw.Write([]string{s.From, "Opening balance", "", "", "", "", "", "", strconv.FormatInt(s.OpeningBalance, 10)})
+	for _, l := range s.Lines {
+		_ = cw.Write([]string{
+			l.Date.Format(time.RFC3339), l.Description, l.Kind, l.Reference, l.OrderID, l.ServiceID, l.ServiceTitle,
+			strconv.FormatInt(l.Amount, 10), strconv.FormatInt(l.Balance, 10),
+		})
+	}
+	_ = cw.Write([]string{s.To, "Closing balance", "", "", "", "", "", "", strconv.FormatInt(s.ClosingBalance, 10)})
+	cw.Flush()
+	return cw.Error()
+}
+
+// parseStatementPeriod reads from/to (YYYY-MM-DD, both inclusive) and returns
+// a half-open [from, to) range. Defaults to the current month so far.
+func parseStatementPeriod(fromStr, toStr string) (time.Time, time.Time, error) {
+	now := time.Now().UTC()
+	from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC).AddDate(0, 0, 1)
+	var err error
+	if fromStr != "" {
+		if from, err = time.Parse(statementDateLayout, fromStr); err != nil {
+			return from, to, fmt.Errorf("from must be YYYY-MM-DD")
+		}
+	}
+	if toStr != "" {
+		if to, err = time.Parse(statementDateLayout, toStr); err != nil {
+			return from, to, fmt.Errorf("to must be YYYY-MM-DD")
+		}
+		to = to.AddDate(0, 0, 1)
+	}
+	if !to.After(from) {
+		return from, to, fmt.Errorf("to must not be before from")
+	}
+	if to.Sub(from) > 366*24*time.Hour {
+		return from, to, fmt.Errorf("period cannot exceed one year")
+	}
+	return from, to, nil
+}
+
+// GET /wallet/statements?from=&to=&format=csv|json
+func Statements(c echo.Context) error {
+	userID, ok := c.Get("user_id").(string)
+	if !ok || userID == "" {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "unauthorized"})
+	}
+	format := c.QueryParam("format")
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && format != "csv" {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "format must be csv or json"})
+	}
+	from, to, err := parseStatementPeriod(c.QueryParam("from"), c.QueryParam("to"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+	}
+
+	st, err := BuildStatement(c.Request().Context(), userID, from, to)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not build statement"})
+	}
+	if format == "json" {
+		return c.JSON(http.StatusOK, st)
+	}
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "text/csv; charset=utf-8")
+	res.Header().Set(echo.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="statement_%s_%s.csv"`, st.From, st.To))
+	res.WriteHeader(http.StatusOK)
+	return st.WriteCSV(res)
+}
+
+type sendStatementPayload struct {
+	UserID string `json:"user_id"`
+	From   string `json:"from"`
+	To     string `json:"to"`
+}
+
+// handleMonthlyStatements fans out one statement email per user with wallet
+// activity or a balance in the month that just ended
+func handleMonthlyStatements(ctx context.Context, _ *asynq.Task) error {
+	now := time.Now().UTC()
+	to := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	from := to.AddDate(0, -1, 0)
+
+	rows, err := db.Conn.Query(ctx,
+		`SELECT DISTINCT a.owner_id::text
+		 FROM ledger_accounts a
+		 JOIN ledger_postings p ON p.account_id = a.id
+		 JOIN ledger_entries e ON e.id = p.entry_id
+		 WHERE a.kind IN ($1, $2) AND e.created_at < $3`,
+		ledger.KindUserAvailable, ledger.KindUserHeld, to,
+	)
+	if err != nil {
+		return err
+	}
+	var users []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		users = append(users, id)
+	}
+	rows.Close()
+
+	month := from.Format("2006-01")
+	for _, userID := range users {
+		payload := sendStatementPayload{UserID: userID, From: from.Format(statementDateLayout), To: to.Format(statementDateLayout)}
+		err := alerts.EnqueueTask(TaskSendStatement, payload,
+			asynq.Queue("emails"), asynq.TaskID("statement:"+userID+":"+month), asynq.MaxRetry(5))
+		if err != nil && !errors.Is(err, asynq.ErrTaskIDConflict) {
+			log.Printf("[statements] enqueue failed: user=%s err=%v", userID, err)
+		}
+	}
+	return nil
+}
+
+func handleSendStatement(ctx context.Context, t *asynq.Task) error {
+	var p sendStatementPayload
+	if err := json.Unmarshal(t.Payload(), &p); err != nil {
+		return err
+	}
+	from, err := time.Parse(statementDateLayout, p.From)
+	if err != nil {
+		return err
+	}
+	to, err := time.Parse(statementDateLayout, p.To)
+	if err != nil {
+		return err
+	}
+	st, err := BuildStatement(ctx, p.UserID, from, to)
+	if err != nil {
+		return err
+	}
+	// Nothing happened and nothing is held: skip the email
+	if len(st.Lines) == 0 && st.ClosingBalance == 0 {
+		return nil
+	}
+
+	var email string
+	if err := db.Conn.QueryRow(ctx, `SELECT email FROM users WHERE id = $1`, p.UserID).Scan(&email); err != nil || email == "" {
+		return nil
+	}
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "Your Crafthub wallet statement for %s to %s.\n\n", st.From, st.To)
+	fmt.Fprintf(&body, "Opening balance: %d\nMoney in: %d\nMoney out: %d\nClosing balance: %d\n\n",
+		st.OpeningBalance, st.TotalIn, st.TotalOut, st.ClosingBalance)
+	body.WriteString("Movements (CSV):\n\n")
+	if err := st.WriteCSV(&body); err != nil {
+		return err
+	}
+	return alerts.SendEmail(email, "Your wallet statement for "+from.Format("January 2006"), body.String())
+}
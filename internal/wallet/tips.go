@@ -0,0 +1,265 @@
+package wallet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/sudo-init-do/crafthub/internal/alerts"
+	"github.com/sudo-init-do/crafthub/internal/db"
+	"github.com/sudo-init-do/crafthub/internal/ledger"
+)
+
+const tipMessageMaxLen = 280
+
+type Tip struct {
+	ID          string    `json:"id"`
+	SenderID    string    `json:"sender_id,omitempty"`
+	SenderName  string    `json:"sender_name,omitempty"`
+	RecipientID string    `json:"recipient_id"`
+	OrderID     string    `json:"order_id,omitempty"`
+	Amount      int64     `json:"amount"`
+	Message     string    `json:"message,omitempty"`
+	Anonymous   bool      `json:"anonymous"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// tipLimits are the anti-abuse limits applied per sender, read from env:
+// TIP_MIN_AMOUNT, TIP_MAX_AMOUNT, TIP_DAILY_MAX_COUNT, TIP_DAILY_MAX_AMOUNT.
+type tipLimits struct {
+	minAmount      int64
+	maxAmount      int64
+	dailyMaxCount  int64
+	dailyMaxAmount int64
+}
+
+func envInt64(key string, def int64) int64 {
+	if v, err := strconv.ParseInt(os.Getenv(key), 10, 64); err == nil && v > 0 {
+		return v
+	}
+	return def
+}
+
+func currentTipLimits() tipLimits {
+	return tipLimits{
+		minAmount:      envInt64("TIP_MIN_AMOUNT", 100),
+		maxAmount:      envInt64("TIP_MAX_AMOUNT", 50000),
+		dailyMaxCount:  envInt64("TIP_DAILY_MAX_COUNT", 20),
+		dailyMaxAmount: envInt64("TIP_DAILY_MAX_AMOUNT", 100000),
+	}
+}
+
+// POST /wallet/tips
+// Sends a tip from the caller's available balance to a creator, optionally
+// against a completed order the caller bought from them.
+func SendTip(c echo.Context) error {
+	senderID, ok := c.Get("user_id").(string)
+	if !ok || senderID == "" {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "unauthorized"})
+	}
+
+	var req struct {
+		RecipientID string `json:"recipient_id"`
+		OrderID     string `json:"order_id"`
+		Amount      int64  `json:"amount"`
+		Message     string `json:"message"`
+		Anonymous   bool   `json:"anonymous"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid request"})
+	}
+	req.Message = strings.TrimSpace(req.Message)
+	if len([]rune(req.Message)) > tipMessageMaxLen {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": fmt.Sprintf("message must be at most %d characters", tipMessageMaxLen)})
+	}
+
+	limits := currentTipLimits()
+	if req.Amount < limits.minAmount || req.Amount > limits.maxAmount {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": fmt.Sprintf("amount must be between %d and %d", limits.minAmount, limits.maxAmount)})
+	}
+
+	ctx := context.Background()
+	tx, err := db.Conn.Begin(ctx)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "transaction start failed"})
+	}
+	defer tx.Rollback(ctx)
+
+	// A tip on an order goes to that order's seller
+	if req.OrderID != "" {
+		var buyerID, sellerID, status string
+		err := tx.QueryRow(ctx, `SELECT buyer_id::text, seller_id::text, status FROM orders WHERE id = $1`, req.OrderID).
+			Scan(&buyerID, &sellerID, &status)
+		if err != nil || buyerID != senderID {
+			return c.JSON(http.StatusNotFound, echo.Map{"error": "order not found"})
+		}
+		if status != "completed" {
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": "tips can only be attached to completed orders"})
+		}
+		if req.RecipientID != "" && req.RecipientID != sellerID {
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": "recipient must be the order's seller"})
+		}
+		req.RecipientID = sellerID
+	}
+	if req.RecipientID == "" {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "recipient_id or order_id is required"})
+	}
+	if req.RecipientID == senderID {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "you cannot tip yourself"})
+	}
+
+	var recipientRole string
+	err = tx.QueryRow(ctx, `SELECT role FROM users WHERE id = $1`, req.RecipientID).Scan(&recipientRole)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, echo.Map{"error": "recipient not found"})
+	}
+	if recipientRole != "creator" {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "tips can only be sent to creators"})
+	}
+
+	// Lock the sender's wallet so concurrent tips see each other in the daily limits
+	var walletID string
+	if err := tx.QueryRow(ctx, `SELECT id FROM wallets WHERE user_id = $1 FOR UPDATE`, senderID).Scan(&walletID); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "wallet not found"})
+	}
+	var sentCount, sentAmount int64
+	if err := tx.QueryRow(ctx,
+		`SELECT COUNT(*), COALESCE(SUM(amount), 0) FROM tips
+		 WHERE sender_id = $1 AND created_at > NOW() - INTERVAL '24 hours'`, senderID,
+	).Scan(&sentCount, &sentAmount); err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not check tip limits"})
+	}
+	if sentCount >= limits.dailyMaxCount {
+		return c.JSON(http.StatusTooManyRequests, echo.Map{"error": fmt.Sprintf("you can send at most %d tips per day", limits.dailyMaxCount)})
+	}
+	if sentAmount+req.Amount > limits.dailyMaxAmount {
+		return c.JSON(http.StatusTooManyRequests, echo.Map{
+			"error":     "daily tip limit reached",
+			"remaining": limits.dailyMaxAmount - sentAmount,
+		})
+	}
+
+	tipID := uuid.New().String()
+	now := time.Now()
+	if _, err := ledger.Transfer(ctx, tx, ledger.EntryTip, tipID,
+		ledger.UserAvailable(senderID), ledger.UserAvailable(req.RecipientID), req.Amount); err != nil {
+		if errors.Is(err, ledger.ErrInsufficientFunds) || errors.Is(err, ledger.ErrWalletNotFound) {
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": "insufficient available balance"})
+		}
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to move funds"})
+	}
+	if _, err := tx.Exec(ctx,
+		`INSERT INTO tips (id, sender_id, recipient_id, order_id, amount, message, anonymous, created_at)
+		 VALUES ($1, $2, $3, NULLIF($4, '')::uuid, $5, NULLIF($6, ''), $7, $8)`,
+		tipID, senderID, req.RecipientID, req.OrderID, req.Amount, req.Message, req.Anonymous, now,
+	); err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to record tip"})
+	}
+	if _, err := tx.Exec(ctx,
+		`INSERT INTO transactions (user_id, amount, type, status, reference, created_at)
+		 VALUES ($1, $2, 'gift', 'debited', $3, $5), ($4, $2, 'gift', 'credited', $3, $5)`,
+		senderID, req.Amount, tipID, req.RecipientID, now,
+	); err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to record transactions"})
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "commit failed"})
+	}
+
+	// Notify the creator in-app (best-effort)
+	from := "Someone"
+	if !req.Anonymous {
+		_ = db.Conn.QueryRow(ctx, `SELECT COALESCE(NULLIF(name, ''), 'A fan') FROM users WHERE id = $1`, senderID).Scan(&from)
+	}
+	body := fmt.Sprintf("%s sent you a tip of %d.", from, req.Amount)
+	if req.Message != "" {
+		body += " \"" + req.Message + "\""
+	}
+	ref := tipID
+	meta := fmt.Sprintf(`{"amount":%d,"order_id":%q}`, req.Amount, req.OrderID)
+	_ = alerts.CreateNotification(req.RecipientID, "tip:received", "You received a tip", body, &ref, &meta)
+
+	return c.JSON(http.StatusCreated, echo.Map{
+		"message": "Tip sent",
+		"tip": Tip{
+			ID: tipID, SenderID: senderID, RecipientID: req.RecipientID, OrderID: req.OrderID,
+			Amount: req.Amount, Message: req.Message, Anonymous: req.Anonymous, CreatedAt: now,
+		},
+	})
+}
+
+// GET /wallet/tips?direction=sent|received
+func ListTips(c echo.Context) error {
+	userID, ok := c.Get("user_id").(string)
+	if !ok || userID == "" {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "unauthorized"})
+	}
+	column := "recipient_id"
+	switch c.QueryParam("direction") {
+	case "", "received":
+	case "sent":
+		column = "sender_id"
+	default:
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "direction must be sent or received"})
+	}
+
+	rows, err := db.Conn.Query(context.Background(),
+		`SELECT t.id::text, t.sender_id::text, COALESCE(u.name, ''), t.recipient_id::text, COALESCE(t.order_id::text, ''),
+		        t.amount, COALESCE(t.message, ''), t.anonymous, t.created_at
+		 FROM tips t JOIN users u ON u.id = t.sender_id
+		 WHERE t.`+column+` = $1
+		 ORDER BY t.created_at DESC
+		 LIMIT 200`, userID,
+	)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not fetch tips"})
+	}
+	defer rows.Close()
+
+	tips := []Tip{}
+	for rows.Next() {
+		var t Tip
+		if err := rows.Scan(&t.ID, &t.SenderID, &t.SenderName, &t.RecipientID, &t.OrderID, &t.Amount, &t.Message, &t.Anonymous, &t.CreatedAt); err != nil {
+			return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to read tip"})
+		}
+		// Recipients do not see who sent an anonymous tip
+		if t.Anonymous && t.SenderID != userID {
+			t.SenderID, t.SenderName = "", ""
+		}
+		tips = append(tips, t)
+	}
+	return c.JSON(http.StatusOK, echo.Map{"tips": tips})
+}
+
+// RecentSupporters returns the latest public tips received by a creator
+func RecentSupporters(ctx context.Context, creatorID string, limit int) ([]Tip, error) {
+	rows, err := db.Conn.Query(ctx,
+		`SELECT t.id::text, CASE WHEN t.anonymous THEN '' ELSE t.sender_id::text END,
+		        CASE WHEN t.anonymous THEN 'Anonymous' ELSE COALESCE(u.name, '') END,
+		        t.recipient_id::text, t.amount, COALESCE(t.message, ''), t.anonymous, t.created_at
+		 FROM tips t JOIN users u ON u.id = t.sender_id
+		 WHERE t.recipient_id = $1
+		 ORDER BY t.created_at DESC
+		 LIMIT $2`, creatorID, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tips := []Tip{}
+	for rows.Next() {
+		var t Tip
+		if err := rows.Scan(&t.ID, &t.SenderID, &t.SenderName, &t.RecipientID, &t.Amount, &t.Message, &t.Anonymous, &t.CreatedAt); err != nil {
+			return nil, err
+		}
+		tips = append(tips, t)
+	}
+	return tips, rows.Err()
+}
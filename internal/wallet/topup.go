@@ -2,13 +2,21 @@ package wallet
 
 import (
     "context"
+    "errors"
+    "log"
     "net/http"
     "os"
+    "strconv"
     "time"
 
     "github.com/google/uuid"
+    "github.com/hibiken/asynq"
+    "github.com/jackc/pgx/v5"
     "github.com/labstack/echo/v4"
+    "github.com/sudo-init-do/crafthub/internal/alerts"
     "github.com/sudo-init-do/crafthub/internal/db"
+    "github.com/sudo-init-do/crafthub/internal/ledger"
+    "github.com/sudo-init-do/crafthub/internal/payments"
 )
 
 // -----------------------------
@@ -19,18 +27,60 @@ type TopupRequest struct {
 }
 
 type TopupResponse struct {
-	TopupID string `json:"topup_id"`
-	Status  string `json:"status"`
-	Message string `json:"message"`
+	TopupID    string    `json:"topup_id"`
+	Status     string    `json:"status"`
+	PaymentURL string    `json:"payment_url,omitempty"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Message    string    `json:"message"`
 }
 
 type ConfirmTopupRequest struct {
 	TopupID string `json:"topup_id"`
-	Status  string `json:"status"` // must be "success"
+}
+
+// Topup statuses
+const (
+    TopupPending   = "pending"
+    TopupCompleted = "completed"
+    TopupFailed    = "failed"
+    TopupExpired   = "expired"
+)
+
+var errTopupNotFound = errors.New("topup not found")
+
+// TaskExpireTopups periodically expires pending topups nobody paid
+const TaskExpireTopups = "topups:expire"
+
+func init() {
+    alerts.HandleFunc(TaskExpireTopups, handleExpireTopups)
+    every := 5 * time.Minute
+    if v, err := strconv.Atoi(os.Getenv("TOPUP_JOBS_INTERVAL_MINUTES")); err == nil && v > 0 {
+        every = time.Duration(v) * time.Minute
+    }
+    alerts.Schedule(every, TaskExpireTopups)
+}
+
+func handleExpireTopups(ctx context.Context, _ *asynq.Task) error {
+    n, err := ExpireTopups(ctx)
+    if err != nil {
+        return err
+    }
+    if n > 0 {
+        log.Printf("[topups] expired %d pending topups", n)
+    }
+    return nil
+}
+
+// topupTTL is how long a pending topup waits for payment (TOPUP_EXPIRY_MINUTES, default 30)
+func topupTTL() time.Duration {
+    if v, err := strconv.Atoi(os.Getenv("TOPUP_EXPIRY_MINUTES")); err == nil && v > 0 {
+        return time.Duration(v) * time.Minute
+    }
+    return 30 * time.Minute
 }
 
 // -----------------------------
-// TopupInit - Create Pending Record
+// TopupInit - Create Pending Record + Provider Payment
 // -----------------------------
 func TopupInit(c echo.Context) error {
     req := new(TopupRequest)
@@ -48,91 +98,74 @@ func TopupInit(c echo.Context) error {
     conn := db.Conn
     ctx := context.Background()
 
-    // If auto-confirm is enabled, credit wallet immediately and mark topup completed
-    if os.Getenv("TOPUP_AUTO_CONFIRM") == "true" {
-        tx, err := conn.Begin(ctx)
-        if err != nil {
-            return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not start transaction"})
-        }
-        defer tx.Rollback(ctx)
+    provider, err := payments.Default()
+    if err != nil {
+        return c.JSON(http.StatusInternalServerError, echo.Map{"error": "payment provider not configured"})
+    }
 
-        topupID := uuid.New().String()
-        createdAt := time.Now()
+    topupID := uuid.New().String()
+    createdAt := time.Now()
+    expiresAt := createdAt.Add(topupTTL())
 
-        // Insert completed topup
-        _, err = tx.Exec(ctx,
-            `INSERT INTO topups (id, user_id, amount, status, created_at)
-             VALUES ($1, $2, $3, 'completed', $4)`,
-            topupID, userID, req.Amount, createdAt,
-        )
-        if err != nil {
-            return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not record topup"})
-        }
+    _, err = conn.Exec(ctx,
+        `INSERT INTO topups (id, user_id, amount, status, provider, expires_at, created_at, updated_at)
+         VALUES ($1, $2, $3, 'pending', $4, $5, $6, $6)`,
+        topupID, userID, req.Amount, provider.Name(), expiresAt, createdAt,
+    )
+    if err != nil {
+        return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not create topup"})
+    }
 
-        // Update wallet balance
-        _, err = tx.Exec(ctx,
-            `UPDATE wallets SET balance = balance + $1 WHERE user_id = $2`,
-            req.Amount, userID,
-        )
+    res, err := provider.Init(ctx, payments.InitRequest{TopupID: topupID, UserID: userID, Amount: req.Amount, ExpiresAt: expiresAt})
+    if err != nil {
+        _, _ = conn.Exec(ctx,
+            `UPDATE topups SET status = 'failed', failure_reason = 'provider init failed', updated_at = NOW() WHERE id = $1`, topupID)
+        return c.JSON(http.StatusBadGateway, echo.Map{"error": "could not start payment"})
+    }
+    if _, err = conn.Exec(ctx,
+        `UPDATE topups SET provider_ref = $2, updated_at = NOW() WHERE id = $1`, topupID, res.Reference,
+    ); err != nil {
+        return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not record payment reference"})
+    }
+
+    // Some providers settle immediately (e.g. the mock with TOPUP_AUTO_CONFIRM)
+    if res.Status != payments.StatusPending {
+        status, err := applyProviderStatus(ctx, topupID, &payments.Verification{Reference: res.Reference, Status: res.Status, Amount: req.Amount})
         if err != nil {
             return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not update wallet"})
         }
-
-        // Log transaction
-        _, _ = tx.Exec(ctx,
-            `INSERT INTO transactions (id, user_id, type, amount, status, created_at)
-             VALUES ($1, $2, $3, $4, $5, $6)`,
-            uuid.New().String(), userID, "deposit", float64(req.Amount), "completed", time.Now(),
-        )
-
-        if err = tx.Commit(ctx); err != nil {
-            return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not finalize topup"})
-        }
-
         var balance int64
         _ = conn.QueryRow(ctx, `SELECT balance FROM wallets WHERE user_id = $1`, userID).Scan(&balance)
-
         return c.JSON(http.StatusOK, echo.Map{
-            "message": "Topup completed and wallet credited",
+            "message":  "Topup " + status,
             "topup_id": topupID,
-            "status":   "completed",
+            "status":   status,
             "balance":  balance,
         })
     }
 
-    // Default behaviour: create pending topup and return payment URL
-    topupID := uuid.New().String()
-    createdAt := time.Now()
-
-    _, err := conn.Exec(ctx,
-        `INSERT INTO topups (id, user_id, amount, status, created_at)
-         VALUES ($1, $2, $3, $4, $5)`,
-        topupID, userID, req.Amount, "pending", createdAt,
-    )
-    if err != nil {
-        return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not create topup"})
-    }
-
-    paymentURL := os.Getenv("MOCK_PAYMENT_URL")
-    if paymentURL == "" {
-        paymentURL = "https://pay.crafthub.dev/mock/" + topupID
-    }
-
     return c.JSON(http.StatusOK, TopupResponse{
-        TopupID: topupID,
-        Status:  "pending",
-        Message: "Topup initialized. Complete payment at " + paymentURL,
+        TopupID:    topupID,
+        Status:     TopupPending,
+        PaymentURL: res.PaymentURL,
+        ExpiresAt:  expiresAt,
+        Message:    "Topup initialized. Complete payment at " + res.PaymentURL,
     })
 }
 
 // -----------------------------
-// ConfirmTopup - Confirm Payment + Credit Wallet
+// ConfirmTopup - Verify Payment With Provider + Credit Wallet
 // -----------------------------
+// The client can only ask us to re-check a topup; the outcome always comes
+// from the payment provider.
 func ConfirmTopup(c echo.Context) error {
     var req ConfirmTopupRequest
     if err := c.Bind(&req); err != nil {
         return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid request"})
     }
+    if req.TopupID == "" {
+        req.TopupID = c.Param("id")
+    }
 
 	topupUUID, err := uuid.Parse(req.TopupID)
 	if err != nil {
@@ -142,24 +175,15 @@ func ConfirmTopup(c echo.Context) error {
     conn := db.Conn
     ctx := context.Background()
 
-    tx, err := conn.Begin(ctx)
-    if err != nil {
-        return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not start transaction"})
-    }
-    defer tx.Rollback(ctx)
-
     // Ownership enforcement: only the owner of the topup can confirm it, unless admin
     requesterID, _ := c.Get("user_id").(string)
     requesterRole, _ := c.Get("role").(string)
 
-    var userID string
-    var amount int64
-    var status string
-    err = tx.QueryRow(ctx,
-        `SELECT user_id, amount, status 
-         FROM topups 
-         WHERE id = $1 FOR UPDATE`, topupUUID,
-    ).Scan(&userID, &amount, &status)
+    var userID, status string
+    var providerName, providerRef *string
+    err = conn.QueryRow(ctx,
+        `SELECT user_id, status, provider, provider_ref FROM topups WHERE id = $1`, topupUUID,
+    ).Scan(&userID, &status, &providerName, &providerRef)
     if err != nil {
         return c.JSON(http.StatusNotFound, echo.Map{"error": "topup not found"})
     }
@@ -169,38 +193,34 @@ func ConfirmTopup(c echo.Context) error {
         return c.JSON(http.StatusForbidden, echo.Map{"error": "not allowed to confirm another user's topup"})
     }
 
-    if status == "completed" {
+    switch status {
+    case TopupCompleted:
         return c.JSON(http.StatusBadRequest, echo.Map{"error": "topup already confirmed"})
+    case TopupFailed:
+        return c.JSON(http.StatusBadRequest, echo.Map{"error": "topup failed"})
     }
-
-    if req.Status != "success" {
-        return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid status"})
+    if providerName == nil || providerRef == nil {
+        return c.JSON(http.StatusBadRequest, echo.Map{"error": "topup has no payment to verify"})
     }
 
-    // Mark topup as completed
-    _, err = tx.Exec(ctx, `UPDATE topups SET status = 'completed' WHERE id = $1`, topupUUID)
+    provider, err := payments.Get(*providerName)
     if err != nil {
-        return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not update topup"})
+        return c.JSON(http.StatusInternalServerError, echo.Map{"error": "payment provider not configured"})
     }
-
-    // Update wallet balance
-    _, err = tx.Exec(ctx,
-        `UPDATE wallets SET balance = balance + $1 WHERE user_id = $2`,
-        amount, userID,
-    )
+    v, err := provider.Verify(ctx, *providerRef)
     if err != nil {
-        return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not update wallet"})
+        return c.JSON(http.StatusBadGateway, echo.Map{"error": "could not verify payment"})
     }
 
-    // Log transaction
-    _, _ = tx.Exec(ctx,
-        `INSERT INTO transactions (id, user_id, type, amount, status, created_at)
-         VALUES ($1, $2, $3, $4, $5, $6)`,
-        uuid.New().String(), userID, "deposit", amount, "completed", time.Now(),
-    )
-
-    if err = tx.Commit(ctx); err != nil {
-        return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not finalize topup"})
+    status, err = applyProviderStatus(ctx, topupUUID.String(), v)
+    if err != nil {
+        return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not update topup"})
+    }
+    switch status {
+    case TopupPending:
+        return c.JSON(http.StatusAccepted, echo.Map{"message": "payment not completed yet", "status": status})
+    case TopupFailed, TopupExpired:
+        return c.JSON(http.StatusBadRequest, echo.Map{"error": "topup " + status, "status": status})
     }
 
     // Return new balance
@@ -209,10 +229,99 @@ func ConfirmTopup(c echo.Context) error {
 
     return c.JSON(http.StatusOK, echo.Map{
         "message": "Topup confirmed and wallet updated",
+        "status":  status,
         "balance": balance,
     })
 }
 
+// applyProviderStatus moves a topup to match the provider's view of its payment
+// and returns the resulting topup status. Transitions:
+//   pending -> completed | failed | expired (once past expires_at)
+//   expired -> completed | failed (late settlement)
+// completed and failed are final.
+func applyProviderStatus(ctx context.Context, topupID string, v *payments.Verification) (string, error) {
+    tx, err := db.Conn.Begin(ctx)
+    if err != nil {
+        return "", err
+    }
+    defer tx.Rollback(ctx)
+
+    var userID, status string
+    var amount int64
+    var expiresAt *time.Time
+    err = tx.QueryRow(ctx,
+        `SELECT user_id, amount, status, expires_at FROM topups WHERE id = $1 FOR UPDATE`, topupID,
+    ).Scan(&userID, &amount, &status, &expiresAt)
+    if errors.Is(err, pgx.ErrNoRows) {
+        return "", errTopupNotFound
+    }
+    if err != nil {
+        return "", err
+    }
+    if status == TopupCompleted || status == TopupFailed {
+        return status, nil
+    }
+
+    switch v.Status {
+    case payments.StatusSucceeded:
+        if v.Amount != amount {
+            status = TopupFailed
+            _, err = tx.Exec(ctx,
+                `UPDATE topups SET status = 'failed', failure_reason = 'amount mismatch', updated_at = NOW() WHERE id = $1`, topupID)
+            break
+        }
+        status = TopupCompleted
+        if _, err = tx.Exec(ctx, `UPDATE topups SET status = 'completed', updated_at = NOW() WHERE id = $1`, topupID); err != nil {
+            return "", err
+        }
+        // Credit wallet from external clearing and log transaction
+        err = creditTopup(ctx, tx, topupID, userID, amount)
+    case payments.StatusFailed:
+        status = TopupFailed
+        _, err = tx.Exec(ctx,
+            `UPDATE topups SET status = 'failed', failure_reason = NULLIF($2, ''), updated_at = NOW() WHERE id = $1`,
+            topupID, v.FailureReason)
+    default:
+        if status == TopupPending && expiresAt != nil && time.Now().After(*expiresAt) {
+            status = TopupExpired
+            _, err = tx.Exec(ctx, `UPDATE topups SET status = 'expired', updated_at = NOW() WHERE id = $1`, topupID)
+        }
+    }
+    if err != nil {
+        return "", err
+    }
+    if err = tx.Commit(ctx); err != nil {
+        return "", err
+    }
+    return status, nil
+}
+
+// ExpireTopups marks pending topups past their expiry as expired. A payment
+// that settles later still completes through applyProviderStatus.
+func ExpireTopups(ctx context.Context) (int64, error) {
+    ct, err := db.Conn.Exec(ctx,
+        `UPDATE topups SET status = 'expired', updated_at = NOW()
+         WHERE status = 'pending' AND expires_at IS NOT NULL AND expires_at < NOW()`)
+    if err != nil {
+        return 0, err
+    }
+    return ct.RowsAffected(), nil
+}
+
+// creditTopup posts the ledger entry for a completed topup and logs the deposit
+func creditTopup(ctx context.Context, tx pgx.Tx, topupID, userID string, amount int64) error {
+    if _, err := ledger.Transfer(ctx, tx, ledger.EntryTopup, topupID,
+        ledger.ExternalClearing(), ledger.UserAvailable(userID), amount); err != nil {
+        return err
+    }
+    _, err := tx.Exec(ctx,
+        `INSERT INTO transactions (id, user_id, type, amount, status, reference, created_at)
+         VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+        uuid.New().String(), userID, "deposit", amount, "completed", topupID, time.Now(),
+    )
+    return err
+}
+
 // -----------------------------
 // ListPendingTopups - Admin Only
 // -----------------------------
@@ -0,0 +1,55 @@
+package wallet
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sudo-init-do/crafthub/internal/db"
+	"github.com/sudo-init-do/crafthub/internal/payments"
+)
+
+// PaymentWebhook receives payment status changes from a provider.
+// POST /payments/webhook/:provider
+// The request must carry a valid provider signature; topups are moved through
+// the same transitions as ConfirmTopup, so repeated deliveries are harmless.
+func PaymentWebhook(c echo.Context) error {
+	provider, err := payments.Get(c.Param("provider"))
+	if err != nil {
+		return c.JSON(http.StatusNotFound, echo.Map{"error": "unknown payment provider"})
+	}
+
+	body, err := io.ReadAll(io.LimitReader(c.Request().Body, 1<<20))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "could not read body"})
+	}
+	ev, err := provider.ParseWebhook(c.Request().Header, body)
+	if errors.Is(err, payments.ErrInvalidSignature) {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "invalid signature"})
+	}
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid payload"})
+	}
+
+	ctx := context.Background()
+	var topupID string
+	err = db.Conn.QueryRow(ctx,
+		`SELECT id FROM topups WHERE provider = $1 AND provider_ref = $2`, provider.Name(), ev.Reference,
+	).Scan(&topupID)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, echo.Map{"error": "topup not found"})
+	}
+
+	status, err := applyProviderStatus(ctx, topupID, &payments.Verification{
+		Reference:     ev.Reference,
+		Status:        ev.Status,
+		Amount:        ev.Amount,
+		FailureReason: ev.FailureReason,
+	})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not update topup"})
+	}
+	return c.JSON(http.StatusOK, echo.Map{"received": true, "topup_id": topupID, "status": status})
+}
@@ -2,15 +2,48 @@ package wallet
 
 import (
     "context"
+    "errors"
+    "fmt"
     "net/http"
     "time"
 
     "github.com/google/uuid"
+    "github.com/jackc/pgx/v5"
     "github.com/labstack/echo/v4"
+    "github.com/sudo-init-do/crafthub/internal/alerts"
     "github.com/sudo-init-do/crafthub/internal/db"
+    "github.com/sudo-init-do/crafthub/internal/ledger"
 )
 
-// InitWithdrawal initializes a withdrawal request (two-step flow)
+// Withdrawal statuses
+const (
+    WithdrawalPending   = "pending"   // funds reserved, waiting for an admin
+    WithdrawalApproved  = "approved"  // payout submitted to the provider
+    WithdrawalCompleted = "completed" // paid out
+    WithdrawalRejected  = "rejected"  // declined by an admin, funds released
+    WithdrawalCanceled  = "canceled"  // withdrawn by the user, funds released
+    WithdrawalFailed    = "failed"    // payout failed, funds released
+)
+
+var errWithdrawalStatus = errors.New("withdrawal is not in the expected status")
+
+type WithdrawalResponse struct {
+    ID         string     `json:"id"`
+    UserID     string     `json:"user_id"`
+    Amount     int64      `json:"amount"`
+    Status     string     `json:"status"`
+    Reason     string     `json:"reason,omitempty"`
+    PayoutMethod    string `json:"payout_method,omitempty"`
+    PayoutStatus    string `json:"payout_status,omitempty"`
+    PayoutReference string `json:"payout_reference,omitempty"`
+    CreatedAt  time.Time  `json:"created_at"`
+    ApprovedAt *time.Time `json:"approved_at,omitempty"`
+    RejectedAt *time.Time `json:"rejected_at,omitempty"`
+}
+
+// InitWithdrawal requests a withdrawal. The amount is reserved from the
+// available balance (like locked_amount for orders) until an admin approves
+// or rejects it.
 func InitWithdrawal(c echo.Context) error {
 	// Get user ID from JWT context
 	uid, ok := c.Get("user_id").(string)
@@ -22,7 +55,8 @@ func InitWithdrawal(c echo.Context) error {
 
 	// Parse request
     var req struct {
-        Amount int64 `json:"amount"`
+        Amount         int64  `json:"amount"`
+        PayoutMethodID string `json:"payout_method_id"` // defaults to the user's default method
     }
     if err := c.Bind(&req); err != nil {
         return c.JSON(http.StatusBadRequest, echo.Map{
@@ -42,21 +76,213 @@ func InitWithdrawal(c echo.Context) error {
     }
 
     ctx := context.Background()
-    // Create a pending withdrawal entry; funds will be deducted on confirmation
+    tx, err := db.Conn.Begin(ctx)
+    if err != nil {
+        return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not start transaction"})
+    }
+    defer tx.Rollback(ctx)
+
+    methodID, err := resolvePayoutMethod(ctx, tx, uid, req.PayoutMethodID)
+    if errors.Is(err, errNoPayoutMethod) {
+        return c.JSON(http.StatusBadRequest, echo.Map{"error": "add a payout method before withdrawing"})
+    }
+    if err != nil {
+        return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not load payout method"})
+    }
+
     withdrawalID := uuid.New().String()
-    _, err := db.Conn.Exec(ctx,
-        `INSERT INTO withdrawals (id, user_id, amount, status, created_at)
-         VALUES ($1, $2, $3, 'pending', $4)`,
-        withdrawalID, uid, req.Amount, time.Now(),
+    now := time.Now()
+    _, err = tx.Exec(ctx,
+        `INSERT INTO withdrawals (id, user_id, amount, status, payout_method_id, created_at, updated_at)
+         VALUES ($1, $2, $3, 'pending', $4, $5, $5)`,
+        withdrawalID, uid, req.Amount, methodID, now,
     )
     if err != nil {
         return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not create withdrawal"})
     }
 
+    // Reserve the funds until an admin reviews the request
+    _, err = ledger.Transfer(ctx, tx, ledger.EntryWithdrawalHold, withdrawalID,
+        ledger.UserAvailable(uid), ledger.UserHeld(uid), req.Amount)
+    if errors.Is(err, ledger.ErrInsufficientFunds) || errors.Is(err, ledger.ErrWalletNotFound) {
+        return c.JSON(http.StatusBadRequest, echo.Map{"error": "insufficient balance"})
+    }
+    if err != nil {
+        return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not reserve funds"})
+    }
+
+    if _, err = tx.Exec(ctx,
+        `INSERT INTO transactions (id, user_id, type, amount, status, reference, created_at)
+         VALUES ($1, $2, 'withdrawal', $3, 'pending', $4, $5)`,
+        uuid.New().String(), uid, req.Amount, withdrawalID, now,
+    ); err != nil {
+        return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not record transaction"})
+    }
+
+    if err = tx.Commit(ctx); err != nil {
+        return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not finalize withdrawal"})
+    }
+
+    notifyWithdrawal(withdrawalID, uid, WithdrawalPending, "", req.Amount)
+    _ = alerts.EnqueueAdminAlert(uid, "info", fmt.Sprintf("Withdrawal %s of %d awaiting approval", withdrawalID, req.Amount))
+
     return c.JSON(http.StatusOK, echo.Map{
         "withdrawal_id": withdrawalID,
         "amount":        req.Amount,
-        "status":        "pending",
-        "message":       "Withdrawal initialized; confirm to complete",
+        "status":        WithdrawalPending,
+        "message":       "Withdrawal requested; funds are reserved pending admin approval",
     })
 }
+
+// ListWithdrawals returns the current user's withdrawals, newest first
+func ListWithdrawals(c echo.Context) error {
+    uid, ok := c.Get("user_id").(string)
+    if !ok || uid == "" {
+        return c.JSON(http.StatusUnauthorized, echo.Map{"error": "unauthorized"})
+    }
+    items, err := queryWithdrawals(context.Background(), uid, "")
+    if err != nil {
+        return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not fetch withdrawals"})
+    }
+    return c.JSON(http.StatusOK, echo.Map{"withdrawals": items})
+}
+
+// CancelWithdrawal lets the user withdraw a pending request and releases the reservation
+func CancelWithdrawal(c echo.Context) error {
+    uid, ok := c.Get("user_id").(string)
+    if !ok || uid == "" {
+        return c.JSON(http.StatusUnauthorized, echo.Map{"error": "unauthorized"})
+    }
+    id := c.Param("id")
+
+    ctx := context.Background()
+    tx, err := db.Conn.Begin(ctx)
+    if err != nil {
+        return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not start transaction"})
+    }
+    defer tx.Rollback(ctx)
+
+    userID, amount, err := lockWithdrawal(ctx, tx, id, WithdrawalPending)
+    if errors.Is(err, pgx.ErrNoRows) || (err == nil && userID != uid) {
+        return c.JSON(http.StatusNotFound, echo.Map{"error": "withdrawal not found"})
+    }
+    if errors.Is(err, errWithdrawalStatus) {
+        return c.JSON(http.StatusBadRequest, echo.Map{"error": "only pending withdrawals can be canceled"})
+    }
+    if err != nil {
+        return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not load withdrawal"})
+    }
+
+    if err = releaseWithdrawal(ctx, tx, id, userID, amount, WithdrawalCanceled, "canceled by user", ""); err != nil {
+        return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not release funds"})
+    }
+    if err = tx.Commit(ctx); err != nil {
+        return c.JSON(http.StatusInternalServerError, echo.Map{"error": "could not cancel withdrawal"})
+    }
+
+    notifyWithdrawal(id, userID, WithdrawalCanceled, "", amount)
+    return c.JSON(http.StatusOK, echo.Map{"message": "withdrawal canceled", "withdrawal_id": id})
+}
+
+// lockWithdrawal locks a withdrawal row and checks it is still in the wanted status
+func lockWithdrawal(ctx context.Context, tx pgx.Tx, id, want string) (string, int64, error) {
+    var userID, status string
+    var amount int64
+    err := tx.QueryRow(ctx,
+        `SELECT user_id::text, amount, status FROM withdrawals WHERE id = $1 FOR UPDATE`, id,
+    ).Scan(&userID, &amount, &status)
+    if err != nil {
+        return "", 0, err
+    }
+    if status != want {
+        return userID, amount, errWithdrawalStatus
+    }
+    return userID, amount, nil
+}
+
+// releaseWithdrawal returns reserved funds to the available balance and closes the request
+func releaseWithdrawal(ctx context.Context, tx pgx.Tx, id, userID string, amount int64, status, reason, reviewerID string) error {
+    if _, err := ledger.Transfer(ctx, tx, ledger.EntryWithdrawalRelease, id,
+        ledger.UserHeld(userID), ledger.UserAvailable(userID), amount); err != nil {
+        return err
+    }
+    if _, err := tx.Exec(ctx,
+        `UPDATE withdrawals
+         SET status = $2, reason = NULLIF($3, ''), rejected_by = NULLIF($4, '')::uuid,
+             rejected_at = CASE WHEN $4 = '' THEN NULL ELSE NOW() END, updated_at = NOW()
+         WHERE id = $1`,
+        id, status, reason, reviewerID,
+    ); err != nil {
+        return err
+    }
+    _, err := tx.Exec(ctx,
+        `UPDATE transactions SET status = 'failed' WHERE reference = $1 AND type = 'withdrawal' AND status = 'pending'`, id)
+    return err
+}
+
+func queryWithdrawals(ctx context.Context, userID, status string) ([]WithdrawalResponse, error) {
+    rows, err := db.Conn.Query(ctx,
+        `SELECT w.id::text, w.user_id::text, w.amount, w.status, COALESCE(w.reason, ''),
+                COALESCE(pm.display, ''), COALESCE(w.payout_status, ''), COALESCE(w.payout_reference, ''),
+                w.created_at, w.approved_at, w.rejected_at
+         FROM withdrawals w
+         LEFT JOIN payout_methods pm ON pm.id = w.payout_method_id
+         WHERE ($1 = '' OR w.user_id::text = $1) AND ($2 = '' OR w.status = $2)
+         ORDER BY w.created_at DESC`, userID, status,
+    )
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var items []WithdrawalResponse
+    for rows.Next() {
+        var w WithdrawalResponse
+        if err := rows.Scan(&w.ID, &w.UserID, &w.Amount, &w.Status, &w.Reason,
+            &w.PayoutMethod, &w.PayoutStatus, &w.PayoutReference, &w.CreatedAt, &w.ApprovedAt, &w.RejectedAt); err != nil {
+            return nil, err
+        }
+        items = append(items, w)
+    }
+    return items, rows.Err()
+}
+
+// notifyWithdrawal tells the user about a withdrawal state change (best-effort)
+func notifyWithdrawal(withdrawalID, userID, status, reason string, amount int64) {
+    var title, body string
+    switch status {
+    case WithdrawalPending:
+        title = "Withdrawal requested"
+        body = fmt.Sprintf("Your withdrawal of %d is awaiting approval. The funds are reserved in your wallet.", amount)
+    case WithdrawalApproved:
+        title = "Withdrawal approved"
+        body = fmt.Sprintf("Your withdrawal of %d has been approved and is being paid out.", amount)
+    case WithdrawalCompleted:
+        title = "Withdrawal paid"
+        body = fmt.Sprintf("Your withdrawal of %d has been paid out.", amount)
+    case WithdrawalFailed:
+        title = "Withdrawal failed"
+        body = fmt.Sprintf("We could not pay out your withdrawal of %d. The funds are back in your wallet.", amount)
+    case WithdrawalRejected:
+        title = "Withdrawal rejected"
+        body = fmt.Sprintf("Your withdrawal of %d was rejected and the funds are back in your wallet.", amount)
+    case WithdrawalCanceled:
+        title = "Withdrawal canceled"
+        body = fmt.Sprintf("Your withdrawal of %d was canceled and the funds are back in your wallet.", amount)
+    default:
+        return
+    }
+    if reason != "" {
+        body += " Reason: " + reason
+    }
+
+    ref := withdrawalID
+    meta := fmt.Sprintf(`{"status":%q,"amount":%d}`, status, amount)
+    _ = alerts.CreateNotification(userID, "withdrawal:"+status, title, body, &ref, &meta)
+
+    var email string
+    _ = db.Conn.QueryRow(context.Background(), `SELECT email FROM users WHERE id = $1`, userID).Scan(&email)
+    if email != "" {
+        _ = alerts.EnqueueWithdrawalStatus(withdrawalID, userID, email, title, body, status, float64(amount))
+    }
+}
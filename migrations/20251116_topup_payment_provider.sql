@@ -0,0 +1,15 @@
+-- Provider-backed topups: pending -> completed | failed | expired
+
+ALTER TABLE topups ADD COLUMN IF NOT EXISTS provider TEXT;
+ALTER TABLE topups ADD COLUMN IF NOT EXISTS provider_ref TEXT;
+ALTER TABLE topups ADD COLUMN IF NOT EXISTS failure_reason TEXT;
+ALTER TABLE topups ADD COLUMN IF NOT EXISTS expires_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE topups ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP;
+
+ALTER TABLE topups DROP CONSTRAINT IF EXISTS topups_status_check;
+ALTER TABLE topups
+    ADD CONSTRAINT topups_status_check
+    CHECK (status IN ('pending', 'completed', 'failed', 'expired'));
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_topups_provider_ref ON topups(provider, provider_ref) WHERE provider_ref IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_topups_pending_expiry ON topups(expires_at) WHERE status = 'pending';
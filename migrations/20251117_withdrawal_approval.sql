@@ -0,0 +1,14 @@
+-- Admin approval workflow for withdrawals.
+-- pending (funds reserved) -> completed | rejected | canceled
+
+ALTER TABLE withdrawals ADD COLUMN IF NOT EXISTS rejected_by UUID NULL REFERENCES users(id);
+ALTER TABLE withdrawals ADD COLUMN IF NOT EXISTS rejected_at TIMESTAMP NULL;
+ALTER TABLE withdrawals ADD COLUMN IF NOT EXISTS reason TEXT NULL;
+ALTER TABLE withdrawals ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP;
+
+ALTER TABLE withdrawals DROP CONSTRAINT IF EXISTS withdrawals_status_check;
+ALTER TABLE withdrawals
+    ADD CONSTRAINT withdrawals_status_check
+    CHECK (status IN ('pending', 'approved', 'rejected', 'completed', 'failed', 'canceled'));
+
+CREATE INDEX IF NOT EXISTS idx_withdrawals_status ON withdrawals(status, created_at);
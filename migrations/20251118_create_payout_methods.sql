@@ -0,0 +1,28 @@
+-- Saved payout destinations and payout tracking on withdrawals.
+-- details holds the full destination for the provider; display is the masked
+-- form returned by the API.
+
+CREATE TABLE IF NOT EXISTS payout_methods (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    type TEXT NOT NULL CHECK (type IN ('bank_account','mobile_money')),
+    display TEXT NOT NULL,
+    details JSONB NOT NULL,
+    is_default BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMP WITH TIME ZONE NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_payout_methods_user ON payout_methods(user_id) WHERE deleted_at IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_payout_methods_default ON payout_methods(user_id) WHERE is_default AND deleted_at IS NULL;
+
+ALTER TABLE withdrawals ADD COLUMN IF NOT EXISTS payout_method_id UUID NULL REFERENCES payout_methods(id);
+ALTER TABLE withdrawals ADD COLUMN IF NOT EXISTS payout_provider TEXT NULL;
+ALTER TABLE withdrawals ADD COLUMN IF NOT EXISTS payout_reference TEXT NULL;
+ALTER TABLE withdrawals ADD COLUMN IF NOT EXISTS payout_status TEXT NULL
+    CHECK (payout_status IN ('queued','retrying','processing','paid','failed'));
+ALTER TABLE withdrawals ADD COLUMN IF NOT EXISTS payout_attempts INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE withdrawals ADD COLUMN IF NOT EXISTS payout_error TEXT NULL;
+ALTER TABLE withdrawals ADD COLUMN IF NOT EXISTS paid_at TIMESTAMP WITH TIME ZONE NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_withdrawals_payout_reference ON withdrawals(payout_provider, payout_reference) WHERE payout_reference IS NOT NULL;
@@ -0,0 +1,26 @@
+-- Admin-configurable platform fees: percent (basis points) + fixed amount,
+-- optionally scoped by service category and seller role, with an optional
+-- promotional window (starts_at/ends_at).
+
+CREATE TABLE IF NOT EXISTS fee_schedules (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name TEXT NOT NULL,
+    category TEXT NULL,
+    seller_role TEXT NULL CHECK (seller_role IN ('fan','creator')),
+    percent_bps INTEGER NOT NULL DEFAULT 0 CHECK (percent_bps BETWEEN 0 AND 10000),
+    fixed_amount BIGINT NOT NULL DEFAULT 0 CHECK (fixed_amount >= 0),
+    starts_at TIMESTAMP WITH TIME ZONE NULL,
+    ends_at TIMESTAMP WITH TIME ZONE NULL,
+    is_active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_by UUID NULL REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_fee_schedules_active ON fee_schedules(is_active, category, seller_role);
+
+-- Fee breakdown captured on the order at creation time
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS platform_fee BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS fee_schedule_id UUID NULL REFERENCES fee_schedules(id) ON DELETE SET NULL;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS fee_percent_bps INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS fee_fixed BIGINT NOT NULL DEFAULT 0;
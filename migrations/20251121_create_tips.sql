@@ -0,0 +1,16 @@
+-- Fan-to-creator tips, moved wallet to wallet through the ledger
+
+CREATE TABLE IF NOT EXISTS tips (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    sender_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    recipient_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    order_id UUID NULL REFERENCES orders(id) ON DELETE SET NULL,
+    amount BIGINT NOT NULL CHECK (amount > 0),
+    message TEXT NULL CHECK (char_length(message) <= 280),
+    anonymous BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CHECK (sender_id <> recipient_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_tips_recipient ON tips(recipient_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_tips_sender ON tips(sender_id, created_at DESC);
@@ -0,0 +1,12 @@
+-- Dispute resolutions settle the order escrow, including partial refunds
+
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS refunded_amount BIGINT NOT NULL DEFAULT 0;
+
+ALTER TABLE disputes ADD COLUMN IF NOT EXISTS buyer_refund BIGINT NULL;
+ALTER TABLE disputes ADD COLUMN IF NOT EXISTS seller_payout BIGINT NULL;
+
+ALTER TABLE disputes DROP CONSTRAINT IF EXISTS disputes_resolution_check;
+ALTER TABLE disputes DROP CONSTRAINT IF EXISTS disputes_resolution_allowed;
+ALTER TABLE disputes
+    ADD CONSTRAINT disputes_resolution_allowed
+        CHECK (resolution IN ('refund','release','split','none'));
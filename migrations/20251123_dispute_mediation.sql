@@ -0,0 +1,26 @@
+-- Mediation phase: buyer and seller negotiate before a dispute reaches the admins.
+-- Existing disputes are already in the admin queue, so they start escalated.
+
+ALTER TABLE disputes ADD COLUMN IF NOT EXISTS stage TEXT NOT NULL DEFAULT 'escalated';
+ALTER TABLE disputes ALTER COLUMN stage SET DEFAULT 'mediation';
+ALTER TABLE disputes DROP CONSTRAINT IF EXISTS disputes_stage_allowed;
+ALTER TABLE disputes
+    ADD CONSTRAINT disputes_stage_allowed CHECK (stage IN ('mediation','escalated'));
+ALTER TABLE disputes ADD COLUMN IF NOT EXISTS mediation_deadline TIMESTAMP WITH TIME ZONE NULL;
+ALTER TABLE disputes ADD COLUMN IF NOT EXISTS escalated_at TIMESTAMP WITH TIME ZONE NULL;
+ALTER TABLE disputes ADD COLUMN IF NOT EXISTS escalation_reason TEXT NULL;
+
+CREATE TABLE IF NOT EXISTS dispute_proposals (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    dispute_id UUID NOT NULL REFERENCES disputes(id) ON DELETE CASCADE,
+    proposer_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    refund_amount BIGINT NOT NULL CHECK (refund_amount >= 0),
+    note TEXT NULL,
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending','accepted','rejected','countered','expired')),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    responded_at TIMESTAMP WITH TIME ZONE NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_dispute_proposals_dispute ON dispute_proposals(dispute_id, created_at);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_dispute_proposals_one_pending ON dispute_proposals(dispute_id) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_disputes_mediation ON disputes(mediation_deadline) WHERE status = 'open' AND stage = 'mediation';
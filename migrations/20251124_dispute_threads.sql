@@ -0,0 +1,23 @@
+-- Dispute threads with evidence, admin assignment and priorities
+
+ALTER TABLE disputes ADD COLUMN IF NOT EXISTS priority TEXT NOT NULL DEFAULT 'normal';
+ALTER TABLE disputes DROP CONSTRAINT IF EXISTS disputes_priority_allowed;
+ALTER TABLE disputes
+    ADD CONSTRAINT disputes_priority_allowed CHECK (priority IN ('low','normal','high','urgent'));
+ALTER TABLE disputes ADD COLUMN IF NOT EXISTS assigned_to UUID NULL REFERENCES users(id) ON DELETE SET NULL;
+ALTER TABLE disputes ADD COLUMN IF NOT EXISTS assigned_at TIMESTAMP WITH TIME ZONE NULL;
+ALTER TABLE disputes ADD COLUMN IF NOT EXISTS first_admin_response_at TIMESTAMP WITH TIME ZONE NULL;
+
+CREATE INDEX IF NOT EXISTS idx_disputes_assigned_to ON disputes(assigned_to) WHERE status = 'open';
+
+CREATE TABLE IF NOT EXISTS dispute_messages (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    dispute_id UUID NOT NULL REFERENCES disputes(id) ON DELETE CASCADE,
+    author_id UUID NULL REFERENCES users(id) ON DELETE SET NULL,
+    author_role TEXT NOT NULL CHECK (author_role IN ('buyer','seller','admin','system')),
+    body TEXT NOT NULL DEFAULT '',
+    attachments JSONB NOT NULL DEFAULT '[]'::jsonb,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_dispute_messages_dispute ON dispute_messages(dispute_id, created_at);
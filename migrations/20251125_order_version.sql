@@ -0,0 +1,3 @@
+-- Optimistic concurrency for order transitions
+
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 0;
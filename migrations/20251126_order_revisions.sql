@@ -0,0 +1,31 @@
+-- Revisions included with a service, paid extra revisions and versioned deliveries
+
+ALTER TABLE services ADD COLUMN IF NOT EXISTS revisions_included INT NOT NULL DEFAULT 0;
+ALTER TABLE services ADD COLUMN IF NOT EXISTS extra_revision_price BIGINT NULL;
+
+-- Snapshot of the service terms at order time
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS revisions_included INT NOT NULL DEFAULT 0;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS revisions_used INT NOT NULL DEFAULT 0;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS extra_revision_price BIGINT NULL;
+
+CREATE TABLE IF NOT EXISTS order_deliveries (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    order_id UUID NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    round INT NOT NULL,
+    message TEXT NOT NULL DEFAULT '',
+    attachments JSONB NOT NULL DEFAULT '[]'::jsonb,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (order_id, round)
+);
+
+CREATE TABLE IF NOT EXISTS order_revisions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    order_id UUID NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    delivery_id UUID NULL REFERENCES order_deliveries(id) ON DELETE SET NULL,
+    note TEXT NOT NULL,
+    charged BIGINT NOT NULL DEFAULT 0,
+    requested_by UUID NULL REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_revisions_order ON order_revisions(order_id, created_at);
@@ -0,0 +1,28 @@
+-- Delivery deadlines, reminders, on-time tracking and extensions
+
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS delivery_days INT NOT NULL DEFAULT 0;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS due_at TIMESTAMP WITH TIME ZONE NULL;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS due_reminder_sent_at TIMESTAMP WITH TIME ZONE NULL;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS overdue_notified_at TIMESTAMP WITH TIME ZONE NULL;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS first_delivered_at TIMESTAMP WITH TIME ZONE NULL;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS delivered_on_time BOOLEAN NULL;
+
+CREATE INDEX IF NOT EXISTS idx_orders_due_at ON orders(due_at) WHERE status = 'in_progress';
+CREATE INDEX IF NOT EXISTS idx_orders_seller_on_time ON orders(seller_id) WHERE delivered_on_time IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS order_deadline_extensions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    order_id UUID NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    requested_by UUID NULL REFERENCES users(id) ON DELETE SET NULL,
+    requested_role TEXT NOT NULL CHECK (requested_role IN ('buyer','seller','admin')),
+    days INT NOT NULL CHECK (days > 0),
+    reason TEXT NOT NULL DEFAULT '',
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending','accepted','rejected','granted','withdrawn')),
+    new_due_at TIMESTAMP WITH TIME ZONE NULL,
+    responded_by UUID NULL REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    responded_at TIMESTAMP WITH TIME ZONE NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_order_extensions_one_pending
+    ON order_deadline_extensions(order_id) WHERE status = 'pending';
@@ -0,0 +1,32 @@
+-- Basic/Standard/Premium packages, add-on extras and the ordered selection
+
+CREATE TABLE IF NOT EXISTS service_packages (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    service_id UUID NOT NULL REFERENCES services(id) ON DELETE CASCADE,
+    tier TEXT NOT NULL CHECK (tier IN ('basic','standard','premium')),
+    name TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    price BIGINT NOT NULL CHECK (price > 0),
+    delivery_days INT NOT NULL DEFAULT 0 CHECK (delivery_days >= 0),
+    revisions_included INT NOT NULL DEFAULT 0 CHECK (revisions_included >= 0),
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (service_id, tier)
+);
+
+CREATE TABLE IF NOT EXISTS service_extras (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    service_id UUID NOT NULL REFERENCES services(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    price BIGINT NOT NULL CHECK (price >= 0),
+    delivery_days_delta INT NOT NULL DEFAULT 0,
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_service_extras_service ON service_extras(service_id);
+
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS package_id UUID NULL REFERENCES service_packages(id) ON DELETE SET NULL;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS package_tier TEXT NULL;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS selection JSONB NULL;
@@ -0,0 +1,23 @@
+-- Custom offers sent by sellers from an order's message thread
+
+CREATE TABLE IF NOT EXISTS custom_offers (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    thread_order_id UUID NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    service_id UUID NOT NULL REFERENCES services(id) ON DELETE CASCADE,
+    seller_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    buyer_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    scope TEXT NOT NULL,
+    price BIGINT NOT NULL CHECK (price > 0),
+    delivery_days INT NOT NULL DEFAULT 0 CHECK (delivery_days >= 0),
+    revisions_included INT NOT NULL DEFAULT 0 CHECK (revisions_included >= 0),
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending','accepted','declined','withdrawn')),
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    order_id UUID NULL REFERENCES orders(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    responded_at TIMESTAMP WITH TIME ZONE NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_custom_offers_thread ON custom_offers(thread_order_id, created_at);
+
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS offer_id UUID NULL REFERENCES custom_offers(id) ON DELETE SET NULL;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS custom_offer_id UUID NULL REFERENCES custom_offers(id) ON DELETE SET NULL;
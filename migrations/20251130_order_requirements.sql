@@ -0,0 +1,8 @@
+-- Per-service requirements questionnaire and the buyer's answers per order
+
+ALTER TABLE services ADD COLUMN IF NOT EXISTS requirements JSONB NOT NULL DEFAULT '[]'::jsonb;
+
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS requirements JSONB NULL;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS answers JSONB NULL;
+-- Existing orders count as complete; new orders set it explicitly
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS requirements_completed_at TIMESTAMP WITH TIME ZONE NULL DEFAULT CURRENT_TIMESTAMP;
@@ -0,0 +1,20 @@
+-- Uploaded files: avatars, order attachments and delivery deliverables
+
+CREATE TABLE IF NOT EXISTS files (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    owner_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    purpose TEXT NOT NULL CHECK (purpose IN ('avatar','attachment','delivery')),
+    storage_driver TEXT NOT NULL,
+    storage_key TEXT NOT NULL UNIQUE,
+    filename TEXT NOT NULL,
+    content_type TEXT NOT NULL,
+    size_bytes BIGINT NOT NULL CHECK (size_bytes > 0),
+    sha256 TEXT NOT NULL,
+    order_id UUID NULL REFERENCES orders(id) ON DELETE CASCADE,
+    delivery_id UUID NULL REFERENCES order_deliveries(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_files_owner ON files(owner_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_files_order ON files(order_id) WHERE order_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_files_delivery ON files(delivery_id) WHERE delivery_id IS NOT NULL;
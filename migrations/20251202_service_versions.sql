@@ -0,0 +1,49 @@
+-- Seller editing, pausing and deletion of services with a version history,
+-- and the service as bought snapshotted on each order
+
+ALTER TABLE services DROP CONSTRAINT IF EXISTS services_status_check;
+ALTER TABLE services ADD CONSTRAINT services_status_check
+    CHECK (status IN ('active','suspended','pending','paused','deleted'));
+ALTER TABLE services ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 1;
+ALTER TABLE services ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP WITH TIME ZONE NULL;
+ALTER TABLE services ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE NULL;
+
+CREATE TABLE IF NOT EXISTS service_versions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    service_id UUID NOT NULL REFERENCES services(id) ON DELETE CASCADE,
+    version INT NOT NULL,
+    title TEXT NOT NULL,
+    description TEXT NULL,
+    price BIGINT NOT NULL,
+    category TEXT NULL,
+    delivery_time_days INT NULL,
+    revisions_included INT NOT NULL DEFAULT 0,
+    extra_revision_price BIGINT NULL,
+    requirements JSONB NOT NULL DEFAULT '[]'::jsonb,
+    packages JSONB NOT NULL DEFAULT '[]'::jsonb,
+    extras JSONB NOT NULL DEFAULT '[]'::jsonb,
+    status TEXT NOT NULL,
+    change TEXT NOT NULL DEFAULT '',
+    edited_by UUID NULL REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (service_id, version)
+);
+
+-- Services listed before versioning start their history at their current state
+INSERT INTO service_versions (service_id, version, title, description, price, category, delivery_time_days,
+                              revisions_included, extra_revision_price, requirements, packages, extras, status, change, edited_by)
+SELECT s.id, s.version, s.title, s.description, s.price, s.category, s.delivery_time_days,
+       s.revisions_included, s.extra_revision_price, s.requirements,
+       COALESCE((SELECT jsonb_agg(to_jsonb(p) - 'service_id') FROM service_packages p WHERE p.service_id = s.id AND p.active), '[]'::jsonb),
+       COALESCE((SELECT jsonb_agg(to_jsonb(x) - 'service_id') FROM service_extras x WHERE x.service_id = s.id AND x.active), '[]'::jsonb),
+       COALESCE(s.status, 'active'), 'created', s.user_id
+FROM services s
+WHERE NOT EXISTS (SELECT 1 FROM service_versions v WHERE v.service_id = s.id);
+
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS service_title TEXT NULL;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS service_price BIGINT NULL;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS service_version INT NULL;
+
+UPDATE orders o SET service_title = s.title
+FROM services s
+WHERE s.id = o.service_id AND o.service_title IS NULL;
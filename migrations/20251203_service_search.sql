@@ -0,0 +1,24 @@
+-- Full-text and typo-tolerant search over services, and rating aggregates
+-- kept on the service so discovery no longer joins every order and review
+
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+ALTER TABLE services ADD COLUMN IF NOT EXISTS search_vector tsvector
+    GENERATED ALWAYS AS (
+        setweight(to_tsvector('english', COALESCE(title, '')), 'A') ||
+        setweight(to_tsvector('english', COALESCE(description, '')), 'B') ||
+        setweight(to_tsvector('english', COALESCE(category, '')), 'C')
+    ) STORED;
+CREATE INDEX IF NOT EXISTS idx_services_search ON services USING GIN (search_vector);
+CREATE INDEX IF NOT EXISTS idx_services_title_trgm ON services USING GIN (title gin_trgm_ops);
+
+ALTER TABLE services ADD COLUMN IF NOT EXISTS rating_avg DOUBLE PRECISION NOT NULL DEFAULT 0;
+ALTER TABLE services ADD COLUMN IF NOT EXISTS rating_count INT NOT NULL DEFAULT 0;
+
+UPDATE services s SET rating_avg = agg.avg, rating_count = agg.n
+FROM (
+    SELECT o.service_id, AVG(r.rating)::float AS avg, COUNT(*) AS n
+    FROM reviews r JOIN orders o ON o.id = r.order_id
+    GROUP BY o.service_id
+) agg
+WHERE agg.service_id = s.id;